@@ -29,12 +29,19 @@ const ExitLogError = 5
 // TODO: Find a good way to implement controls for this.
 const registerStderrSink = true
 
+// recentLines is the number of the most recent log lines that are kept in
+// memory for the crash reports.
+const recentLines = 100
+
 // TODO: Is there a better way to implement this?
 var pid = os.Getpid() //nolint:gochecknoglobals
 
 // metaPool is a pool of *sink.Meta.
 var metaPool sync.Pool //nolint:gochecknoglobals
 
+// recent is the sink that keeps the most recent log lines in memory.
+var recent = sink.NewRing(recentLines) //nolint:gochecknoglobals
+
 // Init initializes the logging.
 // The logger only outputs messages that are greater than or equal to the given
 // severity.
@@ -46,6 +53,11 @@ func Init(verbosity Level) {
 	verbosityLevel = verbosity
 }
 
+// Verbosity returns the verbosity level the logging was initialized with.
+func Verbosity() Level {
+	return verbosityLevel
+}
+
 // formatToPrint returns a fmt.Printf format specifier that formats its
 // arguments as if they were passed to fmt.Print.
 func formatToPrint(args []any) string {
@@ -115,7 +127,7 @@ func logf(depth int, severity severity.Severity, format string, args ...any) {
 	_, err := sink.Printf(meta, format, args...)
 	if err != nil {
 		sink.Printf(meta, "alog: exiting because of error: %v", err)
-		// TODO: Flush files.
+		Flush()
 		os.Exit(ExitLogError)
 	}
 
@@ -140,7 +152,21 @@ func metaFromPool() (any, *sink.Meta) {
 	return meta, meta
 }
 
+// Flush flushes the buffered log entries of all of the sinks.
+// The errors are ignored as there is nowhere to report them.
+func Flush() {
+	_ = sink.Flush()
+}
+
+// RecentLines returns the most recent log lines from the oldest to the newest.
+// The lines are only recorded after the logging is initialized.
+func RecentLines() []string {
+	return recent.Lines()
+}
+
 func registerSinks() {
+	sink.TextSinks = append(sink.TextSinks, recent)
+
 	if registerStderrSink {
 		sink.TextSinks = append(sink.TextSinks, &sink.Stderr{})
 	}
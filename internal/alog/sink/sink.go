@@ -245,3 +245,25 @@ func writeDigits(buf *bytes.Buffer, n int, d uint64, pad byte) {
 
 	buf.Write(tmp[j:])
 }
+
+// Flusher is implemented by the sinks that buffer their output.
+type Flusher interface {
+	// Flush writes the buffered log entries to the output.
+	Flush() error
+}
+
+// Flush flushes the registered Text sinks that implement Flusher.
+// It returns the first error encountered.
+func Flush() error {
+	var err error
+
+	for _, s := range TextSinks {
+		if f, ok := s.(Flusher); ok {
+			if fErr := f.Flush(); fErr != nil && err == nil {
+				err = fErr
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"strings"
+	"sync"
+)
+
+// Ring is a Text sink that keeps the most recent log entries in memory.
+// It is used to include the latest log lines in crash reports.
+type Ring struct {
+	lock  sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// NewRing returns a new Ring that keeps at most n log entries.
+func NewRing(n int) *Ring {
+	return &Ring{
+		lock:  sync.Mutex{},
+		lines: make([]string, n),
+		next:  0,
+		full:  false,
+	}
+}
+
+func (r *Ring) Enabled(_ *Meta) bool {
+	return len(r.lines) > 0
+}
+
+func (r *Ring) Emit(_ *Meta, p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.lines[r.next] = strings.TrimSuffix(string(p), "\n")
+	r.next++
+
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+
+	return len(p), nil
+}
+
+// Lines returns the stored log entries from the oldest to the newest without
+// the trailing newlines.
+func (r *Ring) Lines() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.full {
+		result := make([]string, r.next)
+		copy(result, r.lines[:r.next])
+
+		return result
+	}
+
+	result := make([]string, 0, len(r.lines))
+	result = append(result, r.lines[r.next:]...)
+	result = append(result, r.lines[:r.next]...)
+
+	return result
+}
@@ -0,0 +1,30 @@
+package sink_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/alog/sink"
+)
+
+func TestRingSink(t *testing.T) {
+	t.Parallel()
+
+	r := sink.NewRing(3)
+
+	for _, s := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		if _, err := r.Emit(nil, []byte(s)); err != nil {
+			t.Fatalf("Emit failed: %v", err)
+		}
+
+		if s == "b\n" {
+			if got := r.Lines(); !slices.Equal(got, []string{"a", "b"}) {
+				t.Errorf("Lines() = %q, want %q", got, []string{"a", "b"})
+			}
+		}
+	}
+
+	if got := r.Lines(); !slices.Equal(got, []string{"b", "c", "d"}) {
+		t.Errorf("Lines() = %q, want %q", got, []string{"b", "c", "d"})
+	}
+}
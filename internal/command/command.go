@@ -4,7 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"os"
+	"slices"
 	"strings"
 )
 
@@ -14,17 +14,25 @@ const (
 )
 
 const (
-	ExitSuccess         = 0
-	ExitInvalidArgs     = 2
-	ExitCommandNotFound = 4
+	ExitSuccess             = 0
+	ExitFailure             = 1
+	ExitInvalidArgs         = 2
+	ExitIncompatibleVersion = 3
+	ExitCommandNotFound     = 4
+
+	// ExitInterrupted is the exit code when the program is exited by
+	// a signal before the command has finished.
+	// It is the conventional exit code for a program that is killed by SIGINT.
+	ExitInterrupted = 130
 )
 
 // A Command is an implementation of an Agricola command.
 type Command struct {
 	// Run runs the command.
+	// The env is the environment the command is run in.
 	// The args are the arguments passed in after the command name.
 	// The function returns the exit code of the command.
-	Run func(cmd *Command, args []string) int
+	Run func(env *Env, cmd *Command, args []string) int
 
 	// UsageLine is the one-line usage message.
 	// The words between "ager" and the first flag or argument in the line are
@@ -38,13 +46,30 @@ type Command struct {
 	Long string
 
 	// Flag is a set of flags specific to this command.
+	// Its Usage function is set when the command is invoked.
 	Flag *flag.FlagSet
 
+	// Aliases are the alternative names of the command, for example "up" for
+	// "apply".
+	Aliases []string
+
 	// Commands is a list of the available commands (so-called subcommands) and
 	// other help topics for this command.
 	// The order here is the order in which they are printed when running the
 	// 'help' command.
 	Commands []*Command
+
+	// Complete returns the completion candidates for the positional argument
+	// that is being completed.
+	// The args are the positional arguments before the completed one and
+	// toComplete is the partial argument.
+	// The candidates do not need to be filtered by toComplete.
+	// If Complete is nil, the shell completes file names instead.
+	Complete func(env *Env, args []string, toComplete string) []string
+
+	// Hidden reports whether the command is left out of the help output and
+	// shell completion.
+	Hidden bool
 }
 
 // LongName returns the command's long name.
@@ -62,20 +87,41 @@ func (c *Command) LongName() string {
 	return strings.TrimPrefix(name, CommandName+" ")
 }
 
-// Lookup returns the subcommand with the given name, if any.
+// Lookup returns the subcommand with the given name or alias, if any.
+// If there is no such subcommand, Lookup returns the visible subcommand whose
+// name has n as its prefix if exactly one subcommand matches.
 // Otherwise it returns nil.
 // Lookup ignores subcommands that have len(c.Commands) == 0 and c.Run == nil.
 // Such subcommands are only meant to be used as arguments to "help".
 func (c *Command) Lookup(n string) *Command {
+	var prefixed []*Command
+
 	for _, cmd := range c.Commands {
-		if cmd.Name() == n && (len(c.Commands) > 0 || c.Runnable()) {
+		if !cmd.lookupable() {
+			continue
+		}
+
+		if cmd.Name() == n || slices.Contains(cmd.Aliases, n) {
 			return cmd
 		}
+
+		if n != "" && !cmd.Hidden && strings.HasPrefix(cmd.Name(), n) {
+			prefixed = append(prefixed, cmd)
+		}
+	}
+
+	if len(prefixed) == 1 {
+		return prefixed[0]
 	}
 
 	return nil
 }
 
+// lookupable reports whether the command can be looked up as a subcommand.
+func (c *Command) lookupable() bool {
+	return len(c.Commands) > 0 || c.Runnable()
+}
+
 // Name return the command's short name.
 // The short name of a command is the last word in the usage line before a flag
 // or an argument.
@@ -94,13 +140,14 @@ func (c *Command) Runnable() bool {
 	return c.Run != nil
 }
 
-func (c *Command) Usage() {
+// Usage writes the short usage message of the command to w.
+func (c *Command) Usage(w io.Writer) {
 	if c.UsageLine == CommandName {
 		panic("(*Command).Usage() should not be called for the base command")
 	}
 
-	fmt.Fprintln(os.Stderr, "usage: "+c.UsageLine)
-	fmt.Fprintln(os.Stderr, "Run '"+CommandName+" help "+c.LongName()+"' for details.")
+	fmt.Fprintln(w, "usage: "+c.UsageLine)
+	fmt.Fprintln(w, "Run '"+CommandName+" help "+c.LongName()+"' for details.")
 }
 
 func BaseCommand() *Command {
@@ -111,7 +158,10 @@ func BaseCommand() *Command {
 		Short:     "",
 		Long:      Name + " is a tool for managing web application deployments declaratively.",
 		Flag:      nil, // initialized in the main package
+		Aliases:   nil,
 		Commands:  nil, // initialized in the main package
+		Complete:  nil,
+		Hidden:    false,
 	}
 }
 
@@ -0,0 +1,122 @@
+package command_test
+
+import (
+	"flag"
+	"slices"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+func newCommand(name string, aliases ...string) *command.Command {
+	return &command.Command{
+		Run:       func(*command.Env, *command.Command, []string) int { return command.ExitSuccess },
+		UsageLine: command.CommandName + " " + name,
+		Short:     "",
+		Long:      "",
+		Flag:      command.DefaultFlagSet(name),
+		Aliases:   aliases,
+		Commands:  nil,
+		Complete:  nil,
+		Hidden:    false,
+	}
+}
+
+func testTree() *command.Command {
+	hidden := newCommand("secret")
+	hidden.Hidden = true
+
+	root := command.BaseCommand()
+	root.Commands = []*command.Command{
+		newCommand("apply", "up"),
+		newCommand("plan"),
+		newCommand("plow"),
+		newCommand("status"),
+		hidden,
+	}
+
+	return root
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"apply", "apply"},
+		{"up", "apply"},
+		{"ap", "apply"},
+		{"st", "status"},
+		{"pl", ""},
+		{"pla", "plan"},
+		{"secret", "secret"},
+		{"sec", ""},
+		{"aply", ""},
+		{"", ""},
+	}
+
+	root := testTree()
+
+	for _, tt := range tests {
+		got := ""
+		if cmd := root.Lookup(tt.in); cmd != nil {
+			got = cmd.Name()
+		}
+
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestCommands(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"aply", []string{"apply"}},
+		{"pl", []string{"plan", "plow"}},
+		{"plon", []string{"plan", "plow"}},
+		{"statsu", []string{"status"}},
+		{"uo", []string{"up"}},
+		{"secre", nil},
+		{"deploy", nil},
+	}
+
+	root := testTree()
+
+	for _, tt := range tests {
+		if got := root.SuggestCommands(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("SuggestCommands(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestFlags(t *testing.T) {
+	t.Parallel()
+
+	f := flag.NewFlagSet("test", flag.ContinueOnError)
+	f.String("file", "", "")
+	f.String("pre", "", "")
+	f.Bool("prerelease", false, "")
+
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"fiel", []string{"file"}},
+		{"pre", []string{"pre", "prerelease"}},
+		{"prerelaese", []string{"prerelease"}},
+		{"build", nil},
+	}
+
+	for _, tt := range tests {
+		if got := command.SuggestFlags(f, tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("SuggestFlags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Package completion implements the shell completion commands.
+//
+// The completion scripts are generated from the command tree. The names of the
+// commands and their flags are written into the scripts, and the scripts call
+// the hidden "__complete" command to complete the arguments of the commands
+// that have dynamic completions, for example the names of the sites.
+package completion
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+// completeCmdName is the name of the hidden command that the completion
+// scripts call for the dynamic completions.
+const completeCmdName = "__complete"
+
+// shells are the script generators of the supported shells.
+var shells = map[string]func(w io.Writer, root *command.Command) error{ //nolint:gochecknoglobals
+	"bash": writeBash,
+	"fish": writeFish,
+	"zsh":  writeZsh,
+}
+
+// Command returns the completion command that generates the completion scripts
+// for the command tree of root.
+func Command(root *command.Command) *command.Command {
+	c := &command.Command{
+		Run: func(env *command.Env, cmd *command.Command, args []string) int {
+			return runCompletion(env, cmd, args, root)
+		},
+		UsageLine: command.CommandName + " completion [bash|zsh|fish]",
+		Short:     "generates the shell completion scripts",
+		Long: `Completion writes the completion script for the given shell to the standard
+output.
+
+To load the completions in the current bash session, run:
+
+	source <(` + command.CommandName + ` completion bash)
+
+To load the completions in zsh, write the script to a file named "_` + command.CommandName + `"
+in a directory in your fpath:
+
+	` + command.CommandName + ` completion zsh > "${fpath[1]}/_` + command.CommandName + `"
+
+To load the completions in fish, write the script to the completions
+directory:
+
+	` + command.CommandName + ` completion fish > ~/.config/fish/completions/` + command.CommandName + `.fish
+
+The script must be generated again after updating ` + command.CommandName + ` as it contains the
+commands and flags of the installed version.`,
+		Flag:     command.DefaultFlagSet("completion"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: func(_ *command.Env, args []string, _ string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+
+			return shellNames()
+		},
+		Hidden: false,
+	}
+
+	return c
+}
+
+// CompleteCommand returns the hidden command that the completion scripts call
+// to complete the arguments for the command tree of root.
+//
+// The command takes the words on the command line after the program name and
+// before the word that is completed, followed by the word that is completed.
+// The scripts must pass "--" before the words so that they are not parsed as
+// flags. The command prints the candidates one per line.
+func CompleteCommand(root *command.Command) *command.Command {
+	c := &command.Command{
+		Run: func(env *command.Env, _ *command.Command, args []string) int {
+			if len(args) == 0 {
+				return command.ExitInvalidArgs
+			}
+
+			for _, s := range complete(env, root, args[:len(args)-1], args[len(args)-1]) {
+				fmt.Fprintln(env.Stdout, s)
+			}
+
+			return command.ExitSuccess
+		},
+		UsageLine: command.CommandName + " " + completeCmdName + " [args] toComplete",
+		Short:     "prints the completion candidates",
+		Long:      "",
+		Flag:      command.DefaultFlagSet(completeCmdName),
+		Aliases:   nil,
+		Commands:  nil,
+		Complete:  nil,
+		Hidden:    true,
+	}
+
+	return c
+}
+
+func runCompletion(env *command.Env, cmd *command.Command, args []string, root *command.Command) int {
+	if len(args) != 1 {
+		return env.UsageError(cmd)
+	}
+
+	write, ok := shells[args[0]]
+	if !ok {
+		return env.Errorf(command.ExitInvalidArgs, "Unsupported shell %q, the supported shells are %s", args[0], strings.Join(shellNames(), ", "))
+	}
+
+	if err := write(env.Stdout, root); err != nil {
+		return env.Errorf(command.ExitFailure, "Error writing the completion script: %v", err)
+	}
+
+	return command.ExitSuccess
+}
+
+// complete returns the completion candidates for toComplete when the words
+// before it on the command line are args.
+// It resolves the command the same way as the main package and falls back to
+// the dynamic completions of the command for its positional arguments.
+func complete(env *command.Env, root *command.Command, args []string, toComplete string) []string {
+	var (
+		cmd        = root
+		positional []string
+		value      bool
+	)
+
+	for _, arg := range args {
+		switch {
+		case value:
+			value = false
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			value = takesValue(cmd, arg)
+		default:
+			if sub := subcommand(cmd, arg); sub != nil && len(positional) == 0 {
+				cmd = sub
+
+				continue
+			}
+
+			positional = append(positional, arg)
+		}
+	}
+
+	// The values of the flags are not completed.
+	if value {
+		return nil
+	}
+
+	var candidates []string
+
+	if strings.HasPrefix(toComplete, "-") {
+		candidates = flagNames(cmd)
+	} else {
+		if len(positional) == 0 {
+			candidates = subcommandNames(cmd)
+		}
+
+		if cmd.Complete != nil {
+			candidates = append(candidates, cmd.Complete(env, positional, toComplete)...)
+		}
+	}
+
+	result := candidates[:0]
+
+	for _, c := range candidates {
+		if strings.HasPrefix(c, toComplete) {
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+// subcommand returns the visible subcommand of cmd with the given name, or nil
+// if there is no such subcommand.
+func subcommand(cmd *command.Command, name string) *command.Command {
+	sub := cmd.Lookup(name)
+	if sub == nil || sub.Hidden {
+		return nil
+	}
+
+	return sub
+}
+
+// subcommandNames returns the names of the visible subcommands of cmd.
+func subcommandNames(cmd *command.Command) []string {
+	var names []string
+
+	for _, sub := range cmd.Commands {
+		if subcommand(cmd, sub.Name()) != nil {
+			names = append(names, sub.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// subcommandAliases returns the pairs of the names and aliases of the visible
+// subcommands of cmd and the names of the subcommands they refer to.
+func subcommandAliases(cmd *command.Command) [][2]string {
+	var names [][2]string
+
+	for _, name := range subcommandNames(cmd) {
+		names = append(names, [2]string{name, name})
+
+		for _, alias := range subcommand(cmd, name).Aliases {
+			names = append(names, [2]string{alias, name})
+		}
+	}
+
+	return names
+}
+
+// flagNames returns the flags of cmd with a leading dash.
+func flagNames(cmd *command.Command) []string {
+	return collectFlags(cmd, false)
+}
+
+// valueFlagNames returns the flags of cmd that take a value with a leading
+// dash.
+func valueFlagNames(cmd *command.Command) []string {
+	return collectFlags(cmd, true)
+}
+
+func collectFlags(cmd *command.Command, onlyValues bool) []string {
+	if cmd.Flag == nil {
+		return nil
+	}
+
+	var names []string
+
+	// VisitAll visits the flags in lexicographical order.
+	cmd.Flag.VisitAll(func(f *flag.Flag) {
+		if !onlyValues || !isBoolFlag(f) {
+			names = append(names, "-"+f.Name)
+		}
+	})
+
+	return names
+}
+
+// takesValue reports whether the flag arg of cmd consumes the next argument as
+// its value.
+func takesValue(cmd *command.Command, arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	if cmd.Flag == nil || strings.Contains(name, "=") {
+		return false
+	}
+
+	f := cmd.Flag.Lookup(name)
+
+	return f != nil && !isBoolFlag(f)
+}
+
+// isBoolFlag reports whether the flag f does not need a value, in the same way
+// as the flag package.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+
+	return ok && b.IsBoolFlag()
+}
+
+// shellNames returns the names of the supported shells in order.
+func shellNames() []string {
+	names := make([]string, 0, len(shells))
+	for name := range shells {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
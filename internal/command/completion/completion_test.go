@@ -0,0 +1,133 @@
+package completion
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+func testTree() *command.Command {
+	run := func(*command.Env, *command.Command, []string) int { return command.ExitSuccess }
+
+	deploy := &command.Command{
+		Run:       run,
+		UsageLine: "ager deploy [-site name] [-dry-run] [release]",
+		Short:     "",
+		Long:      "",
+		Flag:      command.DefaultFlagSet("deploy"),
+		Aliases:   []string{"dp"},
+		Commands:  nil,
+		Complete: func(_ *command.Env, args []string, _ string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+
+			return []string{"r1", "r2", "s1"}
+		},
+		Hidden: false,
+	}
+	deploy.Flag.String("site", "", "")
+	deploy.Flag.Bool("dry-run", false, "")
+
+	site := &command.Command{
+		Run:       nil,
+		UsageLine: "ager site",
+		Short:     "",
+		Long:      "",
+		Flag:      command.DefaultFlagSet("site"),
+		Aliases:   nil,
+		Commands: []*command.Command{
+			{
+				Run: run, UsageLine: "ager site list", Short: "", Long: "",
+				Flag: command.DefaultFlagSet("list"), Aliases: nil, Commands: nil, Complete: nil, Hidden: false,
+			},
+		},
+		Complete: nil,
+		Hidden:   false,
+	}
+
+	root := command.BaseCommand()
+	root.Flag = command.DefaultFlagSet(command.CommandName)
+	root.Commands = []*command.Command{deploy, site, CompleteCommand(root)}
+
+	return root
+}
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args       []string
+		toComplete string
+		want       []string
+	}{
+		{nil, "", []string{"deploy", "site"}},
+		{nil, "d", []string{"deploy"}},
+		{nil, "_", nil},
+		{[]string{"site"}, "", []string{"list"}},
+		{[]string{"deploy"}, "", []string{"r1", "r2", "s1"}},
+		{[]string{"deploy"}, "r", []string{"r1", "r2"}},
+		{[]string{"deploy"}, "-", []string{"-dry-run", "-site"}},
+		{[]string{"deploy", "-site"}, "", nil},
+		{[]string{"dp"}, "-", []string{"-dry-run", "-site"}},
+		{[]string{"deploy", "--site", "a"}, "", []string{"r1", "r2", "s1"}},
+		{[]string{"deploy", "-site=a"}, "s", []string{"s1"}},
+		{[]string{"deploy", "-dry-run"}, "r", []string{"r1", "r2"}},
+		{[]string{"deploy", "r1"}, "", nil},
+		{[]string{"unknown"}, "", nil},
+	}
+
+	root := testTree()
+
+	for _, tt := range tests {
+		got := complete(&command.Env{}, root, tt.args, tt.toComplete) //nolint:exhaustruct
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("complete(%q, %q) = %q, want %q", tt.args, tt.toComplete, got, tt.want)
+		}
+	}
+}
+
+func TestWriteScripts(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range shellNames() {
+		var buf bytes.Buffer
+		if err := shells[name](&buf, testTree()); err != nil {
+			t.Fatalf("writing the %s script failed: %v", name, err)
+		}
+
+		s := buf.String()
+		for _, want := range []string{"'site'", "'deploy'", "-dry-run -site", "'dp'", completeCmdName + " --"} {
+			if !strings.Contains(s, want) {
+				t.Errorf("the %s script does not contain %q", name, want)
+			}
+		}
+
+		if strings.Contains(s, "'"+completeCmdName+"'") {
+			t.Errorf("the %s script contains the hidden command", name)
+		}
+
+		// Check the syntax of the script if the shell is available.
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+
+		args := []string{"-n"}
+		if name == "fish" {
+			args = []string{"--no-execute"}
+		}
+
+		cmd := exec.CommandContext(context.Background(), path, args...)
+		cmd.Stdin = &buf
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("the %s script is invalid: %v\n%s", name, err, out)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package completion
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+// A node is the completion information of a single command in the tree.
+type node struct {
+	// path is the names of the commands from the root to this command
+	// separated by spaces.
+	path string
+
+	commands []string
+	flags    []string
+
+	// names maps the names and aliases of the subcommands to their names.
+	names      [][2]string
+	valueFlags []string
+
+	// dynamic reports whether the arguments of the command are completed by
+	// calling the "__complete" command.
+	dynamic bool
+}
+
+// walk returns the nodes of the visible commands in the tree of root in
+// depth-first order.
+func walk(root *command.Command) []node {
+	var (
+		nodes []node
+		visit func(cmd *command.Command, path string)
+	)
+
+	visit = func(cmd *command.Command, path string) {
+		nodes = append(nodes, node{
+			path:       path,
+			commands:   subcommandNames(cmd),
+			names:      subcommandAliases(cmd),
+			flags:      flagNames(cmd),
+			valueFlags: valueFlagNames(cmd),
+			dynamic:    cmd.Complete != nil,
+		})
+
+		for _, name := range subcommandNames(cmd) {
+			visit(subcommand(cmd, name), strings.TrimSpace(path+" "+name))
+		}
+	}
+
+	visit(root, "")
+
+	return nodes
+}
+
+// writeCaseFunc writes a shell function in the syntax of bash and zsh that
+// prints the words returned by words for the command path given as the first
+// argument of the function.
+func writeCaseFunc(w io.Writer, name string, nodes []node, words func(n node) []string) {
+	fmt.Fprintf(w, "%s() {\n\tcase \"$1\" in\n", name)
+
+	for _, n := range nodes {
+		if ws := words(n); len(ws) > 0 {
+			fmt.Fprintf(w, "\t'%s') echo '%s' ;;\n", n.path, strings.Join(ws, " "))
+		}
+	}
+
+	fmt.Fprint(w, "\tesac\n}\n\n")
+}
+
+// writeDynamicFunc writes a shell function in the syntax of bash and zsh that
+// reports whether the command path given as the first argument has dynamic
+// completions.
+func writeDynamicFunc(w io.Writer, name string, nodes []node) {
+	fmt.Fprintf(w, "%s() {\n\tcase \"$1\" in\n", name)
+
+	for _, n := range nodes {
+		if n.dynamic {
+			fmt.Fprintf(w, "\t'%s') return 0 ;;\n", n.path)
+		}
+	}
+
+	fmt.Fprint(w, "\tesac\n\n\treturn 1\n}\n\n")
+}
+
+// writeResolveFunc writes a shell function in the syntax of bash and zsh that
+// prints the name of the subcommand of the command path given as the first
+// argument for the name or alias given as the second argument.
+// The function fails if there is no such subcommand.
+func writeResolveFunc(w io.Writer, name string, nodes []node) {
+	fmt.Fprintf(w, "%s() {\n\tcase \"${1:+$1 }$2\" in\n", name)
+
+	for _, n := range nodes {
+		for _, a := range n.names {
+			fmt.Fprintf(w, "\t'%s') echo '%s' ;;\n", strings.TrimSpace(n.path+" "+a[0]), a[1])
+		}
+	}
+
+	fmt.Fprint(w, "\t*) return 1 ;;\n\tesac\n}\n\n")
+}
+
+// writeTables writes the functions that describe the command tree in the
+// syntax of bash and zsh.
+func writeTables(w io.Writer, prefix string, nodes []node) {
+	writeCaseFunc(w, prefix+"_commands", nodes, func(n node) []string { return n.commands })
+	writeCaseFunc(w, prefix+"_flags", nodes, func(n node) []string { return n.flags })
+	writeCaseFunc(w, prefix+"_value_flags", nodes, func(n node) []string { return n.valueFlags })
+	writeDynamicFunc(w, prefix+"_dynamic", nodes)
+	writeResolveFunc(w, prefix+"_resolve", nodes)
+}
+
+// functionPrefix returns the prefix of the shell functions in the scripts.
+func functionPrefix() string {
+	return "_" + strings.ReplaceAll(command.CommandName, "-", "_")
+}
+
+// bashParse is the part of the bash and zsh completion functions that resolves
+// the command path from the words before the completed word in the same way as
+// the main package.
+// The first and last indices of the words are substituted in.
+const bashParse = `	local cmdpath="" word sub value=0 positional=0 i
+
+	for ((i = %[2]s; i < %[3]s; i++)); do
+		word="${words[i]}"
+
+		if ((value)); then
+			value=0
+		elif [[ $word == -?* ]]; then
+			word="${word#-}"
+			word="-${word#-}"
+			[[ $word != *=* && " $(%[1]s_value_flags "$cmdpath") " == *" $word "* ]] && value=1
+		elif ((!positional)) && sub="$(%[1]s_resolve "$cmdpath" "$word")"; then
+			cmdpath="${cmdpath:+$cmdpath }$sub"
+		else
+			positional=1
+		fi
+	done
+`
+
+func writeBash(w io.Writer, root *command.Command) error {
+	bw := bufio.NewWriter(w)
+	prefix := functionPrefix()
+	name := command.CommandName
+
+	fmt.Fprintf(bw, "# bash completion for %s\n# Generated by \"%s completion bash\". Do not edit.\n\n", name, name)
+	writeTables(bw, prefix, walk(root))
+	fmt.Fprintf(bw, "%s() {\n", prefix)
+	fmt.Fprint(bw, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" candidates\n\tlocal -a words=(\"${COMP_WORDS[@]}\")\n")
+	fmt.Fprintf(bw, bashParse, prefix, "1", "COMP_CWORD")
+	fmt.Fprintf(bw, `
+	if ((value)); then
+		COMPREPLY=($(compgen -f -- "$cur"))
+
+		return
+	fi
+
+	if [[ $cur == -* ]]; then
+		candidates="$(%[1]s_flags "$cmdpath")"
+	elif %[1]s_dynamic "$cmdpath"; then
+		candidates="$("${words[0]}" %[2]s -- "${words[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null)"
+	elif ((!positional)); then
+		candidates="$(%[1]s_commands "$cmdpath")"
+	fi
+
+	COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+
+	if ((${#COMPREPLY[@]} == 0)) && [[ $cur != -* ]] && ! %[1]s_dynamic "$cmdpath"; then
+		COMPREPLY=($(compgen -f -- "$cur"))
+	fi
+}
+
+complete -o filenames -F %[1]s %[3]s
+`, prefix, completeCmdName, name)
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write the bash script: %w", err)
+	}
+
+	return nil
+}
+
+func writeZsh(w io.Writer, root *command.Command) error {
+	bw := bufio.NewWriter(w)
+	prefix := functionPrefix()
+	name := command.CommandName
+
+	fmt.Fprintf(bw, "#compdef %s\n# zsh completion for %s\n# Generated by \"%s completion zsh\". Do not edit.\n\n", name, name, name)
+	writeTables(bw, prefix, walk(root))
+	fmt.Fprintf(bw, "%s() {\n", prefix)
+	fmt.Fprint(bw, "\tlocal cur=\"${words[CURRENT]}\"\n\tlocal -a candidates\n")
+	fmt.Fprintf(bw, bashParse, prefix, "2", "CURRENT")
+	fmt.Fprintf(bw, `
+	if ((value)); then
+		_files
+
+		return
+	fi
+
+	if [[ $cur == -* ]]; then
+		candidates=(${=$(%[1]s_flags "$cmdpath")})
+	elif %[1]s_dynamic "$cmdpath"; then
+		candidates=(${(f)"$("${words[1]}" %[2]s -- "${(@)words[2,CURRENT-1]}" "$cur" 2>/dev/null)"})
+	elif ((!positional)); then
+		candidates=(${=$(%[1]s_commands "$cmdpath")})
+	fi
+
+	if ((${#candidates})); then
+		compadd -- $candidates
+	elif [[ $cur != -* ]] && ! %[1]s_dynamic "$cmdpath"; then
+		_files
+	fi
+}
+
+if [[ $funcstack[1] == %[1]s ]]; then
+	%[1]s "$@"
+else
+	compdef %[1]s %[3]s
+fi
+`, prefix, completeCmdName, name)
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write the zsh script: %w", err)
+	}
+
+	return nil
+}
+
+// writeFishSwitch writes a fish function that prints the words returned by
+// words for the command path given as the first argument of the function, one
+// per line.
+func writeFishSwitch(w io.Writer, name string, nodes []node, words func(n node) []string) {
+	fmt.Fprintf(w, "function %s\n    switch $argv[1]\n", name)
+
+	for _, n := range nodes {
+		if ws := words(n); len(ws) > 0 {
+			fmt.Fprintf(w, "        case '%s'\n            printf '%%s\\n' %s\n", n.path, strings.Join(ws, " "))
+		}
+	}
+
+	fmt.Fprint(w, "    end\nend\n\n")
+}
+
+func writeFish(w io.Writer, root *command.Command) error {
+	bw := bufio.NewWriter(w)
+	prefix := "_" + functionPrefix()
+	name := command.CommandName
+	nodes := walk(root)
+
+	fmt.Fprintf(bw, "# fish completion for %s\n# Generated by \"%s completion fish\". Do not edit.\n\n", name, name)
+	writeFishSwitch(bw, prefix+"_commands", nodes, func(n node) []string { return n.commands })
+	writeFishSwitch(bw, prefix+"_flags", nodes, func(n node) []string { return n.flags })
+	writeFishSwitch(bw, prefix+"_value_flags", nodes, func(n node) []string { return n.valueFlags })
+	fmt.Fprintf(bw, "function %s_dynamic\n    switch $argv[1]\n", prefix)
+
+	for _, n := range nodes {
+		if n.dynamic {
+			fmt.Fprintf(bw, "        case '%s'\n            return 0\n", n.path)
+		}
+	}
+
+	fmt.Fprint(bw, "    end\n\n    return 1\nend\n\n")
+	fmt.Fprintf(bw, "function %s_resolve\n    switch (string trim -- \"$argv[1] $argv[2]\")\n", prefix)
+
+	for _, n := range nodes {
+		for _, a := range n.names {
+			fmt.Fprintf(bw, "        case '%s'\n            echo '%s'\n", strings.TrimSpace(n.path+" "+a[0]), a[1])
+		}
+	}
+
+	fmt.Fprint(bw, "        case '*'\n            return 1\n    end\nend\n\n")
+	fmt.Fprintf(bw, `function %[1]s
+    set -l tokens (commandline -opc)
+    set -l cur (commandline -ct)
+    set -l cmdpath ''
+    set -l sub
+    set -l value 0
+    set -l positional 0
+
+    for word in $tokens[2..-1]
+        if test $value = 1
+            set value 0
+        else if string match -q -- '-?*' $word
+            set -l flag -(string trim -l -c - -- $word)
+            if not string match -q -- '*=*' $flag; and contains -- $flag (%[1]s_value_flags $cmdpath)
+                set value 1
+            end
+        else if test $positional = 0; and set sub (%[1]s_resolve $cmdpath $word)
+            set cmdpath (string trim -- "$cmdpath $sub")
+        else
+            set positional 1
+        end
+    end
+
+    if test $value = 1
+        __fish_complete_path $cur
+    else if string match -q -- '-*' $cur
+        %[1]s_flags $cmdpath
+    else if %[1]s_dynamic $cmdpath
+        $tokens[1] %[2]s -- $tokens[2..-1] $cur 2>/dev/null
+    else
+        set -l candidates
+        test $positional = 0; and set candidates (%[1]s_commands $cmdpath)
+
+        if test (count $candidates) -gt 0
+            printf '%%s\n' $candidates
+        else
+            __fish_complete_path $cur
+        end
+    end
+end
+
+complete -c %[3]s -f -a '(%[1]s)'
+`, prefix, completeCmdName, name)
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write the fish script: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package config implements the commands for inspecting the configuration.
+package config
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/settings"
+)
+
+// Command returns the config command group for the command tree of root.
+func Command(root *command.Command) *command.Command {
+	return &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " config",
+		Short:     "inspects the configuration",
+		Long: `Config inspects the configuration of ` + command.CommandName + `.
+
+Every flag of every command is a setting that can also be set with an
+environment variable or in a configuration file. The value of a setting is
+taken from the first of the following that has it: the command-line flag, the
+environment variable, the project configuration file, the user configuration
+file, and the default value of the flag.
+
+The key of a setting is the name of the command followed by the name of the
+flag, separated by dots, for example "self-update.index". The environment
+variable is the key in upper case with the dots and dashes replaced by
+underscores and prefixed with "` + settings.EnvPrefix + `", for example ` + settings.EnvName("self-update.index") + `.
+
+The configuration files are JSON objects that nest the settings of each
+command in an object named after the command. The user configuration file is
+"$XDG_CONFIG_HOME/agricola/config.json" or "~/.config/agricola/config.json",
+and the project configuration file is ".agricola/config.json" in the working
+directory or in its closest parent directory that has one.
+
+The settings that choose a program to run or a key to trust, such as
+"self-update.public-key" and "remote.exec.ssh", cannot be set in the project
+configuration file as it comes with the project and is not trusted.`,
+		Flag:     command.DefaultFlagSet("config"),
+		Aliases:  nil,
+		Commands: []*command.Command{showCommand(root)},
+		Complete: nil,
+		Hidden:   false,
+	}
+}
+
+func showCommand(root *command.Command) *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " config show [-origin]",
+		Short:     "prints the resolved settings",
+		Long: `Show prints the resolved value of every setting.
+
+The -origin flag prints where each value came from.`,
+		Flag:     command.DefaultFlagSet("show"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: nil,
+		Hidden:   false,
+	}
+
+	origin := c.Flag.Bool("origin", false, "print the origin of each value")
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runShow(env, cmd, args, root, *origin)
+	}
+
+	return c
+}
+
+func runShow(env *command.Env, cmd *command.Command, args []string, root *command.Command, origin bool) int {
+	if len(args) > 0 {
+		return env.UsageError(cmd)
+	}
+
+	conf, err := settings.Load(env.Dir, env.LookupEnv)
+	if err != nil {
+		return env.Errorf(command.ExitFailure, "Error loading the configuration: %v", err)
+	}
+
+	var values []settings.Value
+
+	for _, c := range commands(root) {
+		v, err := conf.Apply(c.LongName(), c.Flag)
+		if err != nil {
+			return env.Errorf(command.ExitFailure, "Error applying the configuration: %v", err)
+		}
+
+		values = append(values, v...)
+	}
+
+	data := make([]settingData, 0, len(values))
+	for _, v := range values {
+		data = append(data, settingData{
+			Key:    v.Key,
+			Value:  v.Value,
+			Origin: originData{Kind: v.Origin.Kind.String(), Name: v.Origin.Name},
+		})
+	}
+
+	return env.Render("settings", data, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd
+
+		for _, v := range values {
+			if origin {
+				fmt.Fprintf(tw, "%s=%s\t%s\n", v.Key, v.Value, v.Origin)
+			} else {
+				fmt.Fprintf(tw, "%s=%s\n", v.Key, v.Value)
+			}
+		}
+
+		_ = tw.Flush()
+	})
+}
+
+// settingData is a setting in the JSON output of the show command.
+// The origin is always included in the JSON output.
+type settingData struct {
+	Key    string     `json:"key"`
+	Value  string     `json:"value"`
+	Origin originData `json:"origin"`
+}
+
+type originData struct {
+	// Kind is the kind of the source, for example "env" or "project".
+	Kind string `json:"kind"`
+
+	// Name is the environment variable or the configuration file the value
+	// was read from.
+	Name string `json:"name,omitempty"`
+}
+
+// commands returns root and its visible subcommands that have flags in
+// depth-first order.
+func commands(root *command.Command) []*command.Command {
+	var cmds []*command.Command
+
+	if root.Flag != nil {
+		cmds = append(cmds, root)
+	}
+
+	for _, sub := range root.Commands {
+		if !sub.Hidden {
+			cmds = append(cmds, commands(sub)...)
+		}
+	}
+
+	return cmds
+}
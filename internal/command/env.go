@@ -0,0 +1,61 @@
+package command
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+)
+
+// An Env is the environment a command is run in.
+// Commands must use the environment instead of the global process state so
+// that they can be run in-process, for example in tests.
+type Env struct {
+	// Context is canceled when the program receives an interrupt or
+	// a termination signal.
+	// It carries the lifecycle of the program run for registering shutdown and
+	// reload hooks.
+	Context context.Context
+
+	// Stdin, Stdout, and Stderr are the standard streams of the command.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Dir is the working directory of the command.
+	Dir string
+
+	// Output is the output format of the command.
+	// The zero value is the text format.
+	Output Format
+
+	// LookupEnv retrieves the value of the environment variable named by the
+	// key like os.LookupEnv.
+	LookupEnv func(key string) (string, bool)
+
+	// Environ returns the environment variables as "KEY=value" strings like
+	// os.Environ.
+	// It is used for the environment of the processes the command runs.
+	Environ func() []string
+}
+
+// Getenv retrieves the value of the environment variable named by the key.
+// It returns an empty string if the variable is not present.
+func (e *Env) Getenv(key string) string {
+	if e.LookupEnv == nil {
+		return ""
+	}
+
+	v, _ := e.LookupEnv(key)
+
+	return v
+}
+
+// Path returns the given path resolved relative to the working directory of
+// the environment.
+func (e *Env) Path(path string) string {
+	if filepath.IsAbs(path) || e.Dir == "" {
+		return path
+	}
+
+	return filepath.Join(e.Dir, path)
+}
@@ -0,0 +1,240 @@
+// Package gendocs implements the hidden command that generates the reference
+// documentation from the command tree.
+package gendocs
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+const (
+	// manDir and markdownDir are the directories of the man pages and the
+	// Markdown pages in the output directory.
+	manDir      = "man"
+	markdownDir = "reference"
+
+	// manSection is the man page section of the commands.
+	manSection = "1"
+)
+
+// Command returns the hidden gendocs command that generates the documentation
+// for the command tree of root.
+func Command(root *command.Command) *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " gendocs [-dir path]",
+		Short:     "generates the reference documentation",
+		Long: `Gendocs generates the man pages and the Markdown reference pages for every
+command.
+
+The -dir flag sets the output directory and it is required. The man pages are
+written to the "` + manDir + `" directory and the Markdown pages to the "` + markdownDir + `" directory
+in it. The earlier generated pages of the removed commands are deleted, but the
+other files in the directories are kept.`,
+		Flag:     command.DefaultFlagSet("gendocs"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: nil,
+		Hidden:   true,
+	}
+
+	dir := c.Flag.String("dir", "", "the output `path`")
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		if len(args) > 0 {
+			return env.UsageError(cmd)
+		}
+
+		if *dir == "" {
+			return env.Errorf(command.ExitInvalidArgs, "Error: the output directory must be set with the -dir flag")
+		}
+
+		if err := Generate(root, env.Path(*dir)); err != nil {
+			return env.Errorf(command.ExitFailure, "Error generating the documentation: %v", err)
+		}
+
+		return command.ExitSuccess
+	}
+
+	return c
+}
+
+// Generate writes the man pages and the Markdown pages for root and all of its
+// visible subcommands to dir.
+// It removes the previously generated pages of the commands that no longer
+// exist, and only those, so that the other files in dir are kept.
+func Generate(root *command.Command, dir string) error {
+	pages := map[string]func(io.Writer, *command.Command){
+		manDir:      WriteMan,
+		markdownDir: WriteMarkdown,
+	}
+
+	for sub, write := range pages {
+		outDir := filepath.Join(dir, sub)
+
+		if err := os.MkdirAll(outDir, 0o755); err != nil { //nolint:mnd
+			return fmt.Errorf("failed to create the output directory: %w", err)
+		}
+
+		written := make(map[string]bool)
+
+		for _, cmd := range Commands(root) {
+			name := pageName(cmd, sub)
+			if err := writePage(filepath.Join(outDir, name), cmd, write); err != nil {
+				return err
+			}
+
+			written[name] = true
+		}
+
+		if err := removeStale(outDir, sub, written); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeStale removes the pages in the page directory outDir of the kind sub
+// that look like generated pages but were not written in this run.
+func removeStale(outDir, sub string, written map[string]bool) error {
+	ext := ".md"
+	if sub == manDir {
+		ext = "." + manSection
+	}
+
+	stale, err := filepath.Glob(filepath.Join(outDir, command.CommandName+"*"+ext))
+	if err != nil {
+		return fmt.Errorf("failed to find the old pages: %w", err)
+	}
+
+	for _, path := range stale {
+		name := filepath.Base(path)
+		if written[name] || (name != command.CommandName+ext && !strings.HasPrefix(name, command.CommandName+"-")) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove the old page: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func writePage(path string, cmd *command.Command, write func(io.Writer, *command.Command)) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create the page: %w", err)
+	}
+
+	defer func() {
+		if cerr := f.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close the page: %w", cerr))
+		}
+	}()
+
+	write(f, cmd)
+
+	return nil
+}
+
+// Commands returns root and its visible subcommands in depth-first order.
+// The commands that are neither runnable nor have subcommands are left out as
+// they are only help topics.
+func Commands(root *command.Command) []*command.Command {
+	cmds := []*command.Command{root}
+
+	for _, sub := range root.Commands {
+		if sub.Hidden || (!sub.Runnable() && len(sub.Commands) == 0) {
+			continue
+		}
+
+		cmds = append(cmds, Commands(sub)...)
+	}
+
+	return cmds
+}
+
+// pageName returns the file name of the page of cmd in the given directory.
+func pageName(cmd *command.Command, dir string) string {
+	name := baseName(cmd)
+
+	if dir == manDir {
+		return name + "." + manSection
+	}
+
+	return name + ".md"
+}
+
+// baseName returns the name of the page of cmd without the extension, for
+// example "ager-version-bump".
+func baseName(cmd *command.Command) string {
+	return strings.Join(append([]string{command.CommandName}, strings.Fields(cmd.LongName())...), "-")
+}
+
+// fullName returns the full name of cmd, for example "ager version bump".
+func fullName(cmd *command.Command) string {
+	return strings.TrimSpace(command.CommandName + " " + cmd.LongName())
+}
+
+// parent returns the full name of the parent command of cmd or an empty string
+// for the base command.
+func parent(cmd *command.Command) string {
+	name := fullName(cmd)
+	if i := strings.LastIndex(name, " "); i >= 0 {
+		return name[:i]
+	}
+
+	return ""
+}
+
+// visibleCommands returns the visible subcommands of cmd.
+func visibleCommands(cmd *command.Command) []*command.Command {
+	var cmds []*command.Command
+
+	for _, sub := range cmd.Commands {
+		if !sub.Hidden && (sub.Runnable() || len(sub.Commands) > 0) {
+			cmds = append(cmds, sub)
+		}
+	}
+
+	return cmds
+}
+
+// A flagDoc is the documentation of a single flag.
+type flagDoc struct {
+	name  string
+	arg   string
+	usage string
+	def   string
+}
+
+// flags returns the documentation of the flags of cmd in lexicographical order.
+func flags(cmd *command.Command) []flagDoc {
+	if cmd.Flag == nil {
+		return nil
+	}
+
+	var docs []flagDoc
+
+	cmd.Flag.VisitAll(func(f *flag.Flag) {
+		arg, usage := flag.UnquoteUsage(f)
+
+		def := f.DefValue
+		if def == "false" || def == "0" {
+			def = ""
+		}
+
+		docs = append(docs, flagDoc{name: f.Name, arg: arg, usage: usage, def: def})
+	})
+
+	return docs
+}
@@ -0,0 +1,128 @@
+package gendocs_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/command/gendocs"
+)
+
+func testCommand() *command.Command {
+	c := &command.Command{
+		Run:       func(*command.Env, *command.Command, []string) int { return command.ExitSuccess },
+		UsageLine: "ager apply [-dry-run] [-site name]",
+		Short:     "applies the manifest",
+		Long: `Apply applies the manifest.
+.dotfile is not a request.
+
+	ager apply -site example.com`,
+		Flag:     command.DefaultFlagSet("apply"),
+		Aliases:  []string{"up"},
+		Commands: nil,
+		Complete: nil,
+		Hidden:   false,
+	}
+	c.Flag.Bool("dry-run", false, "only print the changes")
+	c.Flag.String("site", "all", "apply only the `name` site")
+
+	return c
+}
+
+func TestWriteMan(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	gendocs.WriteMan(&buf, testCommand())
+
+	for _, want := range []string{
+		".TH AGER-APPLY 1 ",
+		"ager\\-apply \\- applies the manifest\n",
+		"\\&.dotfile is not a request.\n",
+		".RS 4\n.nf\nager apply \\-site example.com\n.fi\n.RE\n",
+		".B \\-dry\\-run\nonly print the changes\n",
+		".BI \\-site \" name\"\napply only the name site (default \"all\")\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteMan() does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	gendocs.WriteMarkdown(&buf, testCommand())
+
+	for _, want := range []string{
+		"# ager apply\n\nApplies the manifest.\n",
+		"Aliases: `up`\n",
+		"```\nager apply -site example.com\n```\n",
+		"- `-dry-run`: only print the changes\n",
+		"- `-site name`: apply only the name site (default `all`)\n",
+		"- [ager](ager.md)\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteMarkdown() does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestCommandsSkipsHidden(t *testing.T) {
+	t.Parallel()
+
+	hidden := testCommand()
+	hidden.Hidden = true
+
+	root := command.BaseCommand()
+	root.Commands = []*command.Command{testCommand(), hidden}
+
+	if got := len(gendocs.Commands(root)); got != 2 { //nolint:mnd
+		t.Errorf("len(Commands()) = %d, want 2", got)
+	}
+}
+
+func TestGenerateKeepsOtherFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	other := filepath.Join(dir, "man", "notes.1")
+	stale := filepath.Join(dir, "reference", "ager-removed.md")
+
+	for _, path := range []string{other, stale} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := command.BaseCommand()
+	root.Commands = []*command.Command{testCommand()}
+
+	if err := gendocs.Generate(root, dir); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Generate removed an unrelated file: %v", err)
+	}
+
+	if _, err := os.Stat(stale); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(%q) = %v, want the stale page to be removed", stale, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "reference", "ager-apply.md")); err != nil {
+		t.Errorf("Generate did not write the page: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package gendocs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+// WriteMan writes the roff man page of cmd to w.
+func WriteMan(w io.Writer, cmd *command.Command) {
+	name := baseName(cmd)
+
+	fmt.Fprintf(w, ".TH %s %s \"\" \"%s\" \"%s Manual\"\n", strings.ToUpper(name), manSection, command.Name, command.Name)
+	fmt.Fprintln(w, ".SH NAME")
+
+	if cmd.Short != "" {
+		fmt.Fprintf(w, "%s \\- %s\n", roffEscape(name), roffEscape(cmd.Short))
+	} else {
+		fmt.Fprintln(w, roffEscape(name))
+	}
+
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, ".nf")
+	fmt.Fprintln(w, roffLine(cmd.UsageLine))
+	fmt.Fprintln(w, ".fi")
+
+	if cmd.Long != "" {
+		fmt.Fprintln(w, ".SH DESCRIPTION")
+		writeRoffText(w, cmd.Long)
+	}
+
+	if docs := flags(cmd); len(docs) > 0 {
+		fmt.Fprintln(w, ".SH OPTIONS")
+
+		for _, f := range docs {
+			fmt.Fprintln(w, ".TP")
+
+			if f.arg != "" {
+				fmt.Fprintf(w, ".BI %s \" %s\"\n", roffEscape("-"+f.name), roffEscape(f.arg))
+			} else {
+				fmt.Fprintf(w, ".B %s\n", roffEscape("-"+f.name))
+			}
+
+			usage := f.usage
+			if f.def != "" {
+				usage += fmt.Sprintf(" (default %q)", f.def)
+			}
+
+			fmt.Fprintln(w, roffLine(usage))
+		}
+	}
+
+	if subs := visibleCommands(cmd); len(subs) > 0 {
+		fmt.Fprintln(w, ".SH COMMANDS")
+
+		for _, sub := range subs {
+			fmt.Fprintln(w, ".TP")
+			fmt.Fprintf(w, ".B %s\n", roffEscape(sub.Name()))
+
+			if len(sub.Aliases) > 0 {
+				fmt.Fprintf(w, "(aliases: %s)\n", roffEscape(strings.Join(sub.Aliases, ", ")))
+			}
+
+			fmt.Fprintln(w, roffLine(sub.Short))
+		}
+	}
+
+	var seeAlso []string
+
+	if p := parent(cmd); p != "" {
+		seeAlso = append(seeAlso, strings.ReplaceAll(p, " ", "-"))
+	}
+
+	for _, sub := range visibleCommands(cmd) {
+		seeAlso = append(seeAlso, baseName(sub))
+	}
+
+	if len(seeAlso) > 0 {
+		fmt.Fprintln(w, ".SH SEE ALSO")
+
+		for i, s := range seeAlso {
+			sep := ","
+			if i == len(seeAlso)-1 {
+				sep = ""
+			}
+
+			fmt.Fprintf(w, ".BR %s (%s)%s\n", roffEscape(s), manSection, sep)
+		}
+	}
+}
+
+// writeRoffText writes the plain text s as roff.
+// The paragraphs are separated by empty lines, and the lines indented with
+// a tab are written as indented literal blocks.
+func writeRoffText(w io.Writer, s string) {
+	var literal, paragraph bool
+
+	for _, line := range strings.Split(s, "\n") {
+		if literal && !strings.HasPrefix(line, "\t") {
+			fmt.Fprintln(w, ".fi")
+			fmt.Fprintln(w, ".RE")
+
+			literal = false
+		}
+
+		switch {
+		case line == "":
+			paragraph = false
+		case strings.HasPrefix(line, "\t"):
+			if !literal {
+				fmt.Fprintln(w, ".PP")
+				fmt.Fprintln(w, ".RS 4")
+				fmt.Fprintln(w, ".nf")
+
+				literal = true
+			}
+
+			fmt.Fprintln(w, roffLine(strings.TrimPrefix(line, "\t")))
+		default:
+			if !paragraph {
+				fmt.Fprintln(w, ".PP")
+
+				paragraph = true
+			}
+
+			fmt.Fprintln(w, roffLine(line))
+		}
+	}
+
+	if literal {
+		fmt.Fprintln(w, ".fi")
+		fmt.Fprintln(w, ".RE")
+	}
+}
+
+// roffLine escapes s and protects it from being read as a roff request.
+func roffLine(s string) string {
+	s = roffEscape(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = "\\&" + s
+	}
+
+	return s
+}
+
+// roffEscape escapes the backslashes and the dashes in s.
+func roffEscape(s string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+}
@@ -0,0 +1,97 @@
+package gendocs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+// WriteMarkdown writes the Markdown reference page of cmd to w.
+func WriteMarkdown(w io.Writer, cmd *command.Command) {
+	fmt.Fprintf(w, "# %s\n\n", fullName(cmd))
+
+	if cmd.Short != "" {
+		fmt.Fprintf(w, "%s\n\n", capitalize(cmd.Short))
+	}
+
+	fmt.Fprintf(w, "## Usage\n\n```\n%s\n```\n", cmd.UsageLine)
+
+	if len(cmd.Aliases) > 0 {
+		fmt.Fprintf(w, "\nAliases: %s\n", "`"+strings.Join(cmd.Aliases, "`, `")+"`")
+	}
+
+	if cmd.Long != "" {
+		fmt.Fprintf(w, "\n## Description\n\n")
+		writeMarkdownText(w, cmd.Long)
+	}
+
+	if docs := flags(cmd); len(docs) > 0 {
+		fmt.Fprintf(w, "\n## Flags\n\n")
+
+		for _, f := range docs {
+			name := "-" + f.name
+			if f.arg != "" {
+				name += " " + f.arg
+			}
+
+			fmt.Fprintf(w, "- `%s`: %s", name, f.usage)
+
+			if f.def != "" {
+				fmt.Fprintf(w, " (default `%s`)", f.def)
+			}
+
+			fmt.Fprintln(w)
+		}
+	}
+
+	if subs := visibleCommands(cmd); len(subs) > 0 {
+		fmt.Fprintf(w, "\n## Commands\n\n")
+
+		for _, sub := range subs {
+			fmt.Fprintf(w, "- [%s](%s.md): %s\n", fullName(sub), baseName(sub), sub.Short)
+		}
+	}
+
+	if p := parent(cmd); p != "" {
+		fmt.Fprintf(w, "\n## See also\n\n- [%s](%s.md)\n", p, strings.ReplaceAll(p, " ", "-"))
+	}
+}
+
+// writeMarkdownText writes the plain text s as Markdown.
+// The lines indented with a tab are written as fenced code blocks.
+func writeMarkdownText(w io.Writer, s string) {
+	code := false
+
+	for _, line := range strings.Split(s, "\n") {
+		isCode := strings.HasPrefix(line, "\t")
+
+		switch {
+		case isCode && !code:
+			fmt.Fprintln(w, "```")
+
+			code = true
+		case !isCode && code:
+			fmt.Fprintln(w, "```")
+
+			code = false
+		}
+
+		fmt.Fprintln(w, strings.TrimPrefix(line, "\t"))
+	}
+
+	if code {
+		fmt.Fprintln(w, "```")
+	}
+}
+
+// capitalize returns s with its first letter in upper case and a period at the
+// end, turning a short description of a command into a sentence.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
@@ -1,25 +1,115 @@
+// Package help implements the "help" command.
 package help
 
 import (
 	"fmt"
-	"os"
+	"io"
+	"strings"
 
 	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/plugin"
 )
 
 // Help implements the 'help' command.
-func Help(_ []string) int {
-	return 0
+// It writes the help for the command named by args in the command tree of root
+// to w. Without args, it writes the usage of root and lists the given plugins.
+func Help(w io.Writer, root *command.Command, plugins []plugin.Plugin, args []string) int {
+	if len(args) == 0 {
+		PrintUsage(w, root)
+		printPlugins(w, plugins)
+
+		return command.ExitSuccess
+	}
+
+	cmd := root
+
+	for i, arg := range args {
+		sub := cmd.Lookup(arg)
+		if sub == nil {
+			fmt.Fprintf(w, "%s help %s: unknown help topic. Run '%s help%s'.\n",
+				command.CommandName, strings.Join(args[:i+1], " "), command.CommandName, helpArg(args[:i]))
+
+			return command.ExitInvalidArgs
+		}
+
+		cmd = sub
+	}
+
+	if len(cmd.Commands) > 0 {
+		PrintUsage(w, cmd)
+
+		return command.ExitSuccess
+	}
+
+	if cmd.Runnable() {
+		fmt.Fprintf(w, "usage: %s\n\n", cmd.UsageLine)
+	}
+
+	fmt.Fprintln(w, strings.TrimSpace(cmd.Long))
+
+	return command.ExitSuccess
+}
+
+// PrintUsage prints the usage for the given command to w.
+// The command must be the base command or a command with subcommands.
+func PrintUsage(w io.Writer, cmd *command.Command) {
+	if cmd.Long != "" {
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(cmd.Long))
+	}
+
+	name := strings.TrimSpace(command.CommandName + " " + cmd.LongName())
+
+	fmt.Fprintf(w, "Usage:\n\n\t%s <command> [arguments]\n\nThe commands are:\n\n", name)
+
+	var rows [][2]string
+
+	for _, sub := range cmd.Commands {
+		if !sub.Hidden && (sub.Runnable() || len(sub.Commands) > 0) {
+			rows = append(rows, [2]string{sub.Name(), sub.Short})
+		}
+	}
+
+	printRows(w, rows)
+
+	fmt.Fprintf(w, "\nUse \"%s help%s <command>\" for more information about a command.\n",
+		command.CommandName, helpArg(strings.Fields(cmd.LongName())))
 }
 
-// PrintUsage prints the usage for the given command to the user interface.
-func PrintUsage(_ *command.Command) {
-	fmt.Fprintln(os.Stderr, "TODO: Implement.")
+// printPlugins lists the plugins to w.
+func printPlugins(w io.Writer, plugins []plugin.Plugin) {
+	if len(plugins) == 0 {
+		return
+	}
+
+	fmt.Fprint(w, "\nThe plugins found on PATH are:\n\n")
+
+	rows := make([][2]string, 0, len(plugins))
+	for _, p := range plugins {
+		rows = append(rows, [2]string{p.Name, p.Path})
+	}
+
+	printRows(w, rows)
+}
+
+// printRows prints the rows of names and descriptions to w as an indented list
+// with the descriptions aligned.
+func printRows(w io.Writer, rows [][2]string) {
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r[0]))
+	}
+
+	for _, r := range rows {
+		fmt.Fprintf(w, "\t%-*s  %s\n", width, r[0], r[1])
+	}
 }
 
-// outputTemplate writes the given template text with the data from command cmd
-// to the command's output.
-// func outputTemplate(text string, _ *command.Command) {
-// 	t := template.New("top")
-// 	template.Must(t.Parse(text))
-// }
+// helpArg returns the names of the commands as the argument of the help
+// command with a leading space.
+func helpArg(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	return " " + strings.Join(names, " ")
+}
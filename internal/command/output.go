@@ -0,0 +1,148 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SchemaVersion is the version of the schema of the JSON output.
+// It must be incremented when the JSON output changes in a way that is not
+// backwards compatible.
+const SchemaVersion = 1
+
+// A Format is an output format of the commands.
+type Format string
+
+const (
+	// FormatText is the human-readable output.
+	FormatText Format = "text"
+
+	// FormatJSON is the machine-readable output for scripts.
+	FormatJSON Format = "json"
+)
+
+// String returns the name of the format.
+func (f *Format) String() string {
+	if f == nil || *f == "" {
+		return string(FormatText)
+	}
+
+	return string(*f)
+}
+
+// Set sets the format from its name.
+// It implements flag.Value.
+func (f *Format) Set(s string) error {
+	switch Format(s) {
+	case FormatText, FormatJSON:
+		*f = Format(s)
+
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, the supported formats are %q and %q", s, FormatText, FormatJSON) //nolint:err113,lll
+	}
+}
+
+// An envelope is the top-level object of the JSON output.
+type envelope struct {
+	SchemaVersion int          `json:"schema_version"`
+	Kind          string       `json:"kind,omitempty"`
+	Data          any          `json:"data,omitempty"`
+	Error         *ErrorObject `json:"error,omitempty"`
+}
+
+// ErrorObject is an error in the JSON output.
+type ErrorObject struct {
+	// Code is the exit code of the program for the error.
+	Code int `json:"code"`
+
+	// Name is the name of the exit code, for example "invalid_args".
+	Name string `json:"name"`
+
+	// Message is the human-readable error message.
+	Message string `json:"message"`
+}
+
+// ExitCodeName returns the name of the exit code for the JSON output.
+func ExitCodeName(code int) string {
+	switch code {
+	case ExitSuccess:
+		return "success"
+	case ExitFailure:
+		return "failure"
+	case ExitInvalidArgs:
+		return "invalid_args"
+	case ExitIncompatibleVersion:
+		return "incompatible_version"
+	case ExitCommandNotFound:
+		return "command_not_found"
+	case ExitInterrupted:
+		return "interrupted"
+	default:
+		return "unknown"
+	}
+}
+
+// Render writes the result of a command to the standard output.
+// In the JSON format, data is encoded in the output object with the given kind
+// that names the type of data, for example "version". Otherwise text is called
+// to write the human-readable output.
+// Render returns the exit code of the command.
+func (e *Env) Render(kind string, data any, text func(w io.Writer)) int {
+	if e.Output != FormatJSON {
+		text(e.Stdout)
+
+		return ExitSuccess
+	}
+
+	if err := writeJSON(e.Stdout, envelope{SchemaVersion: SchemaVersion, Kind: kind, Data: data, Error: nil}); err != nil {
+		return e.Errorf(ExitFailure, "Error writing the output: %v", err)
+	}
+
+	return ExitSuccess
+}
+
+// Errorf reports an error with the given exit code and returns the code.
+// In the text format, the message is written to the standard error. In the
+// JSON format, the error is written to the standard output as an object so
+// that it can be read from the same stream as the results.
+func (e *Env) Errorf(code int, format string, args ...any) int {
+	msg := fmt.Sprintf(format, args...)
+
+	if e.Output != FormatJSON {
+		fmt.Fprintln(e.Stderr, msg)
+
+		return code
+	}
+
+	obj := &ErrorObject{Code: code, Name: ExitCodeName(code), Message: msg}
+	if err := writeJSON(e.Stdout, envelope{SchemaVersion: SchemaVersion, Kind: "", Data: nil, Error: obj}); err != nil {
+		fmt.Fprintln(e.Stderr, msg)
+	}
+
+	return code
+}
+
+// UsageError reports that the command cmd was called with invalid arguments
+// and returns ExitInvalidArgs.
+func (e *Env) UsageError(cmd *Command) int {
+	if e.Output != FormatJSON {
+		cmd.Usage(e.Stderr)
+
+		return ExitInvalidArgs
+	}
+
+	return e.Errorf(ExitInvalidArgs, "invalid arguments, usage: %s", cmd.UsageLine)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode the output: %w", err)
+	}
+
+	return nil
+}
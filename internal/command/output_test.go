@@ -0,0 +1,84 @@
+package command_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+func TestFormatSet(t *testing.T) {
+	t.Parallel()
+
+	var f command.Format
+
+	if f.String() != "text" {
+		t.Errorf("zero Format.String() = %q, want %q", f.String(), "text")
+	}
+
+	if err := f.Set("json"); err != nil || f != command.FormatJSON {
+		t.Errorf("Set(%q) = %v, format %q", "json", err, f)
+	}
+
+	if err := f.Set("yaml"); err == nil {
+		t.Errorf("Set(%q) succeeded", "yaml")
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	t.Parallel()
+
+	var stdout, stderr bytes.Buffer
+
+	env := &command.Env{Stdout: &stdout, Stderr: &stderr, Output: command.FormatJSON} //nolint:exhaustruct
+
+	code := env.Render("test", map[string]int{"n": 1}, func(w io.Writer) { io.WriteString(w, "text") }) //nolint:errcheck
+	if code != command.ExitSuccess {
+		t.Errorf("Render() = %d, want %d", code, command.ExitSuccess)
+	}
+
+	var got struct {
+		SchemaVersion int            `json:"schema_version"`
+		Kind          string         `json:"kind"`
+		Data          map[string]int `json:"data"`
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout.String(), err)
+	}
+
+	if got.SchemaVersion != command.SchemaVersion || got.Kind != "test" || got.Data["n"] != 1 {
+		t.Errorf("Render() wrote %+v", got)
+	}
+}
+
+func TestErrorfJSON(t *testing.T) {
+	t.Parallel()
+
+	var stdout, stderr bytes.Buffer
+
+	env := &command.Env{Stdout: &stdout, Stderr: &stderr, Output: command.FormatJSON} //nolint:exhaustruct
+
+	if code := env.Errorf(command.ExitCommandNotFound, "no %s", "command"); code != command.ExitCommandNotFound {
+		t.Errorf("Errorf() = %d, want %d", code, command.ExitCommandNotFound)
+	}
+
+	var got struct {
+		Error command.ErrorObject `json:"error"`
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout.String(), err)
+	}
+
+	want := command.ErrorObject{Code: command.ExitCommandNotFound, Name: "command_not_found", Message: "no command"}
+	if got.Error != want {
+		t.Errorf("Errorf() wrote %+v, want %+v", got.Error, want)
+	}
+
+	if stderr.Len() > 0 {
+		t.Errorf("Errorf() wrote to stderr: %q", stderr.String())
+	}
+}
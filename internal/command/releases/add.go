@@ -0,0 +1,173 @@
+package releases
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/release"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/settings"
+	"github.com/anttikivi/agricola/internal/state"
+)
+
+// idLayout is the layout of the default IDs of the releases.
+const idLayout = "20060102T150405Z"
+
+func addCommand(ver semver.Version, statePath StatePathFunc) *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " releases add [-id id] [-link path] [-keep n] site dir",
+		Short:     "deploys a directory as the new release of a static site",
+		Long: `Add deploys the directory dir as the newest release of the static site. The
+release is recorded in the state file, and the link of the site is switched to
+the directory with the same atomic switch as in "` + command.CommandName + ` rollback", so the site is
+served without interruption.
+
+The -id flag sets the ID of the release. By default, it is the current time in
+UTC, for example "20261019T120000Z".
+
+The -link flag sets the path of the symbolic link that the web server serves
+the site from. It is required when the first release of the site is added.
+
+The -keep flag sets the number of the releases that are kept for the site. The
+older releases are removed from the state, and their directories are printed so
+that they can be removed.`,
+		Flag:     command.DefaultFlagSet("add"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: func(env *command.Env, args []string, _ string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+
+			return siteNames(env, ver, statePath)
+		},
+		Hidden: false,
+	}
+
+	opts := &addFlags{
+		id:   c.Flag.String("id", "", "the `id` of the release"),
+		link: c.Flag.String("link", "", "the `path` of the link to the active release"),
+		keep: c.Flag.Int("keep", state.DefaultKeep, "the number `n` of the releases to keep"),
+	}
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runAdd(env, cmd, args, ver, statePath, opts)
+	}
+
+	return c
+}
+
+// addFlags are the flags of the add command.
+type addFlags struct {
+	id   *string
+	link *string
+	keep *int
+}
+
+// addData is the JSON output of the add command.
+type addData struct {
+	Site    string `json:"site"`
+	Release string `json:"release"`
+	Path    string `json:"path"`
+
+	// Removed are the releases that are no longer kept.
+	Removed []state.Release `json:"removed"`
+}
+
+func runAdd(env *command.Env, cmd *command.Command, args []string, ver semver.Version, statePath StatePathFunc, opts *addFlags) int { //nolint:lll
+	if len(args) != 2 { //nolint:mnd
+		return env.UsageError(cmd)
+	}
+
+	s, code := loadState(env, ver, statePath)
+	if s == nil {
+		return code
+	}
+
+	name := args[0]
+	projectDir := settings.ProjectDir(env.Dir)
+
+	site, ok := s.Sites[name]
+	if ok && site.Kind != state.KindStatic {
+		return env.Errorf(command.ExitFailure, "Error: %s is not a static site", name)
+	}
+
+	if !ok && *opts.link == "" {
+		return env.Errorf(command.ExitInvalidArgs, "Error: the first release of %s requires the -link flag", name)
+	}
+
+	id := *opts.id
+	if id == "" {
+		id = time.Now().UTC().Format(idLayout)
+	}
+
+	if ok {
+		if _, exists := site.Release(id); exists {
+			return env.Errorf(command.ExitFailure, "Error: %s already has the release %q", name, id)
+		}
+	}
+
+	var previous *state.Site
+	if ok {
+		copied := *site
+		previous = &copied
+	}
+
+	r := state.Release{
+		ID:        id,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Path:      projectPath(projectDir, env.Path(args[1])),
+		Image:     "",
+		Digest:    "",
+		Config:    nil,
+	}
+
+	removed := s.AddRelease(name, state.KindStatic, r, *opts.keep)
+	site = s.Sites[name]
+
+	if *opts.link != "" {
+		site.Link = projectPath(projectDir, env.Path(*opts.link))
+	}
+
+	if err := release.Activate(site, r, projectDir); err != nil {
+		return env.Errorf(command.ExitFailure, "Error releasing %s: %v", name, err)
+	}
+
+	if err := state.Save(statePath(env), s, ver); err != nil {
+		// Switch back so that the served release still matches the state.
+		if previous != nil {
+			switchBack(name, previous, previous.Current, projectDir)
+		}
+
+		return stateError(env, err)
+	}
+
+	data := addData{Site: name, Release: r.ID, Path: r.Path, Removed: removed}
+	if data.Removed == nil {
+		data.Removed = []state.Release{}
+	}
+
+	return env.Render("releases-add", data, func(w io.Writer) {
+		fmt.Fprintf(w, "Released %s %s from %s\n", data.Site, data.Release, data.Path)
+
+		for _, old := range data.Removed {
+			fmt.Fprintf(w, "No longer kept: %s\t%s\n", old.ID, describe(old))
+		}
+	})
+}
+
+// projectPath returns path relative to projectDir if it is in the project
+// directory, and otherwise the absolute path, in the form stored in the state.
+func projectPath(projectDir, path string) string {
+	rel, err := filepath.Rel(projectDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,184 @@
+// Package releases implements the commands for listing the releases of the
+// deployed sites and rolling back to them.
+package releases
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/compat"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/state"
+)
+
+// A StatePathFunc returns the path of the state file in env.
+type StatePathFunc func(env *command.Env) string
+
+// Command returns the releases command group.
+func Command(ver semver.Version, statePath StatePathFunc) *command.Command {
+	return &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " releases",
+		Short:     "deploys and inspects the releases of the sites",
+		Long: `Releases deploys and inspects the releases of the static sites.
+
+The state file keeps the ` + fmt.Sprint(state.DefaultKeep) + ` newest release directories of each site. Use
+"` + command.CommandName + ` releases add" to deploy a new release and "` + command.CommandName + ` rollback" to switch back to
+one of the kept releases.`,
+		Flag:     command.DefaultFlagSet("releases"),
+		Aliases:  nil,
+		Commands: []*command.Command{addCommand(ver, statePath), listCommand(ver, statePath)},
+		Complete: nil,
+		Hidden:   false,
+	}
+}
+
+func listCommand(ver semver.Version, statePath StatePathFunc) *command.Command {
+	return &command.Command{
+		Run: func(env *command.Env, cmd *command.Command, args []string) int {
+			return runList(env, cmd, args, ver, statePath)
+		},
+		UsageLine: command.CommandName + " releases list [site]",
+		Short:     "lists the releases of the sites",
+		Long: `List lists the kept releases of every site, or of the given site, from the newest
+to the oldest. The current release is marked with an asterisk.`,
+		Flag:     command.DefaultFlagSet("list"),
+		Aliases:  []string{"ls"},
+		Commands: nil,
+		Complete: func(env *command.Env, args []string, _ string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+
+			return siteNames(env, ver, statePath)
+		},
+		Hidden: false,
+	}
+}
+
+// siteData is a site in the JSON output of the releases commands.
+type siteData struct {
+	Name     string          `json:"name"`
+	Kind     state.SiteKind  `json:"kind"`
+	Current  string          `json:"current,omitempty"`
+	Releases []state.Release `json:"releases"`
+}
+
+// listData is the JSON output of the list command.
+type listData struct {
+	Sites []siteData `json:"sites"`
+}
+
+func runList(env *command.Env, cmd *command.Command, args []string, ver semver.Version, statePath StatePathFunc) int {
+	if len(args) > 1 {
+		return env.UsageError(cmd)
+	}
+
+	s, code := loadState(env, ver, statePath)
+	if s == nil {
+		return code
+	}
+
+	names := make([]string, 0, len(s.Sites))
+
+	if len(args) == 1 {
+		if _, ok := s.Sites[args[0]]; !ok {
+			return env.Errorf(command.ExitFailure, "Error: no site %q in the state", args[0])
+		}
+
+		names = append(names, args[0])
+	} else {
+		for n := range s.Sites {
+			names = append(names, n)
+		}
+
+		sort.Strings(names)
+	}
+
+	data := listData{Sites: make([]siteData, 0, len(names))}
+
+	for _, n := range names {
+		site := s.Sites[n]
+		releases := make([]state.Release, 0, len(site.Releases))
+
+		for i := len(site.Releases) - 1; i >= 0; i-- {
+			releases = append(releases, site.Releases[i])
+		}
+
+		data.Sites = append(data.Sites, siteData{Name: n, Kind: site.Kind, Current: site.Current, Releases: releases})
+	}
+
+	return env.Render("releases", data, func(w io.Writer) {
+		for i, site := range data.Sites {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+
+			fmt.Fprintf(w, "%s (%s)\n", site.Name, site.Kind)
+
+			for _, r := range site.Releases {
+				mark := " "
+				if r.ID == site.Current {
+					mark = "*"
+				}
+
+				fmt.Fprintf(w, "%s %s\t%s\t%s\n", mark, r.ID, r.CreatedAt.UTC().Format(time.RFC3339), describe(r))
+			}
+		}
+	})
+}
+
+// describe returns the location of the release r for the text output.
+func describe(r state.Release) string {
+	switch {
+	case r.Path != "":
+		return r.Path
+	case r.Digest != "":
+		return r.Image + "@" + r.Digest
+	default:
+		return r.Image
+	}
+}
+
+// loadState loads the state for the command.
+// If the state cannot be loaded, it reports the error and returns nil and the
+// exit code.
+func loadState(env *command.Env, ver semver.Version, statePath StatePathFunc) (*state.State, int) {
+	s, err := state.Load(statePath(env), ver)
+	if err != nil {
+		return nil, stateError(env, err)
+	}
+
+	return s, command.ExitSuccess
+}
+
+// stateError reports the error of loading or saving the state and returns the
+// exit code for it.
+func stateError(env *command.Env, err error) int {
+	if errors.Is(err, compat.ErrIncompatible) {
+		return env.Errorf(command.ExitIncompatibleVersion, "Error: %v", err)
+	}
+
+	return env.Errorf(command.ExitFailure, "Error: %v", err)
+}
+
+// siteNames returns the names of the sites in the state for the completion.
+func siteNames(env *command.Env, ver semver.Version, statePath StatePathFunc) []string {
+	s, err := state.Load(statePath(env), ver)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(s.Sites))
+	for n := range s.Sites {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,163 @@
+package releases
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/release"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/settings"
+	"github.com/anttikivi/agricola/internal/state"
+)
+
+// RollbackCommand returns the rollback command.
+func RollbackCommand(ver semver.Version, statePath StatePathFunc) *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " rollback [-dry-run] site [release]",
+		Short:     "switches a site back to an earlier release",
+		Long: `Rollback switches the site back to the given release, or to the release before
+the current one if no release is given. Run "` + command.CommandName + ` releases list" to see the
+releases.
+
+The rollback uses the same switch as the deployments: the link to the release
+directory of a static site is replaced atomically, so the site is served
+without interruption.
+
+The -dry-run flag prints the release that would be switched to without
+switching.`,
+		Flag:     command.DefaultFlagSet("rollback"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: func(env *command.Env, args []string, _ string) []string {
+			switch len(args) {
+			case 0:
+				return siteNames(env, ver, statePath)
+			case 1:
+				return releaseIDs(env, ver, statePath, args[0])
+			default:
+				return nil
+			}
+		},
+		Hidden: false,
+	}
+
+	dryRun := c.Flag.Bool("dry-run", false, "print the release without switching to it")
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runRollback(env, cmd, args, ver, statePath, *dryRun)
+	}
+
+	return c
+}
+
+// rollbackData is the JSON output of the rollback command.
+type rollbackData struct {
+	Site   string `json:"site"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dry_run"`
+}
+
+func runRollback(
+	env *command.Env,
+	cmd *command.Command,
+	args []string,
+	ver semver.Version,
+	statePath StatePathFunc,
+	dryRun bool,
+) int {
+	if len(args) < 1 || len(args) > 2 { //nolint:mnd
+		return env.UsageError(cmd)
+	}
+
+	s, code := loadState(env, ver, statePath)
+	if s == nil {
+		return code
+	}
+
+	site, ok := s.Sites[args[0]]
+	if !ok {
+		return env.Errorf(command.ExitFailure, "Error: no site %q in the state", args[0])
+	}
+
+	id := ""
+	if len(args) == 2 { //nolint:mnd
+		id = args[1]
+	}
+
+	target, err := release.Target(site, id)
+	if err != nil {
+		return env.Errorf(command.ExitFailure, "Error rolling back %s: %v", args[0], err)
+	}
+
+	data := rollbackData{Site: args[0], From: site.Current, To: target.ID, DryRun: dryRun}
+
+	if !dryRun && target.ID != site.Current {
+		projectDir := settings.ProjectDir(env.Dir)
+		previous := site.Current
+
+		if err = release.Activate(site, target, projectDir); err != nil {
+			return env.Errorf(command.ExitFailure, "Error rolling back %s: %v", args[0], err)
+		}
+
+		if err = state.Save(statePath(env), s, ver); err != nil {
+			// Switch back so that the state still matches the served release.
+			switchBack(args[0], site, previous, projectDir)
+
+			return stateError(env, err)
+		}
+	}
+
+	return env.Render("rollback", data, func(w io.Writer) {
+		switch {
+		case data.From == data.To:
+			fmt.Fprintf(w, "%s is already at the release %s\n", data.Site, data.To)
+		case dryRun:
+			fmt.Fprintf(w, "Would roll back %s from the release %s to %s\n", data.Site, data.From, data.To)
+		default:
+			fmt.Fprintf(w, "Rolled back %s from the release %s to %s\n", data.Site, data.From, data.To)
+		}
+	})
+}
+
+// switchBack switches the site with the given name back to the release with
+// the given ID after a failed change. If the release is not recorded in the
+// site, for example because it was pruned or the site had no current release,
+// the site is left as it is.
+// The failures are only logged as the error that caused the switch is reported
+// instead.
+func switchBack(name string, site *state.Site, id string, projectDir string) {
+	r, ok := site.Release(id)
+	if !ok {
+		alog.Warningf("%s has no recorded release %q to switch back to", name, id)
+
+		return
+	}
+
+	if err := release.Activate(site, r, projectDir); err != nil {
+		alog.Errorf("Failed to switch %s back to the release %s: %v", name, r.ID, err)
+	}
+}
+
+// releaseIDs returns the IDs of the releases of the site for the completion.
+func releaseIDs(env *command.Env, ver semver.Version, statePath StatePathFunc, name string) []string {
+	s, err := state.Load(statePath(env), ver)
+	if err != nil {
+		return nil
+	}
+
+	site, ok := s.Sites[name]
+	if !ok {
+		return nil
+	}
+
+	ids := make([]string, 0, len(site.Releases))
+	for _, r := range site.Releases {
+		ids = append(ids, r.ID)
+	}
+
+	return ids
+}
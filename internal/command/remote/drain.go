@@ -0,0 +1,354 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/inventory"
+	"github.com/anttikivi/agricola/internal/remote"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/settings"
+	"github.com/anttikivi/agricola/internal/upstream"
+)
+
+// The default values of the drain flags.
+const (
+	defaultDrainTimeout  = 30 * time.Second
+	defaultDrainInterval = time.Second
+)
+
+var (
+	// errNoDrainCommand is returned when the drain command is run without
+	// the command that takes the hosts out of rotation.
+	errNoDrainCommand = errors.New("no drain command given, use the -command flag")
+
+	// errNotAppHost is returned when a host to drain is not a host of the
+	// app.
+	errNotAppHost = errors.New("not a host of the app")
+
+	// errInvalidCount is returned when the connections command does not
+	// print a valid number of connections.
+	errInvalidCount = errors.New("invalid number of connections")
+)
+
+// DrainCommand returns the drain command.
+func DrainCommand(ver semver.Version) *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " drain [-inventory file] [-command command] [-connections command] [-timeout duration] [-interval duration] [-ssh program] [-identity file] [-known-hosts file] [-jump hosts] app [hosts]", //nolint:lll
+		Short:     "takes the hosts of an app out of rotation",
+		Long: `Drain takes the hosts of the app out of rotation for maintenance and waits for
+their active connections to finish.
+
+The hosts of the app are read from the inventory file like in the remote rollout
+command. The optional comma-separated list of hosts selects the hosts of the app
+to drain. By default, every host of the app is drained.
+The running version must satisfy the version requirement of the inventory.
+
+The -inventory flag sets the inventory file. By default, it is
+".agricola/inventory.json" in the project directory.
+
+The -command flag sets the shell command that is run on each host to take it out
+of rotation, and it is required. The -connections flag sets the shell command
+that prints the number of the active connections on the host. If it is set,
+drain runs it after every interval set with the -interval flag until the
+connections have finished or the time set with the -timeout flag has passed.
+
+After draining, the duration of each drain and the statistics of the drains are
+printed. The drained hosts stay out of rotation, and they can be put back into
+rotation, for example, with the remote exec command.
+
+` + sshFlagsHelp,
+		Flag:     command.DefaultFlagSet("drain"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: func(env *command.Env, args []string, _ string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+
+			inv, err := inventory.Load(inventory.DefaultPath(settings.ProjectDir(env.Dir)))
+			if err != nil {
+				return nil
+			}
+
+			return inv.AppNames()
+		},
+		Hidden: false,
+	}
+
+	flags := addSSHFlags(c.Flag)
+	opts := &drainFlags{
+		inventory:   c.Flag.String("inventory", "", "the inventory `file`"),
+		command:     c.Flag.String("command", "", "the `command` that takes a host out of rotation"),
+		connections: c.Flag.String("connections", "", "the `command` that prints the number of the active connections"),
+		timeout:     c.Flag.Duration("timeout", defaultDrainTimeout, "the maximum `duration` to wait for the connections"),
+		interval:    c.Flag.Duration("interval", defaultDrainInterval, "the `duration` between the connection checks"),
+	}
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runDrain(env, cmd, args, ver, flags, opts)
+	}
+
+	return c
+}
+
+// drainFlags are the flags of the drain command.
+type drainFlags struct {
+	inventory   *string
+	command     *string
+	connections *string
+	timeout     *time.Duration
+	interval    *time.Duration
+}
+
+// drainResult is the result of the drain command in the JSON output.
+type drainResult struct {
+	App   string            `json:"app"`
+	Hosts []drainHostResult `json:"hosts"`
+	Stats drainStats        `json:"stats"`
+}
+
+// drainHostResult is a result of a host in the JSON output of the drain
+// command.
+type drainHostResult struct {
+	Host string `json:"host"`
+
+	// Duration is the duration of the drain in seconds.
+	Duration float64 `json:"duration"`
+
+	// Remaining is the number of the connections that had not finished.
+	Remaining int    `json:"remaining"`
+	Error     string `json:"error,omitempty"`
+}
+
+// drainStats are the statistics of the drains in the JSON output of the drain
+// command. The durations are in seconds.
+type drainStats struct {
+	Count    int     `json:"count"`
+	TimedOut int     `json:"timed_out"`
+	Mean     float64 `json:"mean"`
+	Max      float64 `json:"max"`
+}
+
+func runDrain(env *command.Env, cmd *command.Command, args []string, ver semver.Version, flags *sshFlags, opts *drainFlags) int { //nolint:lll
+	if len(args) < 1 || len(args) > 2 { //nolint:mnd
+		return env.UsageError(cmd)
+	}
+
+	if *opts.command == "" {
+		return env.Errorf(command.ExitInvalidArgs, "Error: %v", errNoDrainCommand)
+	}
+
+	inv, path, rc := loadInventory(env, *opts.inventory, ver)
+	if inv == nil {
+		return rc
+	}
+
+	app := args[0]
+
+	hosts, ok := inv.Hosts(app)
+	if !ok {
+		return env.Errorf(command.ExitInvalidArgs, "Error: no app %q in the inventory %s", app, path)
+	}
+
+	if len(args) > 1 {
+		selected, err := selectHosts(hosts, args[1])
+		if err != nil {
+			return env.Errorf(command.ExitInvalidArgs, "Error: %v %q", err, app)
+		}
+
+		hosts = selected
+	}
+
+	config, err := flags.config(env)
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error: %v", err)
+	}
+
+	metrics := upstream.NewDrainMetrics()
+	drained := make([]upstream.DrainResult, len(hosts))
+
+	wait := drainWait{
+		connections: *opts.connections,
+		timeout:     *opts.timeout,
+		interval:    *opts.interval,
+	}
+
+	results := remote.ForEach(env.Context, hosts, config, 0, func(ctx context.Context, i int, c *remote.Client) error {
+		var err error
+
+		drained[i], err = drainHost(ctx, c, *opts.command, wait, metrics)
+
+		return err
+	})
+
+	hostResults := make([]drainHostResult, 0, len(results))
+	code := command.ExitSuccess
+
+	for i, r := range results {
+		res := drainHostResult{
+			Host:      r.Host.String(),
+			Duration:  drained[i].Duration.Seconds(),
+			Remaining: drained[i].Remaining,
+			Error:     "",
+		}
+
+		if r.Err != nil {
+			res.Error = r.Err.Error()
+			code = command.ExitFailure
+		}
+
+		hostResults = append(hostResults, res)
+	}
+
+	stats := metrics.Stats()
+	data := drainResult{App: app, Hosts: hostResults, Stats: newDrainStats(stats)}
+
+	if rc := env.Render("drain", data, func(w io.Writer) {
+		for i, r := range data.Hosts {
+			switch {
+			case r.Remaining > 0:
+				fmt.Fprintf(w, "%s: %d connections remaining after %v\n", r.Host, r.Remaining, roundDuration(drained[i].Duration))
+			case r.Error != "":
+				fmt.Fprintf(w, "%s: failed\n", r.Host)
+			default:
+				fmt.Fprintf(w, "%s: drained in %v\n", r.Host, roundDuration(drained[i].Duration))
+			}
+
+			if r.Error != "" {
+				fmt.Fprintf(w, "\t%s\n", r.Error)
+			}
+		}
+
+		printDrainStats(w, stats)
+	}); rc != command.ExitSuccess {
+		return rc
+	}
+
+	return code
+}
+
+// drainWait are the options for waiting for the connections of a drained
+// host.
+type drainWait struct {
+	// connections is the shell command line that prints the number of the
+	// active connections. If it is empty, the connections are not waited for.
+	connections string
+
+	// timeout is the maximum time to wait for the connections.
+	timeout time.Duration
+
+	// interval is the time between counting the connections.
+	interval time.Duration
+}
+
+// drainHost takes the host of c out of rotation with the shell command line
+// script and waits for its active connections to finish as set in wait.
+// The result is recorded in metrics. A drain whose connections could not be
+// counted is recorded as one that did not finish.
+// If the connections did not finish in time, drainHost returns the number of
+// the remaining connections with an error.
+func drainHost(
+	ctx context.Context,
+	c *remote.Client,
+	script string,
+	wait drainWait,
+	metrics *upstream.DrainMetrics,
+) (upstream.DrainResult, error) {
+	start := time.Now()
+
+	if err := c.RunShell(ctx, script, nil, nil, nil); err != nil {
+		return upstream.DrainResult{Duration: 0, Remaining: 0}, fmt.Errorf("failed to take the host out of rotation: %w", err)
+	}
+
+	var (
+		res upstream.DrainResult
+		err error
+	)
+
+	if wait.connections != "" {
+		waitCtx, cancel := context.WithTimeout(ctx, wait.timeout)
+		defer cancel()
+
+		res, err = upstream.WaitIdle(waitCtx, c.Host().String(), func(ctx context.Context) (int, error) {
+			return activeConnections(ctx, c, wait.connections)
+		}, wait.interval)
+	}
+
+	// The duration of the drain includes taking the host out of rotation.
+	res.Duration = time.Since(start)
+	metrics.Observe(res, err != nil)
+
+	switch {
+	case err != nil && res.Remaining == 0:
+		return res, err
+	case err != nil:
+		return res, fmt.Errorf("the connections did not finish: %w", err)
+	default:
+		return res, nil
+	}
+}
+
+// newDrainStats returns the drain statistics for the JSON output.
+func newDrainStats(stats upstream.DrainStats) drainStats {
+	return drainStats{
+		Count:    stats.Count,
+		TimedOut: stats.TimedOut,
+		Mean:     stats.Mean().Seconds(),
+		Max:      stats.Max.Seconds(),
+	}
+}
+
+// printDrainStats prints the drain statistics for the text output.
+func printDrainStats(w io.Writer, stats upstream.DrainStats) {
+	fmt.Fprintf(w, "Drains: %d, timed out: %d, mean: %v, max: %v\n",
+		stats.Count, stats.TimedOut, roundDuration(stats.Mean()), roundDuration(stats.Max))
+}
+
+// selectHosts returns the hosts in the comma-separated list s that are in
+// hosts.
+func selectHosts(hosts []remote.Host, s string) ([]remote.Host, error) {
+	selected, err := parseHosts(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the hosts: %w", err)
+	}
+
+	for _, h := range selected {
+		if !slices.Contains(hosts, h) {
+			return nil, fmt.Errorf("%s: %w", h, errNotAppHost)
+		}
+	}
+
+	return selected, nil
+}
+
+// activeConnections runs the shell command line script on the host of c and
+// parses the number of the active connections it prints.
+func activeConnections(ctx context.Context, c *remote.Client, script string) (int, error) {
+	var out bytes.Buffer
+
+	if err := c.RunShell(ctx, script, nil, &out, nil); err != nil {
+		return 0, fmt.Errorf("failed to count the connections: %w", err)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(out.String()))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %q", errInvalidCount, strings.TrimSpace(out.String()))
+	}
+
+	return n, nil
+}
+
+// roundDuration rounds d to milliseconds for printing.
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package remote
+
+import (
+	"fmt"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/remote"
+)
+
+func forwardCommand() *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " remote forward [-ssh program] [-identity file] [-known-hosts file] [-jump hosts] host socket remote-socket", //nolint:lll
+		Short:     "forwards a Unix socket of a remote host",
+		Long: `Forward forwards the local Unix socket to the Unix socket remote-socket on the
+host until it is interrupted. The host is given in the form
+"[user@]host[:port]".
+
+For example, the Docker daemon of the host can be controlled by forwarding its
+socket and pointing the Docker client to the local socket:
+
+	` + command.CommandName + ` remote forward deploy@web1 /tmp/web1.sock /var/run/docker.sock
+	DOCKER_HOST=unix:///tmp/web1.sock docker ps
+
+` + sshFlagsHelp,
+		Flag:     command.DefaultFlagSet("forward"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: nil,
+		Hidden:   false,
+	}
+
+	flags := addSSHFlags(c.Flag)
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runForward(env, cmd, args, flags)
+	}
+
+	return c
+}
+
+func runForward(env *command.Env, cmd *command.Command, args []string, flags *sshFlags) int {
+	if len(args) != 3 { //nolint:mnd
+		return env.UsageError(cmd)
+	}
+
+	host, err := remote.ParseHost(args[0])
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error parsing the host: %v", err)
+	}
+
+	config, err := flags.config(env)
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error: %v", err)
+	}
+
+	socket := env.Path(args[1])
+
+	f, err := remote.NewClient(host, config).ForwardSocket(env.Context, socket, args[2])
+	if err != nil {
+		return env.Errorf(command.ExitFailure, "Error: %v", err)
+	}
+
+	if env.Output != command.FormatJSON {
+		fmt.Fprintf(env.Stderr, "Forwarding %s to %s on %s, interrupt to stop\n", socket, args[2], host)
+	}
+
+	select {
+	case <-env.Context.Done():
+	case <-f.Done():
+	}
+
+	closeErr := f.Close()
+
+	// Interrupting is the way to stop forwarding, so the forward only fails
+	// if the SSH client exited by itself.
+	if env.Context.Err() == nil {
+		return env.Errorf(command.ExitFailure, "Error: the forward to %s stopped: %v", host, f.Err())
+	}
+
+	if closeErr != nil {
+		return env.Errorf(command.ExitFailure, "Error: %v", closeErr)
+	}
+
+	return command.ExitSuccess
+}
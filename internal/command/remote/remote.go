@@ -0,0 +1,236 @@
+// Package remote implements the commands for working with the remote hosts.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/compat"
+	"github.com/anttikivi/agricola/internal/inventory"
+	"github.com/anttikivi/agricola/internal/remote"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/settings"
+)
+
+// Command returns the remote command group.
+// The inventory must allow the running version ver.
+func Command(ver semver.Version) *command.Command {
+	return &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " remote",
+		Short:     "works with the remote hosts",
+		Long: `Remote works with the remote hosts over SSH.
+
+The connections use the system's OpenSSH client. The keys are taken from the SSH
+agent or from the file given with the -identity flag, and the host keys must be
+found in the known_hosts files as ` + command.CommandName + ` never accepts unknown host keys.
+The connections can go through jump hosts given with the -jump flag.`,
+		Flag:     command.DefaultFlagSet("remote"),
+		Aliases:  nil,
+		Commands: []*command.Command{execCommand(), forwardCommand(), rolloutCommand(ver), uploadCommand()},
+		Complete: nil,
+		Hidden:   false,
+	}
+}
+
+// sshFlags are the flags of the SSH connections.
+type sshFlags struct {
+	program    *string
+	identity   *string
+	knownHosts *string
+	jump       *string
+}
+
+// addSSHFlags defines the flags of the SSH connections in fs.
+func addSSHFlags(fs *flag.FlagSet) *sshFlags {
+	f := &sshFlags{
+		program:    fs.String("ssh", "ssh", "the SSH client `program`"),
+		identity:   fs.String("identity", "", "the private key `file`"),
+		knownHosts: fs.String("known-hosts", "", "the known host keys `file`"),
+		jump:       fs.String("jump", "", "the comma-separated jump `hosts`"),
+	}
+
+	// The project configuration must not choose the program that is run, the
+	// keys that are used or trusted, or the hosts the connections go through.
+	settings.UserOnly(fs, "ssh", "identity", "known-hosts", "jump")
+
+	return f
+}
+
+// config returns the configuration of the SSH connections set by the flags.
+func (f *sshFlags) config(env *command.Env) (remote.Config, error) {
+	jumps, err := parseHosts(*f.jump)
+	if err != nil {
+		return remote.Config{}, fmt.Errorf("failed to parse the jump hosts: %w", err)
+	}
+
+	return remote.Config{
+		Program:        *f.program,
+		IdentityFile:   optionalPath(env, *f.identity),
+		KnownHostsFile: optionalPath(env, *f.knownHosts),
+		JumpHosts:      jumps,
+		Options:        nil,
+	}, nil
+}
+
+// sshFlagsHelp is the description of the SSH connection flags for the long
+// help messages of the commands.
+const sshFlagsHelp = `The -ssh flag sets the SSH client program to run. By default, "ssh" is run
+from PATH.
+
+The -identity flag sets the private key file. By default, the keys are taken
+from the SSH agent and the default key files.
+
+The -known-hosts flag sets the file of the known host keys. By default, the
+known_hosts files of the SSH client are used.
+
+The -jump flag sets the comma-separated list of the jump hosts the connections
+go through.`
+
+func execCommand() *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " remote exec [-ssh program] [-identity file] [-known-hosts file] [-jump hosts] [-parallel n] hosts command [arguments]", //nolint:lll
+		Short:     "runs a command on the remote hosts",
+		Long: `Exec runs the command on every host in the comma-separated list of hosts and
+prints the output of each host. The hosts are given in the form
+"[user@]host[:port]".
+
+` + sshFlagsHelp + `
+
+The -parallel flag sets the number of hosts the command is run on at the same
+time. Zero runs the command on all of the hosts at the same time.`,
+		Flag:     command.DefaultFlagSet("exec"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: nil,
+		Hidden:   false,
+	}
+
+	flags := addSSHFlags(c.Flag)
+	parallel := c.Flag.Int("parallel", 4, "the number of hosts to run on at the same time") //nolint:mnd
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runExec(env, cmd, args, flags, *parallel)
+	}
+
+	return c
+}
+
+// hostResult is a result of a host in the JSON output of the exec command.
+type hostResult struct {
+	Host   string `json:"host"`
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+func runExec(env *command.Env, cmd *command.Command, args []string, flags *sshFlags, parallel int) int {
+	if len(args) < 2 { //nolint:mnd
+		return env.UsageError(cmd)
+	}
+
+	hosts, err := parseHosts(args[0])
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error parsing the hosts: %v", err)
+	}
+
+	config, err := flags.config(env)
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error: %v", err)
+	}
+
+	outputs := make([]bytes.Buffer, len(hosts))
+
+	results := remote.ForEach(env.Context, hosts, config, parallel, func(ctx context.Context, i int, c *remote.Client) error {
+		out := &outputs[i]
+
+		return c.Run(ctx, args[1:], nil, out, out)
+	})
+
+	data := make([]hostResult, 0, len(results))
+	code := command.ExitSuccess
+
+	for i, r := range results {
+		res := hostResult{Host: r.Host.String(), Output: outputs[i].String(), Error: ""}
+		if r.Err != nil {
+			res.Error = r.Err.Error()
+			code = command.ExitFailure
+		}
+
+		data = append(data, res)
+	}
+
+	if rc := env.Render("remote-exec", data, func(w io.Writer) {
+		for _, r := range data {
+			fmt.Fprintf(w, "==> %s <==\n%s", r.Host, r.Output)
+
+			if r.Error != "" {
+				fmt.Fprintf(w, "Error: %s\n", r.Error)
+			}
+		}
+	}); rc != command.ExitSuccess {
+		return rc
+	}
+
+	return code
+}
+
+// loadInventory loads the inventory from file, or from the default inventory
+// file of the project if file is empty, and checks that the running version ver
+// satisfies its version requirement.
+// If the inventory cannot be used, it reports the error and returns nil and
+// the exit code. Otherwise it returns the inventory and the path it was loaded
+// from.
+func loadInventory(env *command.Env, file string, ver semver.Version) (*inventory.Inventory, string, int) {
+	path := inventory.DefaultPath(settings.ProjectDir(env.Dir))
+	if file != "" {
+		path = env.Path(file)
+	}
+
+	inv, err := inventory.Load(path)
+	if err != nil {
+		return nil, path, env.Errorf(command.ExitFailure, "Error loading the inventory: %v", err)
+	}
+
+	if err = compat.CheckRequirement(path, ver, inv.RequiresAger); err != nil {
+		return nil, path, env.Errorf(command.ExitIncompatibleVersion, "Error: %v", err)
+	}
+
+	return inv, path, command.ExitSuccess
+}
+
+// parseHosts parses the comma-separated list of hosts.
+func parseHosts(s string) ([]remote.Host, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(s, ",")
+	hosts := make([]remote.Host, 0, len(fields))
+
+	for _, f := range fields {
+		h, err := remote.ParseHost(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", f, err)
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
+
+// optionalPath resolves path relative to the working directory unless it is
+// empty.
+func optionalPath(env *command.Env, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	return env.Path(path)
+}
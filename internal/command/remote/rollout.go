@@ -0,0 +1,381 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/health"
+	"github.com/anttikivi/agricola/internal/inventory"
+	"github.com/anttikivi/agricola/internal/remote"
+	"github.com/anttikivi/agricola/internal/rollout"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/settings"
+	"github.com/anttikivi/agricola/internal/upstream"
+)
+
+func rolloutCommand(ver semver.Version) *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " remote rollout [-inventory file] [-batch size] [-health command] [-health-url url] [-health-container name] [-health-exec command] [-health-interval duration] [-health-timeout duration] [-health-start-period duration] [-health-healthy-threshold n] [-health-unhealthy-threshold n] [-rollback command] [-drain command] [-drain-connections command] [-drain-timeout duration] [-drain-interval duration] [-restore command] [-ssh program] [-identity file] [-known-hosts file] [-jump hosts] app command [arguments]", //nolint:lll
+		Short:     "runs a command on the hosts of an app in batches",
+		Long: `Rollout runs the deployment command on the hosts of the app in rolling batches.
+
+The hosts of the app are read from the inventory file. The inventory groups the
+hosts into roles, and each app is deployed to the hosts of its roles, for
+example:
+
+	{
+	  "roles": {
+	    "web": ["deploy@web1.example.com", "deploy@web2.example.com"],
+	    "worker": ["deploy@worker1.example.com:2222"]
+	  },
+	  "apps": {
+	    "blog": {"roles": ["web"], "batch_size": "50%"}
+	  },
+	  "requires_ager": ">=0.3.0"
+	}
+
+The optional "requires_ager" sets the versions of ` + command.CommandName + ` that may deploy with the
+inventory. If the running version does not satisfy it, the rollout is not
+started and the command exits with the status 3.
+
+The hosts in a batch are deployed to at the same time, and the next batch is
+only started after every host in the batch has passed the health check. If the
+command or the health check fails on a host, the rollout stops.
+
+The -inventory flag sets the inventory file. By default, it is
+".agricola/inventory.json" in the project directory.
+
+The -batch flag sets the size of the batches either as a number of hosts, for
+example "2", or as a percentage of the hosts, for example "25%". By default,
+the batch size of the app in the inventory is used, and if the app does not
+have one, all of the hosts are deployed to in a single batch.
+
+The -health flag sets the shell command that is run on each host after the
+deployment to check that the host is healthy. The -health-url flag sets the URL
+that must respond with a successful status for the host to be healthy, with
+"{host}" replaced by the name of the host, for example
+"http://{host}:8080/healthz".
+
+The -health-container flag sets the Docker container on each host whose
+HEALTHCHECK status must be healthy. If the container has no HEALTHCHECK, the
+shell command set with the -health-exec flag is run in the container instead,
+and the check fails if neither is available. The -health-exec flag requires the
+-health-container flag. If several of the health checks are set, all of them
+must pass.
+
+The health checks are repeated after the interval set with the -health-interval
+flag, and each check fails if it takes longer than the -health-timeout flag. The
+host is healthy after the number of consecutive successful checks set with the
+-health-healthy-threshold flag and unhealthy after the number of consecutive
+failed checks set with the -health-unhealthy-threshold flag. The failed checks
+are not counted during the -health-start-period after the deployment.
+
+The -rollback flag sets the shell command that is run to roll back the hosts
+that were deployed to if the rollout fails.
+
+The -drain flag sets the shell command that is run on each host before the
+deployment to take it out of rotation. The -drain-connections flag sets the
+shell command that prints the number of the active connections on the host,
+and it is run after every -drain-interval until the connections have finished.
+If they have not finished after -drain-timeout, the host is deployed to anyway.
+The durations of the drains are printed after the rollout, like in the drain
+command.
+
+The -restore flag sets the shell command that puts the host back into
+rotation after it has passed the health check or has been rolled back, or if
+draining it failed. A host that fails and is not rolled back is left out of
+rotation, and it is reported as such.
+
+` + sshFlagsHelp,
+		Flag:     command.DefaultFlagSet("rollout"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: func(env *command.Env, args []string, _ string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+
+			inv, err := inventory.Load(inventory.DefaultPath(settings.ProjectDir(env.Dir)))
+			if err != nil {
+				return nil
+			}
+
+			return inv.AppNames()
+		},
+		Hidden: false,
+	}
+
+	flags := addSSHFlags(c.Flag)
+	opts := &rolloutFlags{
+		inventory: c.Flag.String("inventory", "", "the inventory `file`"),
+		batch:     new(rollout.BatchSize),
+		health:    c.Flag.String("health", "", "the health check `command`"),
+		healthURL: c.Flag.String("health-url", "", "the health check `url`"),
+		container: c.Flag.String("health-container", "", "the `name` of the container whose health is checked"),
+		exec:      c.Flag.String("health-exec", "", "the health check `command` to run in the container"),
+		rollback:  c.Flag.String("rollback", "", "the rollback `command`"),
+		drain:     c.Flag.String("drain", "", "the `command` that takes a host out of rotation"),
+		drainWait: drainWait{connections: "", timeout: 0, interval: 0},
+		restore:   c.Flag.String("restore", "", "the `command` that puts a host back into rotation"),
+		healthConfig: health.Config{
+			Interval:           0,
+			Timeout:            0,
+			StartPeriod:        0,
+			HealthyThreshold:   0,
+			UnhealthyThreshold: 0,
+		},
+	}
+
+	c.Flag.DurationVar(&opts.healthConfig.Interval, "health-interval", health.DefaultInterval, "the `duration` between the health checks")                                           //nolint:lll
+	c.Flag.DurationVar(&opts.healthConfig.Timeout, "health-timeout", health.DefaultTimeout, "the timeout `duration` of a health check")                                              //nolint:lll
+	c.Flag.DurationVar(&opts.healthConfig.StartPeriod, "health-start-period", 0, "the `duration` after the deployment when the failed health checks are not counted")                //nolint:lll
+	c.Flag.IntVar(&opts.healthConfig.HealthyThreshold, "health-healthy-threshold", health.DefaultHealthyThreshold, "the number of successful health checks for a healthy host")      //nolint:lll
+	c.Flag.IntVar(&opts.healthConfig.UnhealthyThreshold, "health-unhealthy-threshold", health.DefaultUnhealthyThreshold, "the number of failed health checks for an unhealthy host") //nolint:lll
+
+	c.Flag.StringVar(&opts.drainWait.connections, "drain-connections", "", "the `command` that prints the number of the active connections") //nolint:lll
+	c.Flag.DurationVar(&opts.drainWait.timeout, "drain-timeout", defaultDrainTimeout, "the maximum `duration` to wait for the connections")  //nolint:lll
+	c.Flag.DurationVar(&opts.drainWait.interval, "drain-interval", defaultDrainInterval, "the `duration` between the connection checks")     //nolint:lll
+
+	c.Flag.Var(opts.batch, "batch", "the batch `size` as a number of hosts or a percentage")
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runRollout(env, cmd, args, ver, flags, opts)
+	}
+
+	return c
+}
+
+// rolloutFlags are the flags of the rollout command.
+type rolloutFlags struct {
+	inventory *string
+	batch     *rollout.BatchSize
+	health    *string
+	healthURL *string
+	container *string
+	exec      *string
+	rollback  *string
+	drain     *string
+	restore   *string
+
+	drainWait    drainWait
+	healthConfig health.Config
+}
+
+// rolloutResult is the result of the rollout command in the JSON output.
+type rolloutResult struct {
+	App   string              `json:"app"`
+	Hosts []rolloutHostResult `json:"hosts"`
+
+	// Drains are the statistics of the drains if the hosts were drained.
+	Drains *drainStats `json:"drains,omitempty"`
+}
+
+// rolloutHostResult is a result of a host in the JSON output of the rollout
+// command.
+type rolloutHostResult struct {
+	Host   string         `json:"host"`
+	Batch  int            `json:"batch"`
+	Status rollout.Status `json:"status"`
+	Error  string         `json:"error,omitempty"`
+
+	// Drained reports whether the host was left out of rotation.
+	Drained bool `json:"drained,omitempty"`
+}
+
+func runRollout(env *command.Env, cmd *command.Command, args []string, ver semver.Version, flags *sshFlags, opts *rolloutFlags) int { //nolint:lll
+	if len(args) < 2 { //nolint:mnd
+		return env.UsageError(cmd)
+	}
+
+	if *opts.exec != "" && *opts.container == "" {
+		return env.Errorf(command.ExitInvalidArgs, "Error: the -health-exec flag requires the -health-container flag")
+	}
+
+	inv, path, rc := loadInventory(env, *opts.inventory, ver)
+	if inv == nil {
+		return rc
+	}
+
+	app := args[0]
+
+	hosts, ok := inv.Hosts(app)
+	if !ok {
+		return env.Errorf(command.ExitInvalidArgs, "Error: no app %q in the inventory %s", app, path)
+	}
+
+	config, err := flags.config(env)
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error: %v", err)
+	}
+
+	size := inv.Apps[app].BatchSize
+	if *opts.batch != (rollout.BatchSize{}) {
+		size = *opts.batch
+	}
+
+	argv := args[1:]
+	metrics := upstream.NewDrainMetrics()
+	results, err := rollout.Run(env.Context, hosts, rollout.Options{
+		Config:    config,
+		BatchSize: size,
+		Drain:     drainStep(*opts.drain, opts.drainWait, metrics),
+		Deploy: func(ctx context.Context, c *remote.Client) error {
+			return c.Run(ctx, argv, nil, nil, nil)
+		},
+		Check:    healthStep(opts),
+		Rollback: shellStep(*opts.rollback),
+		Restore:  shellStep(*opts.restore),
+	})
+
+	data := rolloutResult{App: app, Hosts: make([]rolloutHostResult, 0, len(results)), Drains: nil}
+	if *opts.drain != "" {
+		stats := newDrainStats(metrics.Stats())
+		data.Drains = &stats
+	}
+	batches := 0
+
+	for _, r := range results {
+		res := rolloutHostResult{Host: r.Host.String(), Batch: r.Batch, Status: r.Status, Error: "", Drained: r.Drained}
+		if r.Err != nil {
+			res.Error = r.Err.Error()
+		}
+
+		batches = max(batches, r.Batch)
+		data.Hosts = append(data.Hosts, res)
+	}
+
+	if rc := env.Render("rollout", data, func(w io.Writer) {
+		for _, r := range data.Hosts {
+			fmt.Fprintf(w, "%s: %s (batch %d/%d)", r.Host, r.Status, r.Batch, batches)
+
+			if r.Drained {
+				fmt.Fprint(w, ", out of rotation")
+			}
+
+			fmt.Fprintln(w)
+
+			if r.Error != "" {
+				fmt.Fprintf(w, "\t%s\n", r.Error)
+			}
+		}
+
+		if data.Drains != nil {
+			printDrainStats(w, metrics.Stats())
+		}
+	}); rc != command.ExitSuccess {
+		return rc
+	}
+
+	if err != nil {
+		// The results already report the failure in the JSON output.
+		if env.Output != command.FormatJSON {
+			fmt.Fprintf(env.Stderr, "Error: %v\n", err)
+		}
+
+		return command.ExitFailure
+	}
+
+	return command.ExitSuccess
+}
+
+// healthStep returns a rollout step that waits until the health checks set
+// in opts pass on the host, or nil if no health check is set.
+func healthStep(opts *rolloutFlags) rollout.Step {
+	script, url, container := *opts.health, *opts.healthURL, *opts.container
+	if script == "" && url == "" && container == "" {
+		return nil
+	}
+
+	return rollout.HealthCheck(func(client *remote.Client) health.Probe {
+		var probes []health.Probe
+
+		if container != "" {
+			probes = append(probes, containerProbe(client, container, *opts.exec))
+		}
+
+		if script != "" {
+			probes = append(probes, health.ProbeFunc(func(ctx context.Context) error {
+				return client.RunShell(ctx, script, nil, nil, nil)
+			}))
+		}
+
+		if url != "" {
+			probes = append(probes, &health.HTTPProbe{
+				URL:    strings.ReplaceAll(url, "{host}", client.Host().Name),
+				Status: 0,
+				Body:   "",
+				Client: nil,
+			})
+		}
+
+		return health.ProbeFunc(func(ctx context.Context) error {
+			for _, p := range probes {
+				if err := p.Check(ctx); err != nil {
+					return err //nolint:wrapcheck
+				}
+			}
+
+			return nil
+		})
+	}, opts.healthConfig)
+}
+
+// containerProbe returns a probe that checks the HEALTHCHECK of the container
+// on the host of client, or runs the shell command line script in the
+// container if it has no HEALTHCHECK and script is set.
+func containerProbe(client *remote.Client, container, script string) health.Probe {
+	// The Docker client is run on the host where the container is.
+	runner := func(ctx context.Context, args ...string) ([]byte, error) {
+		return client.Output(ctx, append([]string{"docker"}, args...))
+	}
+
+	var fallback health.Probe
+	if script != "" {
+		fallback = &health.ExecProbe{
+			Docker:    "",
+			Runner:    runner,
+			Container: container,
+			Command:   []string{"sh", "-c", script},
+		}
+	}
+
+	return &health.DockerProbe{Docker: "", Runner: runner, Container: container, Fallback: fallback}
+}
+
+// drainStep returns a rollout step that drains the host with the shell command
+// line script and waits for its connections as set in wait, or nil if script
+// is empty. The drains are recorded in metrics.
+// If the connections do not finish in time, the host is deployed to anyway.
+func drainStep(script string, wait drainWait, metrics *upstream.DrainMetrics) rollout.Step {
+	if script == "" {
+		return nil
+	}
+
+	return func(ctx context.Context, c *remote.Client) error {
+		res, err := drainHost(ctx, c, script, wait, metrics)
+		if err != nil && res.Remaining > 0 && ctx.Err() == nil {
+			alog.Warningf("Deploying to %s with %d active connections: %v", c.Host(), res.Remaining, err)
+
+			return nil
+		}
+
+		return err
+	}
+}
+
+// shellStep returns a rollout step that runs the shell command line script on
+// the host, or nil if script is empty.
+func shellStep(script string) rollout.Step {
+	if script == "" {
+		return nil
+	}
+
+	return func(ctx context.Context, c *remote.Client) error {
+		return c.RunShell(ctx, script, nil, nil, nil)
+	}
+}
@@ -0,0 +1,102 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/remote"
+)
+
+func uploadCommand() *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " remote upload [-ssh program] [-identity file] [-known-hosts file] [-jump hosts] [-parallel n] hosts dir remote-dir", //nolint:lll
+		Short:     "copies a directory to the remote hosts",
+		Long: `Upload copies the local directory dir to the directory remote-dir on every host
+in the comma-separated list of hosts, for example to upload a new release of a
+static site. The hosts are given in the form "[user@]host[:port]".
+
+The directory is first extracted next to remote-dir and only moved to
+remote-dir after all of it has been copied, so a failed upload does not leave
+a partial directory behind. The remote-dir must not exist.
+
+` + sshFlagsHelp + `
+
+The -parallel flag sets the number of hosts the directory is copied to at the
+same time. Zero copies the directory to all of the hosts at the same time.`,
+		Flag:     command.DefaultFlagSet("upload"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: nil,
+		Hidden:   false,
+	}
+
+	flags := addSSHFlags(c.Flag)
+	parallel := c.Flag.Int("parallel", 4, "the number of hosts to copy to at the same time") //nolint:mnd
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runUpload(env, cmd, args, flags, *parallel)
+	}
+
+	return c
+}
+
+// uploadResult is a result of a host in the JSON output of the upload
+// command.
+type uploadResult struct {
+	Host  string `json:"host"`
+	Error string `json:"error,omitempty"`
+}
+
+func runUpload(env *command.Env, cmd *command.Command, args []string, flags *sshFlags, parallel int) int {
+	if len(args) != 3 { //nolint:mnd
+		return env.UsageError(cmd)
+	}
+
+	hosts, err := parseHosts(args[0])
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error parsing the hosts: %v", err)
+	}
+
+	config, err := flags.config(env)
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error: %v", err)
+	}
+
+	dir, remoteDir := env.Path(args[1]), args[2]
+
+	results := remote.ForEach(env.Context, hosts, config, parallel, func(ctx context.Context, _ int, c *remote.Client) error {
+		return c.Upload(ctx, dir, remoteDir)
+	})
+
+	data := make([]uploadResult, 0, len(results))
+	code := command.ExitSuccess
+
+	for _, r := range results {
+		res := uploadResult{Host: r.Host.String(), Error: ""}
+		if r.Err != nil {
+			res.Error = r.Err.Error()
+			code = command.ExitFailure
+		}
+
+		data = append(data, res)
+	}
+
+	if rc := env.Render("remote-upload", data, func(w io.Writer) {
+		for _, r := range data {
+			if r.Error != "" {
+				fmt.Fprintf(w, "%s: failed\n\t%s\n", r.Host, r.Error)
+
+				continue
+			}
+
+			fmt.Fprintf(w, "%s: uploaded to %s\n", r.Host, remoteDir)
+		}
+	}); rc != command.ExitSuccess {
+		return rc
+	}
+
+	return code
+}
@@ -0,0 +1,164 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/selfupdate"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/settings"
+)
+
+// Command returns the self-update command.
+// The index and the public key are the default release index location and the
+// base64-encoded Ed25519 public key for verifying the releases.
+func Command(ver semver.Version, index, publicKey string) *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " self-update [-index location] [-public-key key] [-version version] [-prerelease] [-force] [-check]", //nolint:lll
+		Short:     "updates " + command.CommandName + " to the latest release",
+		Long: `Self-update downloads the latest release of ` + command.CommandName + ` for the current platform
+from the release index and replaces the running executable with it.
+
+The release index is a JSON file that is read from an HTTP(S) URL or a local
+path given by the -index flag. The downloaded binary is verified using the
+SHA-256 checksum and the Ed25519 signature from the index. The signature covers
+the version and the platform of the release together with the checksum, and it
+is verified with the public key that is set when ` + command.CommandName + ` is built. The
+-public-key flag sets the base64-encoded public key only if the build has none,
+so a different index can only serve the releases signed with the key of the
+build.
+
+The -version flag selects a specific version to install instead of the latest
+release. The -prerelease flag allows updating to pre-releases.
+
+Self-update refuses to downgrade or to reinstall the running version unless the
+-force flag is given.
+
+The -check flag only checks whether an update is available.`,
+		Flag:     command.DefaultFlagSet("self-update"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: nil,
+		Hidden:   false,
+	}
+
+	opts := &options{
+		index:      c.Flag.String("index", index, "the `location` of the release index"),
+		publicKey:  c.Flag.String("public-key", publicKey, "the base64-encoded Ed25519 public `key` for the releases if the build has none"), //nolint:lll
+		version:    nil,
+		prerelease: c.Flag.Bool("prerelease", false, "allow updating to pre-releases"),
+		force:      c.Flag.Bool("force", false, "allow downgrading and reinstalling the current version"),
+		check:      c.Flag.Bool("check", false, "only check whether an update is available"),
+	}
+
+	// The project configuration must not choose where the releases come from
+	// or which of them are trusted.
+	settings.UserOnly(c.Flag, "index", "public-key", "force")
+
+	c.Flag.Func("version", "install the given `version` instead of the latest release", func(s string) error {
+		v, err := semver.Parse(s)
+		if err != nil {
+			return fmt.Errorf("failed to parse the version: %w", err)
+		}
+
+		opts.version = &v
+
+		return nil
+	})
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runSelfUpdate(env, cmd, args, ver, publicKey, opts)
+	}
+
+	return c
+}
+
+type options struct {
+	index      *string
+	publicKey  *string
+	version    *semver.Version
+	prerelease *bool
+	force      *bool
+	check      *bool
+}
+
+// runSelfUpdate runs the self-update command. The buildKey is the public key
+// set in the build, and it cannot be replaced with the -public-key flag.
+func runSelfUpdate(env *command.Env, cmd *command.Command, args []string, ver semver.Version, buildKey string, opts *options) int { //nolint:lll
+	if len(args) > 0 {
+		return env.UsageError(cmd)
+	}
+
+	if buildKey != "" && *opts.publicKey != buildKey {
+		return env.Errorf(command.ExitInvalidArgs, "Error: the public key for verifying the releases is set in the build and cannot be changed") //nolint:lll
+	}
+
+	if *opts.index == "" {
+		return env.Errorf(command.ExitInvalidArgs, "Error: no release index given, use the -index flag")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(*opts.publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return env.Errorf(command.ExitInvalidArgs, "Error: no valid public key for verifying the releases given, use the -public-key flag")
+	}
+
+	result, err := selfupdate.Update(env.Context, selfupdate.Options{
+		Client:     nil,
+		Index:      *opts.index,
+		PublicKey:  key,
+		Current:    ver,
+		Version:    opts.version,
+		Prerelease: *opts.prerelease,
+		Force:      *opts.force,
+		CheckOnly:  *opts.check,
+		Executable: "",
+		GOOS:       "",
+		GOARCH:     "",
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Error updating %s: %v", command.CommandName, err)
+		if errors.Is(err, selfupdate.ErrDowngrade) {
+			msg += "\nUse the -force flag to downgrade"
+		}
+
+		return env.Errorf(command.ExitFailure, "%s", msg)
+	}
+
+	data := updateData{
+		Current:   ver.FullString(),
+		Release:   result.Release.Version.FullString(),
+		Available: result.Available,
+		Updated:   result.Updated,
+	}
+
+	return env.Render("self-update", data, func(w io.Writer) {
+		switch {
+		case result.Updated:
+			fmt.Fprintf(w, "Updated %s from %+v to %+v\n", command.CommandName, ver, result.Release.Version)
+		case result.Available:
+			fmt.Fprintf(w, "Version %+v is available, running %+v\n", result.Release.Version, ver)
+		default:
+			fmt.Fprintf(w, "%s is up to date (%+v)\n", command.CommandName, ver)
+		}
+	})
+}
+
+// updateData is the JSON output of the self-update command.
+type updateData struct {
+	// Current is the running version.
+	Current string `json:"current"`
+
+	// Release is the version of the selected release.
+	Release string `json:"release"`
+
+	// Available reports whether an update is available.
+	Available bool `json:"available"`
+
+	// Updated reports whether the executable was replaced.
+	Updated bool `json:"updated"`
+}
@@ -0,0 +1,124 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxSuggestionDistance is the maximum edit distance between a mistyped name
+// and a suggested name.
+// For short names, the distance is limited to half of the length of the name.
+const maxSuggestionDistance = 2
+
+// SuggestCommands returns the names of the visible subcommands of c that the
+// user might have meant when typing the unknown command name n.
+// The suggestions are ordered by their similarity to n.
+func (c *Command) SuggestCommands(n string) []string {
+	var names []string
+
+	for _, cmd := range c.Commands {
+		if cmd.Hidden || !cmd.lookupable() {
+			continue
+		}
+
+		names = append(names, cmd.Name())
+		names = append(names, cmd.Aliases...)
+	}
+
+	return suggest(n, names)
+}
+
+// SuggestFlags returns the names of the flags in f that the user might have
+// meant when typing the unknown flag name n.
+// The suggestions are ordered by their similarity to n.
+func SuggestFlags(f *flag.FlagSet, n string) []string {
+	var names []string
+
+	f.VisitAll(func(fl *flag.Flag) {
+		names = append(names, fl.Name)
+	})
+
+	return suggest(n, names)
+}
+
+// PrintSuggestions prints the suggested names for a mistyped name to w.
+// The prefix is prepended to each of the suggestions.
+func PrintSuggestions(w io.Writer, prefix string, suggestions []string) {
+	switch len(suggestions) {
+	case 0:
+	case 1:
+		fmt.Fprintf(w, "Did you mean '%s%s'?\n", prefix, suggestions[0])
+	default:
+		fmt.Fprintln(w, "Did you mean one of these?")
+
+		for _, s := range suggestions {
+			fmt.Fprintf(w, "\t%s%s\n", prefix, s)
+		}
+	}
+}
+
+// suggest returns the candidates that are within the maximum edit distance of
+// n or that have n as their prefix, ordered by the edit distance.
+func suggest(n string, candidates []string) []string {
+	if n == "" {
+		return nil
+	}
+
+	type match struct {
+		name string
+		dist int
+	}
+
+	var matches []match
+
+	maxDist := min(maxSuggestionDistance, max(1, len(n)/2)) //nolint:mnd
+
+	for _, c := range candidates {
+		d := levenshtein(strings.ToLower(n), strings.ToLower(c))
+		if d <= maxDist || strings.HasPrefix(c, n) {
+			matches = append(matches, match{c, d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+
+	result := make([]string, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, m.name)
+	}
+
+	return result
+}
+
+// levenshtein returns the Levenshtein distance between a and b, that is the
+// number of single-character insertions, deletions, and substitutions needed
+// to turn a into b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(t)]
+}
@@ -0,0 +1,183 @@
+package version
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+// defaultVersionFile is the default version file that is rewritten by the bump
+// command.
+// It is the same file the main package embeds as the version information.
+const defaultVersionFile = "VERSION"
+
+// errNotIncreasing is returned when bumping does not result in a greater
+// version.
+var errNotIncreasing = errors.New("the new version is not greater than the current version")
+
+// components are the version components that the bump command accepts.
+var components = []string{"major", "minor", "patch", "prerelease", "release"} //nolint:gochecknoglobals
+
+func bumpCommand() *command.Command {
+	c := &command.Command{
+		Run:       nil,
+		UsageLine: command.CommandName + " version bump [-file path] [-pre identifiers] [-build identifiers] major|minor|patch|prerelease|release", //nolint:lll
+		Short:     "bumps the version in the version file",
+		Long: `Bump increments the version in the version file and writes the new version back
+to the file.
+
+The argument selects the component to increment: "major", "minor", or "patch"
+increment the corresponding component, "prerelease" increments the last numeric
+pre-release identifier (for example, from 1.2.0-rc.1 to 1.2.0-rc.2), and
+"release" turns a pre-release into the final version (for example, from
+1.2.0-rc.2 to 1.2.0). A pre-release of the component that is incremented is
+released instead of incrementing the component. The new version must be greater
+than the current version.
+
+The -file flag sets the path to the version file. It defaults to "VERSION"
+in the current directory.
+
+The -pre flag sets the pre-release identifiers of the new version, and the
+-build flag sets its build metadata. If the -pre flag is given with
+"prerelease" and the current version is not a pre-release, the patch version is
+incremented first (for example, from 1.2.0 to 1.2.1-rc).
+
+The prefix of the version in the file, such as "v", is kept.`,
+		Flag:     command.DefaultFlagSet("bump"),
+		Aliases:  nil,
+		Commands: nil,
+		Complete: func(_ *command.Env, args []string, _ string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+
+			return components
+		},
+		Hidden: false,
+	}
+
+	file := c.Flag.String("file", defaultVersionFile, "the `path` of the version file")
+	pre := c.Flag.String("pre", "", "set the pre-release `identifiers` of the new version")
+	build := c.Flag.String("build", "", "set the build `identifiers` of the new version")
+
+	c.Run = func(env *command.Env, cmd *command.Command, args []string) int {
+		return runBump(env, cmd, args, *file, *pre, *build)
+	}
+
+	return c
+}
+
+func runBump(env *command.Env, cmd *command.Command, args []string, file, pre, build string) int {
+	if len(args) != 1 {
+		return env.UsageError(cmd)
+	}
+
+	file = env.Path(file)
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return env.Errorf(command.ExitFailure, "Error reading the version file: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return env.Errorf(command.ExitFailure, "Error reading the version file: %v", err)
+	}
+
+	current, err := Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return env.Errorf(command.ExitFailure, "Error parsing the version in %s: %v", file, err)
+	}
+
+	next, err := bump(current, args[0], pre, build)
+	if err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error bumping the version: %v", err)
+	}
+
+	alog.Infof("Bumping the version in %s from %+v to %+v", file, current, next)
+
+	// The version is written back in the same form as it was read.
+	written := current.Prefix() + next.FullString()
+
+	if err = os.WriteFile(file, []byte(written+"\n"), info.Mode().Perm()); err != nil {
+		return env.Errorf(command.ExitFailure, "Error writing the version file: %v", err)
+	}
+
+	result := bumpData{File: file, Previous: current.Prefix() + current.FullString(), Version: written}
+
+	return env.Render("version-bump", result, func(w io.Writer) {
+		fmt.Fprintln(w, result.Version)
+	})
+}
+
+// bumpData is the JSON output of the bump command.
+type bumpData struct {
+	// File is the path of the version file.
+	File string `json:"file"`
+
+	// Previous is the version before bumping.
+	Previous string `json:"previous"`
+
+	// Version is the new version.
+	Version string `json:"version"`
+}
+
+// bump returns the version that results from bumping the given component of v
+// and setting the given pre-release and build identifiers.
+// It returns an error if the result is not greater than v.
+func bump(v semver.Version, component, pre, build string) (semver.Version, error) {
+	var (
+		next semver.Version
+		err  error
+	)
+
+	switch component {
+	case "major":
+		next = v.IncMajor()
+	case "minor":
+		next = v.IncMinor()
+	case "patch":
+		next = v.IncPatch()
+	case "prerelease":
+		// Setting the pre-release explicitly replaces the current one. A
+		// release is bumped first as its pre-releases precede it.
+		switch {
+		case pre != "" && v.Prerelease.IsZero():
+			next = v.IncPatch()
+		case pre != "":
+			next = v.Release()
+		default:
+			if next, err = v.IncPrerelease(); err != nil {
+				return semver.Version{}, fmt.Errorf("failed to bump the pre-release: %w", err)
+			}
+		}
+	case "release":
+		next = v.Release()
+	default:
+		return semver.Version{}, fmt.Errorf("unknown version component %q", component) //nolint:err113
+	}
+
+	if pre != "" {
+		if next, err = next.SetPrerelease(pre); err != nil {
+			return semver.Version{}, fmt.Errorf("failed to set the pre-release: %w", err)
+		}
+	}
+
+	if build != "" {
+		if next, err = next.SetBuild(build); err != nil {
+			return semver.Version{}, fmt.Errorf("failed to set the build metadata: %w", err)
+		}
+	}
+
+	if next.Compare(v) <= 0 {
+		return semver.Version{}, fmt.Errorf("%w: %v is not greater than %v", errNotIncreasing, next, v)
+	}
+
+	return next, nil
+}
@@ -0,0 +1,66 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+func TestBump(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in        string
+		component string
+		pre       string
+		build     string
+		out       string
+	}{
+		{"0.1.0-alpha", "prerelease", "", "", "0.1.0-alpha.1"},
+		{"0.1.0-alpha.1", "prerelease", "beta", "", "0.1.0-beta"},
+		{"1.2.0-rc.1", "prerelease", "", "", "1.2.0-rc.2"},
+		{"1.2.0-rc.2", "release", "", "", "1.2.0"},
+		{"1.2.0", "minor", "rc.1", "", "1.3.0-rc.1"},
+		{"1.2.0", "patch", "", "sha.19031c2", "1.2.1+sha.19031c2"},
+		{"1.2.0", "major", "", "", "2.0.0"},
+		{"1.2.0", "prerelease", "", "", ""},
+		{"1.2.0", "prerelease", "rc", "", "1.2.1-rc"},
+		{"1.2.0-rc.1", "prerelease", "alpha", "", ""},
+		{"1.2.0", "release", "", "", ""},
+		{"1.2.0", "minor", "01", "", ""},
+		{"1.2.0", "build", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		v, err := semver.Parse(tt.in)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.in, err)
+		}
+
+		got, err := bump(v, tt.component, tt.pre, tt.build)
+		if (err != nil) != (tt.out == "") {
+			t.Errorf("bump(%q, %q, %q, %q) error = %v", tt.in, tt.component, tt.pre, tt.build, err)
+
+			continue
+		}
+
+		if err == nil && got.FullString() != tt.out {
+			t.Errorf("bump(%q, %q, %q, %q) = %v, want %v", tt.in, tt.component, tt.pre, tt.build, got.FullString(), tt.out)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"1.2.0", "v1.2.0", "ager1.2.0", "agricola1.2.0"} {
+		v, err := Parse(s)
+		if err != nil || v.FullString() != "1.2.0" {
+			t.Errorf("Parse(%q) = %v, %v, want 1.2.0", s, v, err)
+		}
+	}
+
+	if _, err := Parse("x1.2.0"); err == nil {
+		t.Error(`Parse("x1.2.0") succeeded, want an error`)
+	}
+}
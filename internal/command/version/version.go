@@ -2,7 +2,7 @@ package version
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"runtime"
 	"strings"
 
@@ -10,22 +10,61 @@ import (
 	"github.com/anttikivi/agricola/internal/semver"
 )
 
+// Parse parses a version of the program. The version may be prefixed with
+// "ager", "agricola", or "v". It is used both for the version set during build
+// and for the version file of the bump command.
+func Parse(s string) (semver.Version, error) {
+	p := semver.Parser{Prefixes: []string{command.CommandName, "agricola", "v"}, CaseInsensitive: false, Lenient: false}
+
+	v, err := p.Parse(s)
+	if err != nil {
+		return semver.Version{}, fmt.Errorf("failed to parse the version: %w", err)
+	}
+
+	return v, nil
+}
+
 func Command(ver semver.Version) *command.Command {
 	c := &command.Command{
-		Run:       func(cmd *command.Command, args []string) int { return runVersion(cmd, args, ver) },
+		Run: func(env *command.Env, cmd *command.Command, args []string) int {
+			return runVersion(env, cmd, args, ver)
+		},
 		UsageLine: command.CommandName + " version",
 		Short:     "prints " + command.Name + " version",
 		Long:      fmt.Sprintf(`Version prints the version information of the %s binary.`, command.CommandName),
 		Flag:      command.DefaultFlagSet("version"),
-		Commands:  nil,
+		Aliases:   nil,
+		Commands:  []*command.Command{bumpCommand()},
+		Complete:  nil,
+		Hidden:    false,
 	}
-	c.Flag.Usage = func() { c.Usage() }
 
 	return c
 }
 
-func runVersion(_ *command.Command, _ []string, ver semver.Version) int {
-	fmt.Fprintln(os.Stdout, strings.ToLower(command.Name)+" version "+ver.String()+" "+runtime.GOOS+"/"+runtime.GOARCH)
+func runVersion(env *command.Env, cmd *command.Command, args []string, ver semver.Version) int {
+	// The command is only run with arguments if the first of them is not the
+	// name of a subcommand, so it is reported like an unknown command.
+	if len(args) > 0 {
+		var msg strings.Builder
+
+		fmt.Fprintf(&msg, "%s version %s: unknown command\n", command.CommandName, args[0])
+		command.PrintSuggestions(&msg, command.CommandName+" version ", cmd.SuggestCommands(args[0]))
+		fmt.Fprintf(&msg, "Run '%s help version' for usage", command.CommandName)
+
+		return env.Errorf(command.ExitCommandNotFound, "%s", msg.String())
+	}
+
+	data := versionData{Version: ver.FullString(), GOOS: runtime.GOOS, GOARCH: runtime.GOARCH}
+
+	return env.Render("version", data, func(w io.Writer) {
+		fmt.Fprintln(w, strings.ToLower(command.Name)+" version "+data.Version+" "+data.GOOS+"/"+data.GOARCH)
+	})
+}
 
-	return command.ExitSuccess
+// versionData is the JSON output of the version command.
+type versionData struct {
+	Version string `json:"version"`
+	GOOS    string `json:"goos"`
+	GOARCH  string `json:"goarch"`
 }
@@ -0,0 +1,107 @@
+// Package compat checks that the running Agricola version is compatible with
+// the version requirements of the manifests and the state.
+package compat
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+// ErrIncompatible is the error that all of the errors returned by the checks in
+// this package wrap.
+var ErrIncompatible = errors.New("incompatible version")
+
+// A RequirementError is returned when the running version does not satisfy the
+// version requirement declared in a manifest or in the state.
+type RequirementError struct {
+	// Source is the file that declared the requirement.
+	Source string
+
+	// Running is the running version.
+	Running semver.Version
+
+	// Requirement is the declared requirement.
+	Requirement semver.Constraints
+}
+
+func (e *RequirementError) Error() string {
+	return fmt.Sprintf(
+		"%v: %s requires the version %q but the running version is %v",
+		ErrIncompatible,
+		e.Source,
+		e.Requirement,
+		e.Running,
+	)
+}
+
+func (e *RequirementError) Unwrap() error {
+	return ErrIncompatible
+}
+
+// A WriterError is returned when the running version is older than the version
+// that last wrote the state.
+type WriterError struct {
+	// Source is the state file.
+	Source string
+
+	// Running is the running version.
+	Running semver.Version
+
+	// Writer is the version that last wrote the state.
+	Writer semver.Version
+}
+
+func (e *WriterError) Error() string {
+	return fmt.Sprintf(
+		"%v: %s was last written by the version %v which is newer than the running version %v",
+		ErrIncompatible,
+		e.Source,
+		e.Writer,
+		e.Running,
+	)
+}
+
+func (e *WriterError) Unwrap() error {
+	return ErrIncompatible
+}
+
+// CheckRequirement checks that the running version satisfies the version
+// requirement declared in source.
+// The requirement uses the syntax of semver.ParseConstraints, for example
+// ">=0.3.0, <0.5.0".
+// An empty requirement allows every version.
+//
+// Pre-releases of the running version are compared as if they were the
+// corresponding release so that development builds are not rejected by
+// requirements like ">=0.3.0".
+func CheckRequirement(source string, running semver.Version, requirement string) error {
+	if requirement == "" {
+		return nil
+	}
+
+	c, err := semver.ParseConstraints(requirement)
+	if err != nil {
+		return fmt.Errorf("failed to parse the version requirement in %s: %w", source, err)
+	}
+
+	if c.Check(running) || c.Check(running.Release()) {
+		return nil
+	}
+
+	return &RequirementError{Source: source, Running: running, Requirement: c}
+}
+
+// CheckWriter checks that the running version may write the state in source
+// that was last written by the version writer.
+// The state must not be written by a version older than the one that last
+// wrote it as the older version may not know about the data the newer version
+// stored.
+func CheckWriter(source string, running, writer semver.Version) error {
+	if running.Compare(writer) < 0 {
+		return &WriterError{Source: source, Running: running, Writer: writer}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package compat_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/compat"
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+func mustParse(t *testing.T, s string) semver.Version {
+	t.Helper()
+
+	v, err := semver.Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", s, err)
+	}
+
+	return v
+}
+
+func TestCheckRequirement(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		running     string
+		requirement string
+		want        bool
+	}{
+		{"0.1.0", "", true},
+		{"0.3.0", ">=0.3.0, <0.5.0", true},
+		{"0.4.2+sha.19031c2", ">=0.3.0, <0.5.0", true},
+		{"0.2.9", ">=0.3.0, <0.5.0", false},
+		{"0.5.0", ">=0.3.0, <0.5.0", false},
+		{"0.3.0-alpha.1", ">=0.3.0", true},
+		{"0.5.0-rc.1", ">=0.3.0, <0.5.0", false},
+	}
+
+	for _, tt := range tests {
+		err := compat.CheckRequirement("agricola.toml", mustParse(t, tt.running), tt.requirement)
+		if (err == nil) != tt.want {
+			t.Errorf("CheckRequirement(%q, %q) = %v, want ok = %v", tt.running, tt.requirement, err, tt.want)
+		}
+
+		var rerr *compat.RequirementError
+		if err != nil && (!errors.Is(err, compat.ErrIncompatible) || !errors.As(err, &rerr)) {
+			t.Errorf("CheckRequirement(%q, %q) = %v, want *RequirementError", tt.running, tt.requirement, err)
+		}
+	}
+
+	err := compat.CheckRequirement("agricola.toml", mustParse(t, "0.1.0"), ">=bad")
+	if err == nil || errors.Is(err, compat.ErrIncompatible) {
+		t.Errorf("CheckRequirement with an invalid requirement = %v, want a parse error", err)
+	}
+}
+
+func TestCheckWriter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		running string
+		writer  string
+		want    bool
+	}{
+		{"0.3.0", "0.3.0", true},
+		{"0.3.0+b", "0.3.0+a", true},
+		{"0.3.1", "0.3.0", true},
+		{"0.3.0", "0.3.1", false},
+		{"0.3.0-rc.1", "0.3.0", false},
+	}
+
+	for _, tt := range tests {
+		err := compat.CheckWriter("state.json", mustParse(t, tt.running), mustParse(t, tt.writer))
+		if (err == nil) != tt.want {
+			t.Errorf("CheckWriter(%q, %q) = %v, want ok = %v", tt.running, tt.writer, err, tt.want)
+		}
+
+		if err != nil && !errors.Is(err, compat.ErrIncompatible) {
+			t.Errorf("CheckWriter(%q, %q) = %v, want %v", tt.running, tt.writer, err, compat.ErrIncompatible)
+		}
+	}
+}
@@ -17,15 +17,33 @@ const segfault = 11
 // prints if multiple goroutines panic.
 var panicLock sync.Mutex //nolint:gochecknoglobals
 
-// handlePanic is called to recover from an internal panic.
+// HandlePanic is called to recover from an internal panic.
+// It prints the panic and writes a crash report before exiting the program.
+//
+// HandlePanic must be deferred directly. To handle the panics in other
+// goroutines, start them using Go.
 func HandlePanic() {
+	if r := recover(); r != nil {
+		crash(r)
+	}
+}
+
+// crash prints the panic value r and the stack, writes a crash report, and
+// exits the program.
+func crash(r any) {
 	panicLock.Lock()
 	defer panicLock.Unlock()
 
-	if r := recover(); r != nil {
-		fmt.Fprint(os.Stderr, command.Name, " crashed\n")
-		fmt.Fprint(os.Stderr, r, "\n")
-		debug.PrintStack()
-		os.Exit(segfault) //nolint:gocritic
+	fmt.Fprint(os.Stderr, command.Name, " crashed\n")
+	fmt.Fprint(os.Stderr, r, "\n")
+	debug.PrintStack()
+
+	if path, err := WriteReport(r); err != nil {
+		fmt.Fprintf(os.Stderr, "\nFailed to write the crash report: %v\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "\nA crash report was written to %s\n", path)
+		fmt.Fprintln(os.Stderr, "Please attach it when reporting the bug.")
 	}
+
+	os.Exit(segfault) //nolint:gocritic
 }
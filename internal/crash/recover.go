@@ -0,0 +1,164 @@
+package crash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/anttikivi/agricola/internal/alog"
+)
+
+// A Policy decides what happens when a panic is recovered in a goroutine
+// started with Go or in an HTTP handler wrapped with Middleware.
+type Policy int32
+
+const (
+	// Terminate makes the panics crash the program like the panics that are
+	// handled by HandlePanic.
+	Terminate Policy = iota
+
+	// Recover makes the program keep running after a panic.
+	// The panic is logged as an error and a crash report is written.
+	Recover
+)
+
+// policy is the current panic policy.
+var policy atomic.Int32 //nolint:gochecknoglobals
+
+// SetPolicy sets the policy for the panics in the goroutines started with Go
+// and in the HTTP handlers wrapped with Middleware.
+// The default policy is Terminate.
+// Long-running daemons may set the policy to Recover to keep serving after
+// a panic in a single request or worker.
+func SetPolicy(p Policy) {
+	policy.Store(int32(p))
+}
+
+// Go runs f in a new goroutine and routes a panic in it through the same
+// reporting path as HandlePanic.
+// Depending on the policy, the program either crashes or logs the panic and
+// keeps running.
+func Go(f func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				handleRecovered(r)
+			}
+		}()
+
+		f()
+	}()
+}
+
+// Middleware returns an HTTP handler that routes the panics in next through the
+// same reporting path as HandlePanic.
+// If the policy is Recover, the client receives an internal server error if
+// the response has not been started yet. A response that has been started,
+// that is its header has been written or its connection has been hijacked, is
+// left as it is.
+//
+// Panics with the value http.ErrAbortHandler are passed on as they are used to
+// abort the response on purpose.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		w := &startWriter{ResponseWriter: rw, started: false}
+
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			if err, ok := r.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(r)
+			}
+
+			handleRecovered(r)
+
+			if !w.started {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// errNotHijacker is returned when the response writer cannot be hijacked.
+var errNotHijacker = errors.New("the response writer does not support hijacking")
+
+// startWriter is a response writer that records whether the response has been
+// started.
+type startWriter struct {
+	http.ResponseWriter
+
+	started bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *startWriter) WriteHeader(code int) {
+	// The informational responses do not start the final response.
+	if code >= http.StatusOK {
+		w.started = true
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (w *startWriter) Write(b []byte) (int, error) {
+	w.started = true
+
+	return w.ResponseWriter.Write(b) //nolint:wrapcheck
+}
+
+// Flush implements http.Flusher.
+func (w *startWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.started = true
+
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *startWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errNotHijacker
+	}
+
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to hijack the connection: %w", err)
+	}
+
+	w.started = true
+
+	return conn, rw, nil
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController.
+func (w *startWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// handleRecovered handles the recovered panic value r according to the
+// current policy.
+func handleRecovered(r any) {
+	if Policy(policy.Load()) != Recover {
+		crash(r)
+	}
+
+	path, err := WriteReport(r)
+	if err != nil {
+		alog.ErrorDepthf(1, "Recovered from panic: %v (failed to write the crash report: %v)", r, err)
+
+		return
+	}
+
+	alog.ErrorDepthf(1, "Recovered from panic: %v (crash report: %s)", r, path)
+}
@@ -0,0 +1,104 @@
+package crash
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// The tests in this file modify the global policy so they must not be run in
+// parallel.
+
+func TestGoRecover(t *testing.T) { //nolint:paralleltest
+	dir := t.TempDir()
+
+	SetReportDir(dir)
+	SetPolicy(Recover)
+
+	t.Cleanup(func() { SetPolicy(Terminate) })
+
+	done := make(chan struct{})
+
+	Go(func() {
+		defer close(done)
+
+		panic("worker panic")
+	})
+
+	<-done
+
+	// The recovery runs after the deferred close so wait for the report.
+	for range 500 {
+		if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("no crash report was written for the recovered panic")
+}
+
+func TestMiddlewareRecover(t *testing.T) { //nolint:paralleltest
+	dir := t.TempDir()
+
+	SetReportDir(dir)
+	SetPolicy(Recover)
+
+	t.Cleanup(func() { SetPolicy(Terminate) })
+
+	h := Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("handler panic")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("crash reports = %v, want one report", entries)
+	}
+}
+
+func TestMiddlewareStartedResponse(t *testing.T) { //nolint:paralleltest
+	SetReportDir(t.TempDir())
+	SetPolicy(Recover)
+
+	t.Cleanup(func() { SetPolicy(Terminate) })
+
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+
+		panic("handler panic")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("response = %d %q, want the started response unchanged", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMiddlewareAbortHandler(t *testing.T) { //nolint:paralleltest
+	SetPolicy(Recover)
+
+	t.Cleanup(func() { SetPolicy(Terminate) })
+
+	h := Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler { //nolint:errorlint
+			t.Errorf("recovered %v, want %v", r, http.ErrAbortHandler)
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,213 @@
+package crash
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+// redacted replaces the sensitive values in the reported command-line
+// arguments.
+const redacted = "REDACTED"
+
+// maxStackSize is the maximum size of the goroutine stacks in the report.
+const maxStackSize = 1 << 20
+
+// sensitiveFlags are the substrings of flag names whose values are redacted
+// from the reported command-line arguments.
+var sensitiveFlags = []string{"password", "passwd", "secret", "token", "key", "credential", "auth"} //nolint:gochecknoglobals,lll
+
+// reportInfo holds the information about the program that is included in the
+// crash reports.
+var reportInfo struct { //nolint:gochecknoglobals
+	sync.Mutex
+
+	version    string
+	dir        string
+	isBoolFlag func(name string) bool
+}
+
+// SetVersion sets the program version that is included in the crash reports.
+func SetVersion(v string) {
+	reportInfo.Lock()
+	defer reportInfo.Unlock()
+
+	reportInfo.version = v
+}
+
+// SetReportDir sets the directory the crash reports are written to.
+// By default, the reports are written to the "agricola/crash" directory in
+// the user's cache directory, or in the temporary directory if the cache
+// directory cannot be determined.
+func SetReportDir(dir string) {
+	reportInfo.Lock()
+	defer reportInfo.Unlock()
+
+	reportInfo.dir = dir
+}
+
+// SetBoolFlags sets the function that reports whether the flag with the given
+// name is a boolean flag. The argument after a boolean flag is not its value,
+// so it is not redacted even if the name of the flag is sensitive.
+// By default, every flag is taken to have a value.
+func SetBoolFlags(isBoolFlag func(name string) bool) {
+	reportInfo.Lock()
+	defer reportInfo.Unlock()
+
+	reportInfo.isBoolFlag = isBoolFlag
+}
+
+// WriteReport writes a crash report for the panic value r to a file and
+// returns the path to the file.
+// The report contains the panic value, the stacks of all goroutines, the
+// version information, the runtime information, the sanitized command-line
+// arguments, and the most recent log lines.
+func WriteReport(r any) (string, error) {
+	now := time.Now()
+
+	reportInfo.Lock()
+	version, dir := reportInfo.version, reportInfo.dir
+	reportInfo.Unlock()
+
+	if version == "" {
+		version = "unknown"
+	}
+
+	if dir == "" {
+		dir = defaultReportDir()
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil { //nolint:mnd
+		return "", fmt.Errorf("failed to create the crash report directory: %w", err)
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s crash report\n\n", command.Name)
+	fmt.Fprintf(&sb, "Time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&sb, "Version: %s\n", version)
+	fmt.Fprintf(&sb, "Go version: %s\n", runtime.Version())
+	fmt.Fprintf(&sb, "OS/Arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&sb, "Arguments: %q\n\n", SanitizeArgs(os.Args))
+	fmt.Fprintf(&sb, "Panic: %v\n\n", r)
+	fmt.Fprintf(&sb, "Goroutines:\n\n%s\n", stacks())
+	sb.WriteString("Recent log lines:\n\n")
+
+	for _, line := range alog.RecentLines() {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+
+	name := fmt.Sprintf("%s-crash-%s-%d.txt", command.CommandName, now.Format("20060102T150405"), os.Getpid())
+	path := filepath.Join(dir, name)
+
+	if err := os.WriteFile(path, []byte(sb.String()), 0o600); err != nil { //nolint:mnd
+		return "", fmt.Errorf("failed to write the crash report: %w", err)
+	}
+
+	return path, nil
+}
+
+// defaultReportDir returns the default directory for the crash reports.
+func defaultReportDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return os.TempDir()
+	}
+
+	return filepath.Join(dir, strings.ToLower(command.Name), "crash")
+}
+
+// stacks returns the stacks of all goroutines.
+func stacks() []byte {
+	buf := make([]byte, 64<<10) //nolint:mnd
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackSize {
+			return buf[:n]
+		}
+
+		buf = make([]byte, 2*len(buf)) //nolint:mnd
+	}
+}
+
+// SanitizeArgs returns a copy of the command-line arguments with the values of
+// sensitive flags and the passwords in URLs redacted.
+// The arguments must be sanitized before they are logged, as the recent log
+// lines are included in the crash reports.
+func SanitizeArgs(args []string) []string {
+	reportInfo.Lock()
+	isBoolFlag := reportInfo.isBoolFlag
+	reportInfo.Unlock()
+
+	return sanitizeArgs(args, isBoolFlag)
+}
+
+// sanitizeArgs sanitizes args like SanitizeArgs with the given function for
+// checking whether a flag is a boolean flag.
+func sanitizeArgs(args []string, isBoolFlag func(name string) bool) []string {
+	result := make([]string, len(args))
+
+	redactNext := false
+
+	for i, arg := range args {
+		switch {
+		case redactNext:
+			result[i] = redacted
+			redactNext = false
+		case strings.HasPrefix(arg, "-") && arg != "-" && arg != "--":
+			name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if !isSensitive(name) {
+				result[i] = arg
+			} else if hasValue {
+				result[i] = arg[:strings.Index(arg, "=")+1] + redacted
+			} else {
+				result[i] = arg
+				redactNext = isBoolFlag == nil || !isBoolFlag(name)
+			}
+		default:
+			result[i] = redactURL(arg)
+		}
+	}
+
+	return result
+}
+
+func isSensitive(flagName string) bool {
+	flagName = strings.ToLower(flagName)
+
+	for _, s := range sensitiveFlags {
+		if strings.Contains(flagName, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactURL redacts the password from s if it is a URL with a password.
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+
+	return u.Redacted()
+}
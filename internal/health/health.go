@@ -0,0 +1,293 @@
+// Package health implements the health checks of the upstreams.
+//
+// A Checker runs a Probe periodically and turns the results into a Status
+// with thresholds like the Docker HEALTHCHECK: the upstream becomes healthy
+// after the healthy threshold of consecutive successful checks and unhealthy
+// after the unhealthy threshold of consecutive failed checks. The failures
+// during the start period are not counted while the upstream is still
+// starting. The rollouts wait for the upstreams to become healthy with Wait,
+// and the upstreams of the proxy follow the status of a Checker through
+// OnChange.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/alog"
+)
+
+// The default values of the Config fields.
+const (
+	DefaultInterval           = 5 * time.Second
+	DefaultTimeout            = 3 * time.Second
+	DefaultHealthyThreshold   = 1
+	DefaultUnhealthyThreshold = 3
+)
+
+// ErrUnhealthy is returned when an upstream becomes unhealthy.
+var ErrUnhealthy = errors.New("unhealthy")
+
+// A Probe checks the health of an upstream once.
+// It returns nil if the upstream is healthy.
+type Probe interface {
+	Check(ctx context.Context) error
+}
+
+// ProbeFunc is an adapter to use a function as a Probe.
+type ProbeFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f ProbeFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Config is the configuration of the health checks.
+// The zero values of the fields are replaced with the defaults.
+type Config struct {
+	// Interval is the time between the checks.
+	Interval time.Duration
+
+	// Timeout is the time after which a single check fails.
+	Timeout time.Duration
+
+	// StartPeriod is the time after the start during which the failed checks
+	// are not counted while the upstream is starting.
+	StartPeriod time.Duration
+
+	// HealthyThreshold is the number of the consecutive successful checks
+	// after which the upstream is healthy.
+	HealthyThreshold int
+
+	// UnhealthyThreshold is the number of the consecutive failed checks after
+	// which the upstream is unhealthy.
+	UnhealthyThreshold int
+}
+
+// withDefaults returns c with the zero values replaced with the defaults.
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	if c.HealthyThreshold < 1 {
+		c.HealthyThreshold = DefaultHealthyThreshold
+	}
+
+	if c.UnhealthyThreshold < 1 {
+		c.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+
+	return c
+}
+
+// A Status is the health status of an upstream.
+type Status int
+
+const (
+	// StatusStarting is the status of an upstream that has not yet reached
+	// either of the thresholds.
+	StatusStarting Status = iota
+	StatusHealthy
+	StatusUnhealthy
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusStarting:
+		return "starting"
+	case StatusHealthy:
+		return "healthy"
+	case StatusUnhealthy:
+		return "unhealthy"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// A Checker tracks the health of a single upstream.
+type Checker struct {
+	name   string
+	probe  Probe
+	config Config
+
+	mu        sync.Mutex
+	status    Status
+	successes int
+	failures  int
+	started   time.Time
+	lastErr   error
+	listeners []func(Status)
+}
+
+// NewChecker returns a Checker for the upstream with the given name that
+// checks it with probe.
+func NewChecker(name string, probe Probe, c Config) *Checker {
+	return &Checker{
+		name:      name,
+		probe:     probe,
+		config:    c.withDefaults(),
+		mu:        sync.Mutex{},
+		status:    StatusStarting,
+		successes: 0,
+		failures:  0,
+		started:   time.Time{},
+		lastErr:   nil,
+		listeners: nil,
+	}
+}
+
+// Status returns the current status and the error of the latest failed check.
+func (c *Checker) Status() (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.status, c.lastErr
+}
+
+// OnChange registers fn to be called with the new status every time the
+// status changes.
+// The function is called synchronously from the goroutine that runs the
+// checks, so it must not block.
+func (c *Checker) OnChange(fn func(Status)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.listeners = append(c.listeners, fn)
+}
+
+// Run checks the upstream immediately and then after every interval until ctx
+// is canceled. A check that is interrupted by the cancellation is not
+// observed, so stopping the checker does not count as a failure.
+func (c *Checker) Run(ctx context.Context) {
+	c.mu.Lock()
+	c.started = time.Now()
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		err := c.check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.Observe(err, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs the probe once with the timeout.
+func (c *Checker) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	return c.probe.Check(ctx)
+}
+
+// Observe records the result err of a check made at now and returns the
+// resulting status.
+// Run calls it for every check, and it can be called directly to feed the
+// results of checks made elsewhere.
+func (c *Checker) Observe(err error, now time.Time) Status {
+	c.mu.Lock()
+
+	if c.started.IsZero() {
+		c.started = now
+	}
+
+	prev := c.status
+
+	if err == nil {
+		c.successes++
+		c.failures = 0
+		c.lastErr = nil
+
+		if c.successes >= c.config.HealthyThreshold {
+			c.status = StatusHealthy
+		}
+	} else {
+		c.successes = 0
+		c.lastErr = err
+
+		// The failures during the start period do not count until the
+		// upstream has been healthy once.
+		if c.status != StatusStarting || now.Sub(c.started) >= c.config.StartPeriod {
+			c.failures++
+		}
+
+		if c.failures >= c.config.UnhealthyThreshold {
+			c.status = StatusUnhealthy
+		}
+	}
+
+	status := c.status
+	listeners := c.listeners
+
+	c.mu.Unlock()
+
+	if status != prev {
+		if err != nil {
+			alog.Warningf("%s is %s: %v", c.name, status, err)
+		} else {
+			alog.Infof("%s is %s", c.name, status)
+		}
+
+		for _, fn := range listeners {
+			fn(status)
+		}
+	}
+
+	return status
+}
+
+// Wait checks the upstream with probe until it becomes healthy or unhealthy.
+// It returns nil if the upstream becomes healthy. Otherwise it returns an
+// error that wraps ErrUnhealthy and the error of the latest check, or the
+// cause of the cancellation of ctx.
+func Wait(ctx context.Context, name string, probe Probe, c Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	checker := NewChecker(name, probe, c)
+	result := make(chan Status, 1)
+
+	checker.OnChange(func(s Status) {
+		if s == StatusHealthy || s == StatusUnhealthy {
+			select {
+			case result <- s:
+			default:
+			}
+
+			cancel()
+		}
+	})
+
+	checker.Run(ctx)
+
+	select {
+	case s := <-result:
+		if s == StatusHealthy {
+			return nil
+		}
+
+		_, err := checker.Status()
+
+		return fmt.Errorf("%s is %w: %w", name, ErrUnhealthy, err)
+	default:
+		return context.Cause(ctx) //nolint:wrapcheck
+	}
+}
@@ -0,0 +1,269 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/health"
+)
+
+var errCheck = errors.New("check failed")
+
+func TestCheckerThresholds(t *testing.T) {
+	t.Parallel()
+
+	c := health.NewChecker("app", nil, health.Config{
+		Interval:           time.Second,
+		Timeout:            time.Second,
+		StartPeriod:        10 * time.Second,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	})
+
+	var changes []health.Status
+
+	c.OnChange(func(s health.Status) { changes = append(changes, s) })
+
+	start := time.Now()
+	steps := []struct {
+		err   error
+		at    time.Duration
+		wantS health.Status
+	}{
+		// The failures during the start period are not counted.
+		{errCheck, 0, health.StatusStarting},
+		{errCheck, 5 * time.Second, health.StatusStarting},
+		{nil, 6 * time.Second, health.StatusStarting},
+		{nil, 7 * time.Second, health.StatusHealthy},
+		{errCheck, 8 * time.Second, health.StatusHealthy},
+		{nil, 9 * time.Second, health.StatusHealthy},
+		{errCheck, 11 * time.Second, health.StatusHealthy},
+		{errCheck, 12 * time.Second, health.StatusUnhealthy},
+		{nil, 13 * time.Second, health.StatusUnhealthy},
+		{nil, 14 * time.Second, health.StatusHealthy},
+	}
+
+	for i, s := range steps {
+		if got := c.Observe(s.err, start.Add(s.at)); got != s.wantS {
+			t.Errorf("step %d: Observe() = %v, want %v", i, got, s.wantS)
+		}
+	}
+
+	want := []health.Status{health.StatusHealthy, health.StatusUnhealthy, health.StatusHealthy}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The probe is interrupted by stopping the checker.
+	c := health.NewChecker("app", health.ProbeFunc(func(ctx context.Context) error {
+		cancel()
+
+		return ctx.Err()
+	}), health.Config{
+		Interval:           time.Millisecond,
+		Timeout:            time.Second,
+		StartPeriod:        0,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+
+	var changes []health.Status
+
+	c.OnChange(func(s health.Status) { changes = append(changes, s) })
+	c.Run(ctx)
+
+	if s, err := c.Status(); s != health.StatusStarting || err != nil {
+		t.Errorf("Status() = %v, %v, want %v, nil", s, err, health.StatusStarting)
+	}
+
+	if len(changes) > 0 {
+		t.Errorf("changes = %v, want none", changes)
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+
+	config := health.Config{
+		Interval:           time.Millisecond,
+		Timeout:            time.Second,
+		StartPeriod:        0,
+		HealthyThreshold:   3,
+		UnhealthyThreshold: 2,
+	}
+
+	var calls atomic.Int32
+
+	healthy := health.ProbeFunc(func(context.Context) error {
+		calls.Add(1)
+
+		return nil
+	})
+
+	if err := health.Wait(context.Background(), "app", healthy, config); err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+
+	if n := calls.Load(); n != 3 {
+		t.Errorf("the probe was called %d times, want 3", n)
+	}
+
+	unhealthy := health.ProbeFunc(func(context.Context) error { return errCheck })
+
+	err := health.Wait(context.Background(), "app", unhealthy, config)
+	if !errors.Is(err, health.ErrUnhealthy) || !errors.Is(err, errCheck) {
+		t.Errorf("Wait() = %v, want an error wrapping %v and %v", err, health.ErrUnhealthy, errCheck)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := health.Wait(ctx, "app", unhealthy, config); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() with a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		fmt.Fprint(w, "status: ok")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		probe   health.HTTPProbe
+		wantErr bool
+	}{
+		{health.HTTPProbe{URL: srv.URL + "/up", Status: 0, Body: "", Client: nil}, false},
+		{health.HTTPProbe{URL: srv.URL + "/up", Status: http.StatusOK, Body: "ok", Client: nil}, false},
+		{health.HTTPProbe{URL: srv.URL + "/up", Status: 0, Body: "ready", Client: nil}, true},
+		{health.HTTPProbe{URL: srv.URL + "/up", Status: http.StatusNoContent, Body: "", Client: nil}, true},
+		{health.HTTPProbe{URL: srv.URL + "/down", Status: 0, Body: "", Client: nil}, true},
+		{health.HTTPProbe{URL: srv.URL + "/down", Status: http.StatusServiceUnavailable, Body: "", Client: nil}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.probe.Check(context.Background()); (err != nil) != tt.wantErr {
+			t.Errorf("Check() with %+v = %v, want error: %v", tt.probe, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ln.Addr().String()
+	p := &health.TCPProbe{Address: addr}
+
+	if err = p.Check(context.Background()); err != nil {
+		t.Errorf("Check() of a listening address = %v", err)
+	}
+
+	ln.Close()
+
+	if err = p.Check(context.Background()); err == nil {
+		t.Error("Check() of a closed address succeeded")
+	}
+}
+
+// fakeDocker is a stand-in for the Docker client. It runs the commands given
+// to "docker exec" locally and prints the health in $HEALTH for
+// "docker inspect".
+const fakeDocker = `#!/bin/sh
+case "$1" in
+exec) shift 2; exec "$@" ;;
+inspect) printf '%s\n' "$HEALTH" ;;
+*) echo "unknown command $1" >&2; exit 1 ;;
+esac
+`
+
+func newFakeDocker(t *testing.T, healthJSON string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake Docker client is a shell script")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker")
+	script := "#!/bin/sh\nHEALTH='" + healthJSON + "'\n" + fakeDocker[len("#!/bin/sh\n"):]
+
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestExecProbe(t *testing.T) {
+	t.Parallel()
+
+	docker := newFakeDocker(t, "null")
+
+	if err := (&health.ExecProbe{Docker: docker, Runner: nil, Container: "app", Command: []string{"true"}}).Check(context.Background()); err != nil {
+		t.Errorf("Check() of a successful command = %v", err)
+	}
+
+	if err := (&health.ExecProbe{Docker: docker, Runner: nil, Container: "app", Command: []string{"false"}}).Check(context.Background()); err == nil {
+		t.Error("Check() of a failing command succeeded")
+	}
+}
+
+func TestDockerProbe(t *testing.T) {
+	t.Parallel()
+
+	healthy := health.ProbeFunc(func(context.Context) error { return nil })
+
+	tests := []struct {
+		name     string
+		health   string
+		fallback health.Probe
+		wantErr  bool
+	}{
+		{"healthy", `{"Status":"healthy","Log":[]}`, nil, false},
+		{"unhealthy", `{"Status":"unhealthy","Log":[{"ExitCode":1,"Output":"down"}]}`, healthy, true},
+		{"starting", `{"Status":"starting","Log":[]}`, nil, true},
+		{"fallback", `null`, healthy, false},
+	}
+
+	for _, tt := range tests {
+		p := &health.DockerProbe{Docker: newFakeDocker(t, tt.health), Runner: nil, Container: "app", Fallback: tt.fallback}
+
+		if err := p.Check(context.Background()); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Check() = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	p := &health.DockerProbe{Docker: newFakeDocker(t, "null"), Runner: nil, Container: "app", Fallback: nil}
+	if err := p.Check(context.Background()); !errors.Is(err, health.ErrNoHealthcheck) {
+		t.Errorf("Check() without a health check = %v, want %v", err, health.ErrNoHealthcheck)
+	}
+}
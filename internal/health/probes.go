@@ -0,0 +1,232 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+// defaultDocker is the Docker client that is run if no other is configured.
+const defaultDocker = "docker"
+
+// maxBody is the maximum number of the bytes of the response body that are
+// read for the body match of an HTTP probe.
+const maxBody = 64 << 10
+
+// ErrNoHealthcheck is returned by a DockerProbe when the container has no
+// HEALTHCHECK and the probe has no fallback.
+var ErrNoHealthcheck = errors.New("the container has no health check")
+
+// A DockerRunner runs the Docker client with args and returns its standard
+// output. It lets the Docker probes run the client elsewhere, for example on a
+// remote host.
+type DockerRunner func(ctx context.Context, args ...string) ([]byte, error)
+
+// HTTPProbe checks the upstream with an HTTP GET request.
+type HTTPProbe struct {
+	// URL is the URL to request.
+	URL string
+
+	// Status is the expected status code of the response. If it is zero,
+	// every 2xx and 3xx status is accepted.
+	Status int
+
+	// Body is a string the response body must contain. If it is empty, the
+	// body is not checked.
+	Body string
+
+	// Client is the HTTP client to use. If it is nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+}
+
+// Check implements Probe.
+func (p *HTTPProbe) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create the request: %w", err)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request %s: %w", p.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if p.Status != 0 && resp.StatusCode != p.Status {
+		return fmt.Errorf("%s returned the status %d, want %d", p.URL, resp.StatusCode, p.Status)
+	}
+
+	if p.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 400) {
+		return fmt.Errorf("%s returned the status %d", p.URL, resp.StatusCode)
+	}
+
+	if p.Body == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return fmt.Errorf("failed to read the response from %s: %w", p.URL, err)
+	}
+
+	if !bytes.Contains(body, []byte(p.Body)) {
+		return fmt.Errorf("the response from %s does not contain %q", p.URL, p.Body)
+	}
+
+	return nil
+}
+
+// TCPProbe checks that a TCP connection to the upstream can be opened.
+type TCPProbe struct {
+	// Address is the address to connect to in the form "host:port".
+	Address string
+}
+
+// Check implements Probe.
+func (p *TCPProbe) Check(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", p.Address, err)
+	}
+
+	return conn.Close() //nolint:wrapcheck
+}
+
+// ExecProbe checks the upstream by running a command in its container.
+// The upstream is healthy if the command exits with the status zero.
+type ExecProbe struct {
+	// Docker is the Docker client to run. If it is empty, "docker" is run
+	// from PATH.
+	Docker string
+
+	// Runner runs the Docker client instead of running Docker locally if it
+	// is set.
+	Runner DockerRunner
+
+	// Container is the name or the ID of the container.
+	Container string
+
+	// Command is the command to run in the container.
+	Command []string
+}
+
+// Check implements Probe.
+func (p *ExecProbe) Check(ctx context.Context) error {
+	args := append([]string{"exec", p.Container}, p.Command...)
+
+	if _, err := runDocker(ctx, p.Docker, p.Runner, args...); err != nil {
+		return fmt.Errorf("the command %q failed in %s: %w", strings.Join(p.Command, " "), p.Container, err)
+	}
+
+	return nil
+}
+
+// DockerProbe checks the upstream by reading the status of the HEALTHCHECK of
+// its container.
+type DockerProbe struct {
+	// Docker is the Docker client to run. If it is empty, "docker" is run
+	// from PATH.
+	Docker string
+
+	// Runner runs the Docker client instead of running Docker locally if it
+	// is set.
+	Runner DockerRunner
+
+	// Container is the name or the ID of the container.
+	Container string
+
+	// Fallback is the probe that is used if the container has no
+	// HEALTHCHECK. If it is nil, the check fails with ErrNoHealthcheck.
+	Fallback Probe
+}
+
+// dockerHealth is the health of a container reported by "docker inspect".
+type dockerHealth struct {
+	Status string `json:"Status"` //nolint:tagliatelle
+	Log    []struct {
+		ExitCode int    `json:"ExitCode"` //nolint:tagliatelle
+		Output   string `json:"Output"`   //nolint:tagliatelle
+	} `json:"Log"` //nolint:tagliatelle
+}
+
+// Check implements Probe.
+func (p *DockerProbe) Check(ctx context.Context) error {
+	out, err := runDocker(ctx, p.Docker, p.Runner, "inspect", "--format", "{{json .State.Health}}", p.Container)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", p.Container, err)
+	}
+
+	var h *dockerHealth
+	if err = json.Unmarshal(out, &h); err != nil {
+		return fmt.Errorf("failed to parse the health of %s: %w", p.Container, err)
+	}
+
+	if h == nil {
+		if p.Fallback == nil {
+			return fmt.Errorf("%s: %w", p.Container, ErrNoHealthcheck)
+		}
+
+		return p.Fallback.Check(ctx)
+	}
+
+	if h.Status == "healthy" {
+		return nil
+	}
+
+	if len(h.Log) > 0 {
+		last := h.Log[len(h.Log)-1]
+
+		return fmt.Errorf( //nolint:err113
+			"the health check of %s is %s: exit status %d: %s",
+			p.Container,
+			h.Status,
+			last.ExitCode,
+			strings.TrimSpace(last.Output),
+		)
+	}
+
+	return fmt.Errorf("the health check of %s is %s", p.Container, h.Status) //nolint:err113
+}
+
+// runDocker runs the Docker client program with args, or runner if it is set,
+// and returns its standard output.
+func runDocker(ctx context.Context, program string, runner DockerRunner, args ...string) ([]byte, error) {
+	if runner != nil {
+		return runner(ctx, args...)
+	}
+
+	if program == "" {
+		program = defaultDocker
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, program, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	return stdout.Bytes(), nil
+}
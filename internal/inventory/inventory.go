@@ -0,0 +1,204 @@
+// Package inventory implements the inventory file that defines the remote
+// hosts grouped into roles and the apps that are deployed to the roles.
+//
+// The inventory is a JSON file like the following:
+//
+//	{
+//	  "roles": {
+//	    "web": ["deploy@web1.example.com", "deploy@web2.example.com"],
+//	    "worker": ["deploy@worker1.example.com:2222"]
+//	  },
+//	  "apps": {
+//	    "blog": {"roles": ["web"], "batch_size": "25%"}
+//	  },
+//	  "requires_ager": ">=0.3.0, <0.5.0"
+//	}
+//
+// The optional "requires_ager" declares the versions of ager that may deploy
+// with the inventory.
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/anttikivi/agricola/internal/remote"
+	"github.com/anttikivi/agricola/internal/rollout"
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+// defaultFile is the path of the inventory file relative to the project
+// directory.
+const defaultFile = ".agricola/inventory.json"
+
+// ErrInvalid is returned when the inventory is not valid.
+var ErrInvalid = errors.New("invalid inventory")
+
+// DefaultPath returns the default path of the inventory file for the project
+// in projectDir.
+func DefaultPath(projectDir string) string {
+	return filepath.Join(projectDir, filepath.FromSlash(defaultFile))
+}
+
+// Inventory is the set of the remote hosts and the apps deployed to them.
+type Inventory struct {
+	// Roles are the hosts grouped by their roles, for example "web" or
+	// "worker". A host may have multiple roles.
+	Roles map[string][]remote.Host
+
+	// Apps are the apps by their names.
+	Apps map[string]App
+
+	// RequiresAger is the version requirement for the versions of ager that
+	// may use the inventory, for example ">=0.3.0, <0.5.0".
+	// An empty requirement allows every version.
+	RequiresAger string
+}
+
+// An App is an app that is deployed to the hosts of its roles.
+type App struct {
+	// Roles are the names of the roles the app is deployed to.
+	Roles []string
+
+	// BatchSize is the size of the batches the app is rolled out in.
+	BatchSize rollout.BatchSize
+}
+
+// file is the JSON encoding of the inventory.
+type file struct {
+	Roles map[string][]string `json:"roles"`
+	Apps  map[string]struct {
+		Roles     []string `json:"roles"`
+		BatchSize string   `json:"batch_size"`
+	} `json:"apps"`
+	RequiresAger string `json:"requires_ager"`
+}
+
+// Load reads the inventory from the file at path.
+func Load(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the inventory: %w", err)
+	}
+
+	inv, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return inv, nil
+}
+
+// Parse parses and validates the JSON-encoded inventory in data.
+func Parse(data []byte) (*Inventory, error) {
+	var f file
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+
+	if err := d.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse the inventory: %w", err)
+	}
+
+	if f.RequiresAger != "" {
+		if _, err := semver.ParseConstraints(f.RequiresAger); err != nil {
+			return nil, fmt.Errorf("%w: requires_ager: %w", ErrInvalid, err)
+		}
+	}
+
+	inv := &Inventory{
+		Roles:        make(map[string][]remote.Host, len(f.Roles)),
+		Apps:         make(map[string]App, len(f.Apps)),
+		RequiresAger: f.RequiresAger,
+	}
+
+	for role, addrs := range f.Roles {
+		if role == "" {
+			return nil, fmt.Errorf("%w: empty role name", ErrInvalid)
+		}
+
+		hosts := make([]remote.Host, 0, len(addrs))
+
+		for _, a := range addrs {
+			h, err := remote.ParseHost(a)
+			if err != nil {
+				return nil, fmt.Errorf("%w: role %q: %w", ErrInvalid, role, err)
+			}
+
+			hosts = append(hosts, h)
+		}
+
+		inv.Roles[role] = hosts
+	}
+
+	for name, a := range f.Apps {
+		if name == "" {
+			return nil, fmt.Errorf("%w: empty app name", ErrInvalid)
+		}
+
+		if len(a.Roles) == 0 {
+			return nil, fmt.Errorf("%w: app %q has no roles", ErrInvalid, name)
+		}
+
+		for _, r := range a.Roles {
+			if _, ok := inv.Roles[r]; !ok {
+				return nil, fmt.Errorf("%w: app %q has an undefined role %q", ErrInvalid, name, r)
+			}
+		}
+
+		size, err := rollout.ParseBatchSize(a.BatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("%w: app %q: %w", ErrInvalid, name, err)
+		}
+
+		inv.Apps[name] = App{Roles: a.Roles, BatchSize: size}
+	}
+
+	return inv, nil
+}
+
+// AppNames returns the names of the apps in the inventory in sorted order.
+func (inv *Inventory) AppNames() []string {
+	names := make([]string, 0, len(inv.Apps))
+	for n := range inv.Apps {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Hosts returns the hosts of the app with the given name in the order of its
+// roles.
+// A host that has multiple roles of the app is only returned once.
+// The boolean return value reports whether the app exists.
+func (inv *Inventory) Hosts(app string) ([]remote.Host, bool) {
+	a, ok := inv.Apps[app]
+	if !ok {
+		return nil, false
+	}
+
+	seen := make(map[remote.Host]bool)
+
+	var hosts []remote.Host
+
+	for _, r := range a.Roles {
+		for _, h := range inv.Roles[r] {
+			if seen[h] {
+				continue
+			}
+
+			seen[h] = true
+
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts, true
+}
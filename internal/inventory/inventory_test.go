@@ -0,0 +1,86 @@
+package inventory_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/inventory"
+	"github.com/anttikivi/agricola/internal/remote"
+	"github.com/anttikivi/agricola/internal/rollout"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	inv, err := inventory.Parse([]byte(`{
+  "roles": {
+    "web": ["deploy@web1", "deploy@web2"],
+    "worker": ["deploy@worker1:2222", "deploy@web2"]
+  },
+  "apps": {
+    "blog": {"roles": ["web"], "batch_size": "50%"},
+    "jobs": {"roles": ["worker", "web"]}
+  },
+  "requires_ager": ">=0.3.0"
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := inv.AppNames(), []string{"blog", "jobs"}; !slices.Equal(got, want) {
+		t.Errorf("AppNames() = %v, want %v", got, want)
+	}
+
+	if inv.RequiresAger != ">=0.3.0" {
+		t.Errorf("RequiresAger = %q, want %q", inv.RequiresAger, ">=0.3.0")
+	}
+
+	if got, want := inv.Apps["blog"].BatchSize, (rollout.BatchSize{Hosts: 0, Percent: 50}); got != want {
+		t.Errorf("batch size of blog = %+v, want %+v", got, want)
+	}
+
+	hosts, ok := inv.Hosts("jobs")
+	if !ok {
+		t.Fatal("Hosts(\"jobs\") did not find the app")
+	}
+
+	want := []remote.Host{
+		{User: "deploy", Name: "worker1", Port: 2222},
+		{User: "deploy", Name: "web2", Port: 0},
+		{User: "deploy", Name: "web1", Port: 0},
+	}
+
+	if !slices.Equal(hosts, want) {
+		t.Errorf("Hosts(\"jobs\") = %v, want %v", hosts, want)
+	}
+
+	if _, ok := inv.Hosts("missing"); ok {
+		t.Error("Hosts(\"missing\") found an app")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"undefined role", `{"roles": {"web": ["web1"]}, "apps": {"blog": {"roles": ["worker"]}}}`},
+		{"no roles", `{"roles": {"web": ["web1"]}, "apps": {"blog": {"roles": []}}}`},
+		{"invalid host", `{"roles": {"web": ["web1:ssh"]}, "apps": {}}`},
+		{"invalid batch size", `{"roles": {"web": ["web1"]}, "apps": {"blog": {"roles": ["web"], "batch_size": "0%"}}}`},
+		{"invalid requirement", `{"roles": {}, "apps": {}, "requires_ager": "newer"}`},
+	}
+
+	for _, tt := range tests {
+		if _, err := inventory.Parse([]byte(tt.data)); !errors.Is(err, inventory.ErrInvalid) {
+			t.Errorf("%s: Parse() error = %v, want %v", tt.name, err, inventory.ErrInvalid)
+		}
+	}
+
+	if _, err := inventory.Parse([]byte(`{"hosts": []}`)); err == nil {
+		t.Error("Parse() accepted an unknown field")
+	}
+}
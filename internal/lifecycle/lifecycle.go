@@ -0,0 +1,277 @@
+// Package lifecycle implements the signal handling and the graceful shutdown
+// of the ager commands.
+//
+// A command receives a context that is canceled when the program receives an
+// interrupt or a termination signal.
+// The command can register shutdown hooks that are run in the reverse order of
+// their registration when the command returns, and reload hooks that are run
+// when the program receives SIGHUP. SIGHUP is only handled after a reload hook
+// has been registered so that it otherwise terminates the program as usual.
+// A second interrupt or termination signal exits the program immediately.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+// DefaultTimeout is the timeout for the shutdown hooks that are registered
+// without a timeout.
+const DefaultTimeout = 10 * time.Second
+
+// ErrForced is the cause of the context cancellation when the shutdown is
+// forced.
+var ErrForced = errors.New("forced shutdown")
+
+// ErrInterrupted is the cause of the context cancellation when the program
+// receives an interrupt or a termination signal.
+var ErrInterrupted = errors.New("interrupted")
+
+// contextKey is the key for the Lifecycle in a context.
+type contextKey struct{}
+
+// A hook is a registered shutdown or reload function.
+type hook struct {
+	name    string
+	timeout time.Duration
+	fn      func(ctx context.Context) error
+}
+
+// A Lifecycle manages the signals and the shutdown of a single program run.
+type Lifecycle struct {
+	mu       sync.Mutex
+	shutdown []hook
+	reload   []hook
+	cancel   context.CancelCauseFunc
+	signals  chan os.Signal
+	done     chan struct{}
+	stopping bool
+	closed   bool
+
+	// exit is the function that is called for forcing the exit.
+	// It can be replaced in tests.
+	exit func(code int)
+}
+
+// New returns a new Lifecycle.
+func New() *Lifecycle {
+	return &Lifecycle{
+		mu:       sync.Mutex{},
+		shutdown: nil,
+		reload:   nil,
+		cancel:   nil,
+		signals:  make(chan os.Signal, 1),
+		done:     make(chan struct{}),
+		stopping: false,
+		closed:   false,
+		exit:     os.Exit,
+	}
+}
+
+// Start starts handling the signals and returns a context that is canceled on
+// the first interrupt or termination signal.
+// The returned context carries the Lifecycle so that the hooks can be
+// registered with the functions in this package.
+func (l *Lifecycle) Start(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(context.WithValue(parent, contextKey{}, l))
+
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+	l.mu.Lock()
+	l.cancel = cancel
+
+	if len(l.reload) > 0 {
+		signals = append(signals, syscall.SIGHUP)
+	}
+
+	l.mu.Unlock()
+
+	signal.Notify(l.signals, signals...)
+
+	go l.loop(ctx)
+
+	return ctx
+}
+
+// OnShutdown registers a shutdown hook.
+// The hooks are run in the reverse order of their registration when Shutdown
+// is called, and each hook receives a context that is canceled after its
+// timeout.
+// If timeout is zero, DefaultTimeout is used.
+func (l *Lifecycle) OnShutdown(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.shutdown = append(l.shutdown, hook{name: name, timeout: timeout, fn: fn})
+}
+
+// OnReload registers a reload hook.
+// The hooks are run in the order of their registration when the program
+// receives SIGHUP, for example to reload the configuration. Registering the
+// first hook starts the handling of SIGHUP.
+func (l *Lifecycle) OnReload(name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.reload = append(l.reload, hook{name: name, timeout: 0, fn: fn})
+
+	// Start subscribes to SIGHUP itself if the hook is registered before it.
+	if len(l.reload) == 1 && l.cancel != nil && !l.closed {
+		signal.Notify(l.signals, syscall.SIGHUP)
+	}
+}
+
+// Shutdown cancels the context returned by Start, runs the shutdown hooks, and
+// flushes the logs.
+// The signals are still handled while the hooks run so that an interrupt
+// during the shutdown hooks forces the exit, and the signal handling is
+// stopped after the hooks have finished.
+// Shutdown is safe to call multiple times, and only the first call has an
+// effect.
+func (l *Lifecycle) Shutdown() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+
+		return
+	}
+
+	l.closed = true
+	l.stopping = true
+	hooks := l.shutdown
+	cancel := l.cancel
+	l.mu.Unlock()
+
+	if cancel != nil {
+		cancel(context.Canceled)
+	}
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		runHook(context.Background(), hooks[i], "shutdown")
+	}
+
+	signal.Stop(l.signals)
+	close(l.done)
+
+	alog.Flush()
+}
+
+// loop handles the signals until the shutdown.
+func (l *Lifecycle) loop(ctx context.Context) {
+	for {
+		select {
+		case <-l.done:
+			return
+		case sig := <-l.signals:
+			l.handle(ctx, sig)
+		}
+	}
+}
+
+// handle handles a single signal.
+func (l *Lifecycle) handle(ctx context.Context, sig os.Signal) {
+	if sig == syscall.SIGHUP {
+		l.mu.Lock()
+		hooks := l.reload
+		l.mu.Unlock()
+
+		alog.Infof("Received %v, reloading", sig)
+
+		for _, h := range hooks {
+			runHook(ctx, h, "reload")
+		}
+
+		return
+	}
+
+	l.mu.Lock()
+	stopping := l.stopping
+	l.stopping = true
+	cancel := l.cancel
+	l.mu.Unlock()
+
+	if stopping {
+		alog.Warningf("Received %v again, forcing exit", sig)
+		fmt.Fprintln(os.Stderr, "Forcing exit")
+
+		if cancel != nil {
+			cancel(ErrForced)
+		}
+
+		alog.Flush()
+		l.exit(command.ExitInterrupted)
+
+		return
+	}
+
+	alog.Infof("Received %v, shutting down", sig)
+	fmt.Fprintln(os.Stderr, "Shutting down, interrupt again to force exit")
+
+	if cancel != nil {
+		cancel(fmt.Errorf("%w by %v", ErrInterrupted, sig))
+	}
+}
+
+// runHook runs the hook h and logs its failure.
+func runHook(parent context.Context, h hook, kind string) {
+	ctx := parent
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(parent, h.timeout)
+		defer cancel()
+	}
+
+	alog.V(1).Infof("Running the %s hook %q", kind, h.name)
+
+	if err := h.fn(ctx); err != nil {
+		alog.Errorf("The %s hook %q failed: %v", kind, h.name, err)
+	}
+}
+
+// FromContext returns the Lifecycle carried by ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Lifecycle {
+	l, _ := ctx.Value(contextKey{}).(*Lifecycle)
+
+	return l
+}
+
+// OnShutdown registers a shutdown hook to the Lifecycle carried by ctx.
+// It reports whether ctx carries a Lifecycle.
+func OnShutdown(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) error) bool {
+	l := FromContext(ctx)
+	if l == nil {
+		return false
+	}
+
+	l.OnShutdown(name, timeout, fn)
+
+	return true
+}
+
+// OnReload registers a reload hook to the Lifecycle carried by ctx.
+// It reports whether ctx carries a Lifecycle.
+func OnReload(ctx context.Context, name string, fn func(ctx context.Context) error) bool {
+	l := FromContext(ctx)
+	if l == nil {
+		return false
+	}
+
+	l.OnReload(name, fn)
+
+	return true
+}
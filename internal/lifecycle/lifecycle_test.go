@@ -0,0 +1,134 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	t.Parallel()
+
+	l := New()
+	ctx := l.Start(context.Background())
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+
+	record := func(name string) func(context.Context) error {
+		return func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("the hook %q has no deadline", name)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			order = append(order, name)
+
+			return nil
+		}
+	}
+
+	l.OnShutdown("first", 0, record("first"))
+	OnShutdown(ctx, "second", time.Second, record("second"))
+	l.OnShutdown("failing", 0, func(context.Context) error { return errors.New("test error") }) //nolint:err113
+	l.OnShutdown("third", 0, record("third"))
+
+	l.Shutdown()
+	l.Shutdown()
+
+	if want := []string{"third", "second", "first"}; !slices.Equal(order, want) {
+		t.Errorf("shutdown order = %v, want %v", order, want)
+	}
+
+	if ctx.Err() == nil {
+		t.Error("the context was not canceled on shutdown")
+	}
+}
+
+func TestShutdownHookTimeout(t *testing.T) {
+	t.Parallel()
+
+	l := New()
+	l.Start(context.Background())
+
+	var err error
+
+	l.OnShutdown("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		err = ctx.Err()
+
+		return err
+	})
+
+	l.Shutdown()
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hook context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSignals(t *testing.T) {
+	t.Parallel()
+
+	l := New()
+
+	var exitCode int
+
+	l.exit = func(code int) { exitCode = code }
+
+	ctx := l.Start(context.Background())
+	defer l.Shutdown()
+
+	reloaded := 0
+
+	OnReload(ctx, "config", func(context.Context) error {
+		reloaded++
+
+		return nil
+	})
+
+	l.handle(ctx, syscall.SIGHUP)
+
+	if reloaded != 1 || ctx.Err() != nil {
+		t.Fatalf("after SIGHUP: reloaded = %d, context error = %v", reloaded, ctx.Err())
+	}
+
+	l.handle(ctx, os.Interrupt)
+
+	if !errors.Is(context.Cause(ctx), ErrInterrupted) {
+		t.Errorf("context cause = %v, want %v", context.Cause(ctx), ErrInterrupted)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("the first interrupt exited with %d", exitCode)
+	}
+
+	l.handle(ctx, syscall.SIGTERM)
+
+	if exitCode != command.ExitInterrupted {
+		t.Errorf("exit code after the second signal = %d, want %d", exitCode, command.ExitInterrupted)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+
+	if FromContext(context.Background()) != nil {
+		t.Error("FromContext returned a lifecycle for an empty context")
+	}
+
+	if OnShutdown(context.Background(), "noop", 0, nil) {
+		t.Error("OnShutdown registered a hook without a lifecycle")
+	}
+}
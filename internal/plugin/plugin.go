@@ -0,0 +1,229 @@
+// Package plugin implements the external commands.
+//
+// A plugin is an executable named "ager-<name>" in an absolute directory on
+// PATH. When the user runs "ager <name>" and there is no built-in command with
+// the name, the plugin is run with the rest of the arguments. The plugin gets
+// the context of the run through the environment variables listed in Vars.
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/command"
+)
+
+// Prefix is the prefix of the names of the plugin executables.
+const Prefix = command.CommandName + "-"
+
+// killDelay is the time a plugin has to exit after it was interrupted before
+// it is killed.
+const killDelay = 10 * time.Second
+
+// The environment variables that pass the context to the plugins.
+const (
+	EnvVersion    = "AGER_VERSION"
+	EnvProjectDir = "AGER_PROJECT_DIR"
+	EnvStatePath  = "AGER_STATE_PATH"
+	EnvVerbosity  = "AGER_VERBOSITY"
+	EnvOutput     = "AGER_OUTPUT"
+)
+
+// A Plugin is an external command.
+type Plugin struct {
+	// Name is the name of the command, that is the name of the executable
+	// without the prefix.
+	Name string
+
+	// Path is the path to the executable.
+	Path string
+}
+
+// Vars is the context of the run that is passed to the plugins.
+type Vars struct {
+	// Version is the version of ager.
+	Version string
+
+	// ProjectDir is the directory of the project.
+	ProjectDir string
+
+	// StatePath is the path of the state file.
+	StatePath string
+
+	// Verbosity is the verbosity level of the logging.
+	Verbosity int
+
+	// Output is the output format.
+	Output command.Format
+}
+
+// environ returns the variables in v as "KEY=value" strings.
+func (v Vars) environ() []string {
+	return []string{
+		EnvVersion + "=" + v.Version,
+		EnvProjectDir + "=" + v.ProjectDir,
+		EnvStatePath + "=" + v.StatePath,
+		EnvVerbosity + "=" + fmt.Sprint(v.Verbosity),
+		EnvOutput + "=" + v.Output.String(),
+	}
+}
+
+// Lookup returns the plugin with the given name from the directories in
+// pathList, which is a list of directories like the PATH environment
+// variable.
+// The relative directories in pathList, including the empty ones that mean the
+// working directory, are skipped like exec.LookPath refuses them with
+// exec.ErrDot, so that a project cannot provide plugins by being the working
+// directory.
+// The boolean return value reports whether the plugin was found.
+func Lookup(name, pathList string) (Plugin, bool) {
+	if !validName(name) {
+		return Plugin{}, false
+	}
+
+	for _, dir := range searchDirs(pathList) {
+		path := filepath.Join(dir, Prefix+name+exeSuffix())
+		if isExecutable(path) {
+			return Plugin{Name: name, Path: path}, true
+		}
+	}
+
+	return Plugin{}, false
+}
+
+// List returns the plugins in the directories in pathList ordered by their
+// names.
+// If there are multiple plugins with the same name, the first one in pathList
+// is returned as it is the one that Lookup finds. The relative directories in
+// pathList are skipped like in Lookup.
+func List(pathList string) []Plugin {
+	seen := make(map[string]bool)
+
+	var plugins []Plugin
+
+	for _, dir := range searchDirs(pathList) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			name, ok := strings.CutPrefix(e.Name(), Prefix)
+			if !ok {
+				continue
+			}
+
+			name = strings.TrimSuffix(name, exeSuffix())
+
+			path := filepath.Join(dir, e.Name())
+			if seen[name] || !validName(name) || !isExecutable(path) {
+				continue
+			}
+
+			seen[name] = true
+
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+
+	return plugins
+}
+
+// Run runs the plugin p with the given arguments in env and returns its exit
+// code.
+// The plugin inherits the environment variables of env, or of the process if
+// env has no Environ function, with the variables in vars added.
+// When the context of env is canceled, the plugin is interrupted so that it can
+// clean up, and it is only killed if it does not exit in time.
+func Run(env *command.Env, p Plugin, args []string, vars Vars) int {
+	ctx := env.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cmd := exec.CommandContext(ctx, p.Path, args...)
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			// Interrupting is not supported on every platform.
+			return cmd.Process.Kill()
+		}
+
+		return nil
+	}
+	cmd.WaitDelay = killDelay
+	cmd.Stdin = env.Stdin
+	cmd.Stdout = env.Stdout
+	cmd.Stderr = env.Stderr
+	cmd.Dir = env.Dir
+
+	if env.Environ != nil {
+		cmd.Env = env.Environ()
+	} else {
+		cmd.Env = os.Environ()
+	}
+
+	cmd.Env = append(cmd.Env, vars.environ()...)
+
+	err := cmd.Run()
+	if err == nil {
+		return command.ExitSuccess
+	}
+
+	if ctx.Err() != nil {
+		return command.ExitInterrupted
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode()
+	}
+
+	return env.Errorf(command.ExitFailure, "Error running the plugin %s: %v", p.Name, err)
+}
+
+// searchDirs returns the absolute directories in pathList.
+func searchDirs(pathList string) []string {
+	var dirs []string
+
+	for _, dir := range filepath.SplitList(pathList) {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+// validName reports whether name can be the name of a plugin.
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "-") && !strings.ContainsAny(name, `/\`) && name != "." && name != ".."
+}
+
+// isExecutable reports whether the file at path is an executable regular file.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0o111 != 0
+}
+
+// exeSuffix returns the file name suffix of the executables.
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+
+	return ""
+}
@@ -0,0 +1,146 @@
+package plugin_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/plugin"
+)
+
+func writeExecutable(t *testing.T, path string, mode os.FileMode) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookupAndList(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the test uses Unix file modes")
+	}
+
+	first := t.TempDir()
+	second := t.TempDir()
+
+	writeExecutable(t, filepath.Join(first, "ager-deploy"), 0o755)
+	writeExecutable(t, filepath.Join(second, "ager-deploy"), 0o755)
+	writeExecutable(t, filepath.Join(second, "ager-backup"), 0o755)
+	writeExecutable(t, filepath.Join(second, "ager-notes"), 0o644)
+	writeExecutable(t, filepath.Join(second, "other-tool"), 0o755)
+
+	pathList := first + string(filepath.ListSeparator) + second
+
+	p, ok := plugin.Lookup("deploy", pathList)
+	if !ok || p.Path != filepath.Join(first, "ager-deploy") {
+		t.Errorf("Lookup(%q) = %+v, %v, want the plugin in the first directory", "deploy", p, ok)
+	}
+
+	for _, name := range []string{"notes", "other-tool", "", "../ager-deploy"} {
+		if p, ok := plugin.Lookup(name, pathList); ok {
+			t.Errorf("Lookup(%q) = %+v, want no plugin", name, p)
+		}
+	}
+
+	got := plugin.List(pathList)
+	want := []plugin.Plugin{
+		{Name: "backup", Path: filepath.Join(second, "ager-backup")},
+		{Name: "deploy", Path: filepath.Join(first, "ager-deploy")},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("List() = %+v, want %+v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("List()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// The relative directories are skipped even if they have plugins.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := filepath.Rel(wd, first)
+	if err != nil {
+		t.Skipf("no relative path to %s: %v", first, err)
+	}
+
+	if p, ok := plugin.Lookup("deploy", rel); ok {
+		t.Errorf("Lookup(%q) in a relative directory = %+v, want no plugin", "deploy", p)
+	}
+
+	if got := plugin.List(rel); len(got) != 0 {
+		t.Errorf("List() of a relative directory = %+v, want no plugins", got)
+	}
+}
+
+func TestRunInterrupt(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the test uses a shell script")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "cleaned")
+	script := `#!/bin/sh
+trap 'kill $!; echo cleaned > "$1"; exit 0' INT
+sleep 10 &
+echo ready > "$1.ready"
+wait
+`
+
+	if err := os.WriteFile(filepath.Join(dir, "ager-serve"), []byte(script), 0o755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		for {
+			if _, err := os.Stat(out + ".ready"); err == nil {
+				cancel()
+
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond) //nolint:mnd
+		}
+	}()
+
+	env := &command.Env{
+		Context:   ctx,
+		Stdin:     strings.NewReader(""),
+		Stdout:    io.Discard,
+		Stderr:    io.Discard,
+		Dir:       dir,
+		Output:    command.FormatText,
+		LookupEnv: nil,
+		Environ:   func() []string { return nil },
+	}
+	p := plugin.Plugin{Name: "serve", Path: filepath.Join(dir, "ager-serve")}
+	vars := plugin.Vars{Version: "", ProjectDir: "", StatePath: "", Verbosity: 0, Output: command.FormatText}
+
+	if code := plugin.Run(env, p, []string{out}, vars); code != command.ExitInterrupted {
+		t.Errorf("Run() = %d, want %d", code, command.ExitInterrupted)
+	}
+
+	// The plugin is interrupted instead of killed, so it can clean up.
+	if data, err := os.ReadFile(out); err != nil || string(data) != "cleaned\n" {
+		t.Errorf("the plugin did not clean up: %q, %v", data, err)
+	}
+}
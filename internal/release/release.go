@@ -0,0 +1,110 @@
+// Package release implements switching between the releases of the deployed
+// sites.
+//
+// The active release of a static site is selected with a symbolic link that
+// points to the directory of the release. The link is replaced atomically by
+// renaming a new link over it, so the web server always sees either the old or
+// the new release and never a missing or a partial one. The deployments and
+// the rollbacks use the same switch.
+package release
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/state"
+)
+
+// ErrNotFound is returned when a release is not found.
+var ErrNotFound = errors.New("release not found")
+
+// ErrNoPrevious is returned when a site has no release before the current one
+// to roll back to.
+var ErrNoPrevious = errors.New("no previous release")
+
+// ErrUnsupported is returned when the releases of a site cannot be switched.
+var ErrUnsupported = errors.New("switching the releases is not supported")
+
+// Target returns the release of the site to roll back to.
+// If id is empty, it is the release before the current release.
+func Target(site *state.Site, id string) (state.Release, error) {
+	if id != "" {
+		r, ok := site.Release(id)
+		if !ok {
+			return state.Release{}, fmt.Errorf("%w: %q", ErrNotFound, id)
+		}
+
+		return r, nil
+	}
+
+	for i, r := range site.Releases {
+		if r.ID != site.Current {
+			continue
+		}
+
+		if i == 0 {
+			return state.Release{}, ErrNoPrevious
+		}
+
+		return site.Releases[i-1], nil
+	}
+
+	return state.Release{}, fmt.Errorf("%w: the current release %q", ErrNotFound, site.Current)
+}
+
+// Activate makes r the active release of the site and sets it as the current
+// release. The relative paths in the site are resolved against projectDir.
+func Activate(site *state.Site, r state.Release, projectDir string) error {
+	switch site.Kind {
+	case state.KindStatic:
+		if site.Link == "" {
+			return fmt.Errorf("%w: the site has no link", ErrUnsupported)
+		}
+
+		dir := resolve(projectDir, r.Path)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%w: the directory of the release %q is missing", ErrNotFound, r.ID)
+		}
+
+		if err := Switch(resolve(projectDir, site.Link), dir); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w for the kind %q", ErrUnsupported, site.Kind)
+	}
+
+	site.Current = r.ID
+
+	return nil
+}
+
+// Switch atomically points the symbolic link at link to target, creating the
+// link if it does not exist.
+func Switch(link, target string) error {
+	tmp := link + ".tmp-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("failed to create the link to %s: %w", target, err)
+	}
+
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+
+		return fmt.Errorf("failed to switch %s to %s: %w", link, target, err)
+	}
+
+	return nil
+}
+
+// resolve resolves path relative to dir unless it is absolute.
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
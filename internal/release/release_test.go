@@ -0,0 +1,101 @@
+package release_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/release"
+	"github.com/anttikivi/agricola/internal/state"
+)
+
+func testSite() *state.Site {
+	return &state.Site{
+		Kind:    state.KindStatic,
+		Link:    "current",
+		Current: "3",
+		Releases: []state.Release{
+			{ID: "1", Path: "releases/1"}, //nolint:exhaustruct
+			{ID: "2", Path: "releases/2"}, //nolint:exhaustruct
+			{ID: "3", Path: "releases/3"}, //nolint:exhaustruct
+		},
+	}
+}
+
+func TestTarget(t *testing.T) {
+	t.Parallel()
+
+	site := testSite()
+
+	if r, err := release.Target(site, ""); err != nil || r.ID != "2" {
+		t.Errorf("Target(\"\") = %+v, %v, want the release 2", r, err)
+	}
+
+	if r, err := release.Target(site, "1"); err != nil || r.ID != "1" {
+		t.Errorf("Target(\"1\") = %+v, %v, want the release 1", r, err)
+	}
+
+	if _, err := release.Target(site, "9"); !errors.Is(err, release.ErrNotFound) {
+		t.Errorf("Target(\"9\") error = %v, want %v", err, release.ErrNotFound)
+	}
+
+	site.Current = "1"
+
+	if _, err := release.Target(site, ""); !errors.Is(err, release.ErrNoPrevious) {
+		t.Errorf("Target(\"\") from the oldest release error = %v, want %v", err, release.ErrNoPrevious)
+	}
+}
+
+func TestActivate(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the test uses symbolic links")
+	}
+
+	dir := t.TempDir()
+	site := testSite()
+
+	for _, r := range site.Releases {
+		path := filepath.Join(dir, r.Path)
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(path, "index.html"), []byte(r.ID), 0o644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"3", "2"} {
+		r, _ := site.Release(id)
+		if err := release.Activate(site, r, dir); err != nil {
+			t.Fatalf("Activate(%q) failed: %v", id, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, "current", "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != id || site.Current != id {
+			t.Errorf("after Activate(%q), the link serves %q and the current release is %q", id, data, site.Current)
+		}
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "releases", "1")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := site.Release("1")
+	if err := release.Activate(site, r, dir); !errors.Is(err, release.ErrNotFound) || site.Current != "2" {
+		t.Errorf("Activate of a missing directory error = %v and current = %q", err, site.Current)
+	}
+
+	docker := &state.Site{Kind: state.KindDocker, Link: "", Current: "", Releases: nil}
+	if err := release.Activate(docker, r, dir); !errors.Is(err, release.ErrUnsupported) {
+		t.Errorf("Activate of a Docker app error = %v, want %v", err, release.ErrUnsupported)
+	}
+}
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/crash"
+)
+
+// forwardTimeout is the time to wait for the forwarded socket to appear.
+const forwardTimeout = 30 * time.Second
+
+// forwardPollInterval is the interval of checking whether the forwarded socket
+// has appeared.
+const forwardPollInterval = 50 * time.Millisecond
+
+// errForwardExited is returned when the SSH client exits before the forwarded
+// socket is ready.
+var errForwardExited = errors.New("the SSH client exited before the forward was ready")
+
+// A Forward is a forwarded Unix socket.
+type Forward struct {
+	// Socket is the path of the local socket.
+	Socket string
+
+	cmd     *exec.Cmd
+	done    chan struct{}
+	waitErr error
+	once    sync.Once
+}
+
+// ForwardSocket forwards the local Unix socket localSocket to the Unix socket
+// remoteSocket on the host, for example to control the Docker daemon or the
+// ager daemon on the host.
+// The forward is kept open until it is closed or ctx is canceled.
+func (c *Client) ForwardSocket(ctx context.Context, localSocket, remoteSocket string) (*Forward, error) {
+	if err := os.Remove(localSocket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove the old socket: %w", err)
+	}
+
+	args := c.args("-N", "-o", "ExitOnForwardFailure=yes", "-o", "StreamLocalBindUnlink=yes", "-L", localSocket+":"+remoteSocket)
+	cmd := exec.CommandContext(ctx, c.program(), args...)
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the SSH client: %w", err)
+	}
+
+	f := &Forward{Socket: localSocket, cmd: cmd, done: make(chan struct{}), waitErr: nil, once: sync.Once{}}
+
+	crash.Go(func() {
+		f.waitErr = cmd.Wait()
+		close(f.done)
+	})
+
+	timer := time.NewTimer(forwardTimeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(forwardPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if info, err := os.Stat(localSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return f, nil
+		}
+
+		select {
+		case <-f.done:
+			return nil, fmt.Errorf("failed to forward %s on %s: %w: %w", remoteSocket, c.host, errForwardExited, f.waitErr)
+		case <-timer.C:
+			_ = f.Close()
+
+			return nil, fmt.Errorf("failed to forward %s on %s: timed out", remoteSocket, c.host) //nolint:err113
+		case <-ticker.C:
+		}
+	}
+}
+
+// Done returns a channel that is closed when the SSH client of the forward has
+// exited.
+func (f *Forward) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the error the SSH client exited with after Done is closed.
+func (f *Forward) Err() error {
+	<-f.done
+
+	return f.waitErr
+}
+
+// Close stops forwarding and removes the local socket.
+// It is safe to call Close more than once.
+func (f *Forward) Close() error {
+	f.once.Do(func() {
+		_ = f.cmd.Process.Kill()
+	})
+
+	<-f.done
+
+	if err := os.Remove(f.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the socket: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package remote
+
+import (
+	"context"
+	"sync"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/crash"
+)
+
+// A Result is the result of running a function on a single host.
+type Result struct {
+	Host Host
+	Err  error
+}
+
+// ForEach runs fn for a client of every host with at most parallelism hosts
+// at a time. The function is called with the index of the host in hosts so
+// that it can keep its own state for each host even if hosts has duplicates.
+// If parallelism is less than one, all of the hosts are run at the same time.
+// The results are returned in the order of the hosts.
+// The remaining hosts are not started after ctx is canceled, and their results
+// have the error of the context.
+func ForEach(ctx context.Context, hosts []Host, c Config, parallelism int, fn func(ctx context.Context, i int, client *Client) error) []Result {
+	if parallelism < 1 || parallelism > len(hosts) {
+		parallelism = len(hosts)
+	}
+
+	results := make([]Result, len(hosts))
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+
+	for i, h := range hosts {
+		results[i].Host = h
+
+		// The select chooses randomly if both of the cases are ready.
+		if ctx.Err() != nil {
+			results[i].Err = context.Cause(ctx)
+
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = context.Cause(ctx)
+
+			continue
+		}
+
+		wg.Add(1)
+
+		crash.Go(func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			alog.Infof("Starting on %s", h)
+
+			if err := fn(ctx, i, NewClient(h, c)); err != nil {
+				alog.Errorf("Failed on %s: %v", h, err)
+
+				results[i].Err = err
+
+				return
+			}
+
+			alog.Infof("Finished on %s", h)
+		})
+	}
+
+	wg.Wait()
+
+	return results
+}
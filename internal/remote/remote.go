@@ -0,0 +1,259 @@
+// Package remote implements the SSH transport for deploying to remote hosts.
+//
+// The transport runs the system's OpenSSH client so that it uses the same
+// configuration as the user's own SSH sessions: the keys are taken from the SSH
+// agent or from the given identity file, the host keys are verified against
+// the known_hosts files, and the connections can go through jump hosts.
+// The host key checking is always strict so that ager never connects to a host
+// it does not already trust.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/alog"
+)
+
+// defaultProgram is the SSH client that is run if no other is configured.
+const defaultProgram = "ssh"
+
+// ErrInvalidHost is returned when a host cannot be parsed.
+var ErrInvalidHost = errors.New("invalid host")
+
+// A Host is a remote host to connect to.
+type Host struct {
+	// User is the user to log in as. If it is empty, the SSH client chooses
+	// the user.
+	User string
+
+	// Name is the host name or the address of the host.
+	Name string
+
+	// Port is the SSH port of the host. If it is zero, the SSH client chooses
+	// the port.
+	Port int
+}
+
+// ParseHost parses a host in the form "[user@]name[:port]".
+func ParseHost(s string) (Host, error) {
+	var h Host
+
+	if user, rest, ok := strings.Cut(s, "@"); ok {
+		if user == "" {
+			return Host{}, fmt.Errorf("%w: empty user in %q", ErrInvalidHost, s)
+		}
+
+		h.User = user
+		s = rest
+	}
+
+	// Bracketed IPv6 addresses may contain colons.
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return Host{}, fmt.Errorf("%w: unclosed bracket in %q", ErrInvalidHost, s)
+		}
+
+		h.Name = s[1:end]
+		s = s[end+1:]
+	} else {
+		name, rest, _ := strings.Cut(s, ":")
+		h.Name = name
+
+		if len(rest) > 0 {
+			rest = ":" + rest
+		}
+
+		s = rest
+	}
+
+	if port, ok := strings.CutPrefix(s, ":"); ok {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return Host{}, fmt.Errorf("%w: invalid port %q", ErrInvalidHost, port)
+		}
+
+		h.Port = p
+	} else if s != "" {
+		return Host{}, fmt.Errorf("%w: unexpected %q after the host name", ErrInvalidHost, s)
+	}
+
+	if h.Name == "" || strings.HasPrefix(h.Name, "-") {
+		return Host{}, fmt.Errorf("%w: no valid host name", ErrInvalidHost)
+	}
+
+	return h, nil
+}
+
+// String returns the host in the form "[user@]name[:port]".
+func (h Host) String() string {
+	s := h.Name
+	if strings.Contains(s, ":") {
+		s = "[" + s + "]"
+	}
+
+	if h.User != "" {
+		s = h.User + "@" + s
+	}
+
+	if h.Port != 0 {
+		s += ":" + strconv.Itoa(h.Port)
+	}
+
+	return s
+}
+
+// Config is the configuration of the SSH connections.
+type Config struct {
+	// Program is the SSH client to run. If it is empty, "ssh" is run from
+	// PATH.
+	Program string
+
+	// IdentityFile is the private key to authenticate with. If it is empty,
+	// the keys from the SSH agent and the default key files are used.
+	IdentityFile string
+
+	// KnownHostsFile is the file of the known host keys. If it is empty, the
+	// default known_hosts files are used.
+	KnownHostsFile string
+
+	// JumpHosts are the hosts the connection goes through in order.
+	JumpHosts []Host
+
+	// Options are additional options for the SSH client in the form
+	// "Key=value".
+	Options []string
+}
+
+// A Client runs commands on a single remote host.
+type Client struct {
+	host   Host
+	config Config
+}
+
+// NewClient returns a client for the host h.
+func NewClient(h Host, c Config) *Client {
+	return &Client{host: h, config: c}
+}
+
+// Host returns the host of the client.
+func (c *Client) Host() Host {
+	return c.host
+}
+
+// args returns the arguments of the SSH client for connecting to the host
+// with the given extra options.
+func (c *Client) args(extra ...string) []string {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=yes",
+	}
+
+	if c.config.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+c.config.KnownHostsFile)
+	}
+
+	if c.config.IdentityFile != "" {
+		args = append(args, "-i", c.config.IdentityFile, "-o", "IdentitiesOnly=yes")
+	}
+
+	if len(c.config.JumpHosts) > 0 {
+		jumps := make([]string, 0, len(c.config.JumpHosts))
+		for _, j := range c.config.JumpHosts {
+			jumps = append(jumps, j.String())
+		}
+
+		args = append(args, "-J", strings.Join(jumps, ","))
+	}
+
+	for _, o := range c.config.Options {
+		args = append(args, "-o", o)
+	}
+
+	if c.host.User != "" {
+		args = append(args, "-l", c.host.User)
+	}
+
+	if c.host.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(c.host.Port))
+	}
+
+	args = append(args, extra...)
+
+	return append(args, "--", c.host.Name)
+}
+
+func (c *Client) program() string {
+	if c.config.Program != "" {
+		return c.config.Program
+	}
+
+	return defaultProgram
+}
+
+// Run runs the command argv on the host.
+// The arguments are quoted for the remote shell.
+// The standard streams of the remote command are connected to stdin, stdout,
+// and stderr, any of which may be nil.
+func (c *Client) Run(ctx context.Context, argv []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	quoted := make([]string, 0, len(argv))
+	for _, a := range argv {
+		quoted = append(quoted, Quote(a))
+	}
+
+	return c.RunShell(ctx, strings.Join(quoted, " "), stdin, stdout, stderr)
+}
+
+// RunShell runs the shell command line script on the host.
+func (c *Client) RunShell(ctx context.Context, script string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var errBuf bytes.Buffer
+
+	if stderr == nil {
+		stderr = &errBuf
+	}
+
+	args := append(c.args(), script)
+	cmd := exec.CommandContext(ctx, c.program(), args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	alog.V(1).Infof("Running on %s: %s", c.host, script)
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(errBuf.String()); msg != "" {
+			return fmt.Errorf("failed to run the command on %s: %w: %s", c.host, err, msg)
+		}
+
+		return fmt.Errorf("failed to run the command on %s: %w", c.host, err)
+	}
+
+	return nil
+}
+
+// Output runs the command argv on the host and returns its standard output.
+func (c *Client) Output(ctx context.Context, argv []string) ([]byte, error) {
+	var out bytes.Buffer
+
+	if err := c.Run(ctx, argv, nil, &out, nil); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// Quote quotes s for a POSIX shell.
+func Quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:@,+%") == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,311 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/remote"
+)
+
+// fakeSSH is a stand-in for the SSH client that records its arguments next to
+// itself and runs the remote command locally.
+const fakeSSH = `#!/bin/sh
+printf '%s\n' "$@" > "$0.args"
+for last; do :; done
+exec sh -c "$last"
+`
+
+// newFakeSSH writes the fake SSH client to a temporary directory and returns
+// its path.
+func newFakeSSH(t *testing.T) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake SSH client is a shell script")
+	}
+
+	path := filepath.Join(t.TempDir(), "ssh")
+	if err := os.WriteFile(path, []byte(fakeSSH), 0o755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestParseHost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    remote.Host
+		wantErr bool
+	}{
+		{"example.com", remote.Host{User: "", Name: "example.com", Port: 0}, false},
+		{"deploy@example.com", remote.Host{User: "deploy", Name: "example.com", Port: 0}, false},
+		{"deploy@example.com:2222", remote.Host{User: "deploy", Name: "example.com", Port: 2222}, false},
+		{"[::1]:22", remote.Host{User: "", Name: "::1", Port: 22}, false},
+		{"root@[2001:db8::1]", remote.Host{User: "root", Name: "2001:db8::1", Port: 0}, false},
+		{"", remote.Host{}, true},
+		{"@example.com", remote.Host{}, true},
+		{"example.com:0", remote.Host{}, true},
+		{"example.com:ssh", remote.Host{}, true},
+		{"[::1", remote.Host{}, true},
+		{"[::1]x", remote.Host{}, true},
+		{"-oProxyCommand=x", remote.Host{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := remote.ParseHost(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, remote.ErrInvalidHost) {
+				t.Errorf("ParseHost(%q) error = %v, want %v", tt.in, err, remote.ErrInvalidHost)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseHost(%q) returned an error: %v", tt.in, err)
+
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseHost(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+
+		if s := got.String(); s != tt.in {
+			t.Errorf("ParseHost(%q).String() = %q, want %q", tt.in, s, tt.in)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"/srv/www/site-1.0", "/srv/www/site-1.0"},
+		{"", "''"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+	}
+
+	for _, tt := range tests {
+		if got := remote.Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	program := newFakeSSH(t)
+	c := remote.NewClient(
+		remote.Host{User: "deploy", Name: "example.com", Port: 2222},
+		remote.Config{
+			Program:        program,
+			IdentityFile:   "/keys/id_ed25519",
+			KnownHostsFile: "/keys/known_hosts",
+			JumpHosts:      []remote.Host{{User: "", Name: "bastion", Port: 0}},
+			Options:        []string{"ConnectTimeout=5"},
+		},
+	)
+
+	out, err := c.Output(context.Background(), []string{"printf", "%s|", "two words", "it's"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "two words|it's|"; string(out) != want {
+		t.Errorf("Output() = %q, want %q", out, want)
+	}
+
+	data, err := os.ReadFile(program + ".args")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := []string{
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile=/keys/known_hosts",
+		"-i", "/keys/id_ed25519", "-o", "IdentitiesOnly=yes",
+		"-J", "bastion",
+		"-o", "ConnectTimeout=5",
+		"-l", "deploy",
+		"-p", "2222",
+		"--", "example.com",
+		`printf '%s|' 'two words' 'it'\''s'`,
+	}
+
+	if !slices.Equal(args, want) {
+		t.Errorf("SSH client arguments = %q, want %q", args, want)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	t.Parallel()
+
+	c := remote.NewClient(
+		remote.Host{User: "", Name: "example.com", Port: 0},
+		remote.Config{Program: newFakeSSH(t), IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil},
+	)
+
+	err := c.RunShell(context.Background(), "echo broken >&2; exit 3", nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("RunShell() error = %v, want an error with the remote error output", err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+
+	c := remote.NewClient(
+		remote.Host{User: "", Name: "example.com", Port: 0},
+		remote.Config{Program: newFakeSSH(t), IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil},
+	)
+
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "index.html"), []byte("<h1>hi</h1>\n"), 0o644); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "assets", "app.js"), []byte("run()\n"), 0o644); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "releases", "1")
+
+	if err := c.Upload(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"index.html": "<h1>hi</h1>\n", "assets/app.js": "run()\n"} {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+
+			continue
+		}
+
+		if string(got) != want {
+			t.Errorf("uploaded %s = %q, want %q", name, got, want)
+		}
+	}
+
+	if err := c.Upload(context.Background(), src, dst); err == nil {
+		t.Error("Upload() to an existing directory succeeded, want an error")
+	}
+}
+
+func TestUploadIncomplete(t *testing.T) {
+	t.Parallel()
+
+	c := remote.NewClient(
+		remote.Host{User: "", Name: "example.com", Port: 0},
+		remote.Config{Program: newFakeSSH(t), IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil},
+	)
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "index.html"), []byte("<h1>hi</h1>\n"), 0o644); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	// A socket cannot be archived, so the archive ends after the first file.
+	l, err := net.Listen("unix", filepath.Join(src, "z.sock"))
+	if err != nil {
+		t.Skipf("cannot create a socket: %v", err)
+	}
+	defer l.Close()
+
+	dst := filepath.Join(t.TempDir(), "releases", "1")
+
+	if err = c.Upload(context.Background(), src, dst); err == nil {
+		t.Error("Upload() of an incomplete archive succeeded, want an error")
+	}
+
+	for _, path := range []string{dst, dst + ".upload"} {
+		if _, err = os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s exists after a failed upload: %v", path, err)
+		}
+	}
+}
+
+func TestForEach(t *testing.T) {
+	t.Parallel()
+
+	config := remote.Config{Program: newFakeSSH(t), IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil}
+	hosts := []remote.Host{
+		{User: "", Name: "one", Port: 0},
+		{User: "", Name: "two", Port: 0},
+		{User: "", Name: "three", Port: 0},
+	}
+
+	results := remote.ForEach(context.Background(), hosts, config, 2, func(ctx context.Context, _ int, c *remote.Client) error {
+		if c.Host().Name == "two" {
+			return c.RunShell(ctx, "exit 1", nil, nil, nil)
+		}
+
+		return c.RunShell(ctx, "true", nil, nil, nil)
+	})
+
+	if len(results) != len(hosts) {
+		t.Fatalf("ForEach() returned %d results, want %d", len(results), len(hosts))
+	}
+
+	for i, r := range results {
+		if r.Host != hosts[i] {
+			t.Errorf("results[%d].Host = %v, want %v", i, r.Host, hosts[i])
+		}
+
+		if failed := r.Err != nil; failed != (r.Host.Name == "two") {
+			t.Errorf("results[%d].Err = %v", i, r.Err)
+		}
+	}
+
+	// The duplicate hosts get their own indices.
+	dup := []remote.Host{hosts[0], hosts[0]}
+	seen := make([]int, len(dup))
+
+	remote.ForEach(context.Background(), dup, config, 0, func(_ context.Context, i int, _ *remote.Client) error {
+		seen[i]++
+
+		return nil
+	})
+
+	if seen[0] != 1 || seen[1] != 1 {
+		t.Errorf("ForEach() called the indices %v times, want once each", seen)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results = remote.ForEach(ctx, hosts, config, 1, func(context.Context, int, *remote.Client) error {
+		return nil
+	})
+
+	for i, r := range results {
+		if r.Err == nil {
+			t.Errorf("results[%d].Err = nil after the cancellation, want an error", i)
+		}
+	}
+}
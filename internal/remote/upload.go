@@ -0,0 +1,123 @@
+package remote
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/anttikivi/agricola/internal/crash"
+)
+
+// Upload copies the local directory dir to the directory remoteDir on the
+// host.
+// The files are streamed as a tar archive and extracted to a temporary
+// directory next to remoteDir. Only after the whole archive was written, the
+// temporary directory is renamed to remoteDir with a second command, so that
+// a failed upload does not leave a partial directory behind. The remoteDir
+// must not exist.
+func (c *Client) Upload(ctx context.Context, dir, remoteDir string) error {
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+
+	crash.Go(func() {
+		err := writeTar(pw, dir)
+		pw.CloseWithError(err)
+		written <- err
+	})
+
+	tmp := Quote(remoteDir + ".upload")
+	script := fmt.Sprintf("set -e; rm -rf %[1]s; mkdir -p %[1]s; tar -x -f - -C %[1]s", tmp)
+
+	err := c.RunShell(ctx, script, pr, io.Discard, nil)
+
+	// Unblock the archive writer if the remote command exited early.
+	pr.CloseWithError(errors.New("the upload was stopped")) //nolint:err113
+
+	// The remote tar may exit successfully at the end of a truncated archive,
+	// so the archive is only complete if the writer finished.
+	if err = errors.Join(err, <-written); err != nil {
+		if cleanupErr := c.RunShell(context.WithoutCancel(ctx), "rm -rf "+tmp, nil, nil, nil); cleanupErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to remove the partial upload: %w", cleanupErr))
+		}
+
+		return fmt.Errorf("failed to upload %s: %w", dir, err)
+	}
+
+	script = fmt.Sprintf(
+		"set -e; if test -e %[2]s; then rm -rf %[1]s; echo %[2]s exists >&2; exit 1; fi; mv %[1]s %[2]s",
+		tmp,
+		Quote(remoteDir),
+	)
+	if err = c.RunShell(ctx, script, nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// writeTar writes the files in dir to w as a tar archive.
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err //nolint:wrapcheck
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+
+		return err //nolint:wrapcheck
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,386 @@
+// Package rollout implements the rolling deployments to multiple hosts.
+//
+// A rollout deploys to the hosts in batches. The hosts in a batch are deployed
+// to at the same time, and the next batch is only started after every host in
+// the batch has passed the health check. If a host fails, the rollout stops
+// and the hosts that were already deployed to can be rolled back.
+package rollout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/health"
+	"github.com/anttikivi/agricola/internal/remote"
+)
+
+// percent is the number of percents in the whole.
+const percent = 100
+
+// ErrInvalidBatchSize is returned when a batch size cannot be parsed.
+var ErrInvalidBatchSize = errors.New("invalid batch size")
+
+// ErrFailed is returned when the rollout fails on a host.
+var ErrFailed = errors.New("rollout failed")
+
+// A BatchSize is the size of the batches of a rollout either as a number of
+// hosts or as a percentage of the hosts.
+// The zero value deploys to all of the hosts in a single batch.
+type BatchSize struct {
+	// Hosts is the number of the hosts in a batch.
+	Hosts int
+
+	// Percent is the percentage of the hosts in a batch. It is only used if
+	// Hosts is zero.
+	Percent int
+}
+
+// ParseBatchSize parses a batch size that is either a number of hosts, for
+// example "2", or a percentage of the hosts, for example "25%".
+// An empty string is the zero BatchSize.
+func ParseBatchSize(s string) (BatchSize, error) {
+	if s == "" {
+		return BatchSize{Hosts: 0, Percent: 0}, nil
+	}
+
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 || n > percent {
+			return BatchSize{}, fmt.Errorf("%w: %q", ErrInvalidBatchSize, s)
+		}
+
+		return BatchSize{Hosts: 0, Percent: n}, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return BatchSize{}, fmt.Errorf("%w: %q", ErrInvalidBatchSize, s)
+	}
+
+	return BatchSize{Hosts: n, Percent: 0}, nil
+}
+
+// String returns the batch size in the form accepted by ParseBatchSize.
+func (b BatchSize) String() string {
+	switch {
+	case b.Hosts > 0:
+		return strconv.Itoa(b.Hosts)
+	case b.Percent > 0:
+		return strconv.Itoa(b.Percent) + "%"
+	default:
+		return ""
+	}
+}
+
+// Set parses s as the batch size. It implements flag.Value.
+func (b *BatchSize) Set(s string) error {
+	v, err := ParseBatchSize(s)
+	if err != nil {
+		return err
+	}
+
+	*b = v
+
+	return nil
+}
+
+// Batches splits the hosts into the batches of the size b.
+// Every batch has at least one host.
+func (b BatchSize) Batches(hosts []remote.Host) [][]remote.Host {
+	size := len(hosts)
+
+	switch {
+	case b.Hosts > 0:
+		size = b.Hosts
+	case b.Percent > 0:
+		size = (len(hosts)*b.Percent + percent - 1) / percent
+	}
+
+	size = max(size, 1)
+
+	var batches [][]remote.Host
+
+	for len(hosts) > 0 {
+		n := min(size, len(hosts))
+		batches = append(batches, hosts[:n:n])
+		hosts = hosts[n:]
+	}
+
+	return batches
+}
+
+// A Status is the status of a host in a rollout.
+type Status string
+
+const (
+	// StatusPending is the status of a host that was not deployed to.
+	StatusPending Status = "pending"
+
+	// StatusDeployed is the status of a host that was deployed to and passed
+	// the health check.
+	StatusDeployed Status = "deployed"
+
+	// StatusFailed is the status of a host on which the deployment or the
+	// health check failed.
+	StatusFailed Status = "failed"
+
+	// StatusRolledBack is the status of a host that was rolled back.
+	StatusRolledBack Status = "rolled-back"
+
+	// StatusRollbackFailed is the status of a host on which the rollback
+	// failed.
+	StatusRollbackFailed Status = "rollback-failed"
+)
+
+// A Step is a step of the rollout that is run on a single host.
+type Step func(ctx context.Context, c *remote.Client) error
+
+// Options are the options of a rollout.
+type Options struct {
+	// Config is the configuration of the SSH connections.
+	Config remote.Config
+
+	// BatchSize is the size of the batches.
+	BatchSize BatchSize
+
+	// Drain takes a host out of rotation before it is deployed to and waits
+	// for its connections to finish. If it is nil, the hosts are not
+	// drained.
+	Drain Step
+
+	// Deploy deploys to a host.
+	Deploy Step
+
+	// Check checks that a host is healthy after it was deployed to. If it is
+	// nil, the hosts are not checked.
+	Check Step
+
+	// Rollback rolls a host back to the previous release. If it is nil, the
+	// hosts are not rolled back when the rollout fails.
+	Rollback Step
+
+	// Restore puts a drained host back into rotation after it has passed the
+	// health check or has been rolled back, or if draining it failed.
+	Restore Step
+}
+
+// A HostResult is the result of the rollout on a single host.
+type HostResult struct {
+	Host remote.Host
+
+	// Batch is the number of the batch of the host starting from one.
+	Batch int
+
+	Status Status
+
+	// Err is the error of the deployment, the health check, or the rollback
+	// on the host.
+	Err error
+
+	// Drained reports whether the host was left out of rotation. A host that
+	// failed is not put back into rotation unless it is rolled back, and a
+	// host stays out of rotation if restoring it fails.
+	Drained bool
+
+	// started reports whether the deployment was started on the host.
+	started bool
+}
+
+// Run rolls out to the hosts with the given options and returns the results
+// of the hosts in the order of the hosts.
+// If the rollout fails on a host, the remaining batches are not started and
+// Run returns an error that wraps ErrFailed. The hosts on which the deployment
+// was started are then rolled back if opts.Rollback is set.
+func Run(ctx context.Context, hosts []remote.Host, opts Options) ([]HostResult, error) {
+	batches := opts.BatchSize.Batches(hosts)
+	results := make([]HostResult, 0, len(hosts))
+
+	for i, batch := range batches {
+		for _, h := range batch {
+			results = append(results, HostResult{
+				Host:    h,
+				Batch:   i + 1,
+				Status:  StatusPending,
+				Err:     nil,
+				Drained: false,
+				started: false,
+			})
+		}
+	}
+
+	var failed error
+
+	start := 0
+
+	for i, batch := range batches {
+		alog.Infof("Rolling out batch %d/%d to %d hosts", i+1, len(batches), len(batch))
+
+		current := results[start : start+len(batch)]
+		start += len(batch)
+
+		if err := runBatch(ctx, batch, current, opts); err != nil {
+			failed = fmt.Errorf("%w in batch %d/%d: %w", ErrFailed, i+1, len(batches), err)
+
+			break
+		}
+
+		alog.Infof("Batch %d/%d is healthy", i+1, len(batches))
+	}
+
+	if failed == nil {
+		return results, nil
+	}
+
+	alog.Errorf("Stopping the rollout: %v", failed)
+
+	if opts.Rollback != nil {
+		rollback(ctx, results, opts)
+	}
+
+	for _, r := range results {
+		if r.Drained {
+			alog.Warningf("%s is left out of rotation", r.Host)
+		}
+	}
+
+	return results, failed
+}
+
+// runBatch deploys to the hosts in batch and checks their health.
+// It updates the results of the hosts in results that are in the same order as
+// the hosts.
+func runBatch(ctx context.Context, batch []remote.Host, results []HostResult, opts Options) error {
+	if err := context.Cause(ctx); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	var errs []error
+
+	deployed := remote.ForEach(ctx, batch, opts.Config, 0, func(ctx context.Context, i int, c *remote.Client) error {
+		if opts.Drain != nil {
+			alog.Infof("Draining %s", c.Host())
+
+			// A failed drain may have taken the host out of rotation.
+			results[i].Drained = true
+
+			if err := opts.Drain(ctx, c); err != nil {
+				err = fmt.Errorf("drain failed: %w", err)
+
+				// The host was not deployed to, so it can go back into
+				// rotation as it is.
+				return errors.Join(err, restore(context.WithoutCancel(ctx), c, &results[i], opts))
+			}
+		}
+
+		results[i].started = true
+
+		if err := opts.Deploy(ctx, c); err != nil {
+			return err
+		}
+
+		if opts.Check != nil {
+			alog.Infof("Checking the health of %s", c.Host())
+
+			if err := opts.Check(ctx, c); err != nil {
+				return fmt.Errorf("health check failed: %w", err)
+			}
+
+			alog.Infof("%s is healthy", c.Host())
+		}
+
+		return restore(ctx, c, &results[i], opts)
+	})
+
+	for i, r := range deployed {
+		if r.Err != nil {
+			results[i].Status = StatusFailed
+			results[i].Err = r.Err
+			errs = append(errs, fmt.Errorf("%s: %w", r.Host, r.Err))
+
+			continue
+		}
+
+		results[i].Status = StatusDeployed
+	}
+
+	return errors.Join(errs...)
+}
+
+// rollback rolls back the hosts in results on which the deployment was
+// started, including the hosts on which it failed, as a failed deployment may
+// have been partially completed. The hosts that failed before the deployment,
+// for example while draining, are not rolled back.
+func rollback(ctx context.Context, results []HostResult, opts Options) {
+	var (
+		hosts   []remote.Host
+		indices []int
+	)
+
+	for i, r := range results {
+		if r.started {
+			hosts = append(hosts, r.Host)
+			indices = append(indices, i)
+		}
+	}
+
+	if len(hosts) == 0 {
+		return
+	}
+
+	alog.Infof("Rolling back %d hosts", len(hosts))
+
+	// The rollback is run even if the rollout was interrupted so that the
+	// hosts are not left in a mixed state.
+	ctx = context.WithoutCancel(ctx)
+
+	rolledBack := remote.ForEach(ctx, hosts, opts.Config, 0, func(ctx context.Context, i int, c *remote.Client) error {
+		if err := opts.Rollback(ctx, c); err != nil {
+			return err
+		}
+
+		return restore(ctx, c, &results[indices[i]], opts)
+	})
+
+	for i, r := range rolledBack {
+		res := &results[indices[i]]
+
+		if r.Err != nil {
+			res.Status = StatusRollbackFailed
+			res.Err = errors.Join(res.Err, fmt.Errorf("rollback failed: %w", r.Err))
+
+			continue
+		}
+
+		res.Status = StatusRolledBack
+	}
+}
+
+// restore puts the host of c back into rotation if the rollout drains the
+// hosts, and records in res whether the host is still out of rotation.
+func restore(ctx context.Context, c *remote.Client, res *HostResult, opts Options) error {
+	if opts.Restore == nil {
+		return nil
+	}
+
+	alog.Infof("Restoring %s to rotation", c.Host())
+
+	if err := opts.Restore(ctx, c); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	res.Drained = false
+
+	return nil
+}
+
+// HealthCheck returns a Step that waits until the probe returned by probe for
+// the host is healthy with the thresholds of c.
+func HealthCheck(probe func(c *remote.Client) health.Probe, c health.Config) Step {
+	return func(ctx context.Context, client *remote.Client) error {
+		return health.Wait(ctx, client.Host().String(), probe(client), c) //nolint:wrapcheck
+	}
+}
@@ -0,0 +1,275 @@
+package rollout_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/remote"
+	"github.com/anttikivi/agricola/internal/rollout"
+)
+
+// testHosts returns n hosts named from "host1" to "host<n>".
+func testHosts(n int) []remote.Host {
+	hosts := make([]remote.Host, 0, n)
+	for i := 1; i <= n; i++ {
+		hosts = append(hosts, remote.Host{User: "", Name: "host" + strconv.Itoa(i), Port: 0})
+	}
+
+	return hosts
+}
+
+// recorder records the hosts a step is run on.
+type recorder struct {
+	mu    sync.Mutex
+	hosts []string
+	fail  string
+}
+
+func (r *recorder) step(_ context.Context, c *remote.Client) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hosts = append(r.hosts, c.Host().Name)
+
+	if c.Host().Name == r.fail {
+		return errors.New("failed") //nolint:err113
+	}
+
+	return nil
+}
+
+func (r *recorder) sorted() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := slices.Clone(r.hosts)
+	slices.Sort(s)
+
+	return s
+}
+
+func TestParseBatchSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    rollout.BatchSize
+		wantErr bool
+	}{
+		{"", rollout.BatchSize{Hosts: 0, Percent: 0}, false},
+		{"3", rollout.BatchSize{Hosts: 3, Percent: 0}, false},
+		{"25%", rollout.BatchSize{Hosts: 0, Percent: 25}, false},
+		{"100%", rollout.BatchSize{Hosts: 0, Percent: 100}, false},
+		{"0", rollout.BatchSize{}, true},
+		{"-1", rollout.BatchSize{}, true},
+		{"0%", rollout.BatchSize{}, true},
+		{"101%", rollout.BatchSize{}, true},
+		{"half", rollout.BatchSize{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := rollout.ParseBatchSize(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, rollout.ErrInvalidBatchSize) {
+				t.Errorf("ParseBatchSize(%q) error = %v, want %v", tt.in, err, rollout.ErrInvalidBatchSize)
+			}
+
+			continue
+		}
+
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBatchSize(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+
+		if s := got.String(); s != tt.in {
+			t.Errorf("ParseBatchSize(%q).String() = %q", tt.in, s)
+		}
+	}
+}
+
+func TestBatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		size  rollout.BatchSize
+		hosts int
+		want  []int
+	}{
+		{rollout.BatchSize{Hosts: 0, Percent: 0}, 5, []int{5}},
+		{rollout.BatchSize{Hosts: 2, Percent: 0}, 5, []int{2, 2, 1}},
+		{rollout.BatchSize{Hosts: 10, Percent: 0}, 5, []int{5}},
+		{rollout.BatchSize{Hosts: 0, Percent: 25}, 8, []int{2, 2, 2, 2}},
+		{rollout.BatchSize{Hosts: 0, Percent: 25}, 5, []int{2, 2, 1}},
+		{rollout.BatchSize{Hosts: 0, Percent: 10}, 3, []int{1, 1, 1}},
+		{rollout.BatchSize{Hosts: 2, Percent: 0}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		var got []int
+		for _, b := range tt.size.Batches(testHosts(tt.hosts)) {
+			got = append(got, len(b))
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%+v.Batches(%d hosts) sizes = %v, want %v", tt.size, tt.hosts, got, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	drain := &recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}
+	deploy := &recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}
+	check := &recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}
+	restore := &recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}
+
+	results, err := rollout.Run(context.Background(), testHosts(5), rollout.Options{
+		Config:    remote.Config{Program: "", IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil},
+		BatchSize: rollout.BatchSize{Hosts: 2, Percent: 0},
+		Drain:     drain.step,
+		Deploy:    deploy.step,
+		Check:     check.step,
+		Rollback:  nil,
+		Restore:   restore.step,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, r := range results {
+		if r.Status != rollout.StatusDeployed || r.Batch != i/2+1 {
+			t.Errorf("results[%d] = %+v, want deployed in batch %d", i, r, i/2+1)
+		}
+	}
+
+	want := []string{"host1", "host2", "host3", "host4", "host5"}
+	if got := deploy.sorted(); !slices.Equal(got, want) {
+		t.Errorf("deployed to %v, want %v", got, want)
+	}
+
+	if got := check.sorted(); !slices.Equal(got, want) {
+		t.Errorf("checked %v, want %v", got, want)
+	}
+
+	if got := drain.sorted(); !slices.Equal(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+
+	if got := restore.sorted(); !slices.Equal(got, want) {
+		t.Errorf("restored %v, want %v", got, want)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	t.Parallel()
+
+	deploy := &recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}
+	check := &recorder{mu: sync.Mutex{}, hosts: nil, fail: "host3"}
+	rollback := &recorder{mu: sync.Mutex{}, hosts: nil, fail: "host2"}
+
+	results, err := rollout.Run(context.Background(), testHosts(5), rollout.Options{
+		Config:    remote.Config{Program: "", IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil},
+		BatchSize: rollout.BatchSize{Hosts: 2, Percent: 0},
+		Drain:     nil,
+		Deploy:    deploy.step,
+		Check:     check.step,
+		Rollback:  rollback.step,
+		Restore:   nil,
+	})
+	if !errors.Is(err, rollout.ErrFailed) {
+		t.Fatalf("Run() error = %v, want %v", err, rollout.ErrFailed)
+	}
+
+	if got, want := deploy.sorted(), []string{"host1", "host2", "host3", "host4"}; !slices.Equal(got, want) {
+		t.Errorf("deployed to %v, want %v", got, want)
+	}
+
+	if got, want := rollback.sorted(), []string{"host1", "host2", "host3", "host4"}; !slices.Equal(got, want) {
+		t.Errorf("rolled back %v, want %v", got, want)
+	}
+
+	want := []rollout.Status{
+		rollout.StatusRolledBack,
+		rollout.StatusRollbackFailed,
+		rollout.StatusRolledBack,
+		rollout.StatusRolledBack,
+		rollout.StatusPending,
+	}
+
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("results[%d].Status = %s, want %s", i, r.Status, want[i])
+		}
+	}
+
+	if results[2].Err == nil || results[4].Err != nil {
+		t.Errorf("results have unexpected errors: %+v", results)
+	}
+}
+
+func TestRunFailureRestore(t *testing.T) {
+	t.Parallel()
+
+	drain := &recorder{mu: sync.Mutex{}, hosts: nil, fail: "host1"}
+	deploy := &recorder{mu: sync.Mutex{}, hosts: nil, fail: "host2"}
+	restore := &recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}
+
+	results, err := rollout.Run(context.Background(), testHosts(3), rollout.Options{
+		Config:    remote.Config{Program: "", IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil},
+		BatchSize: rollout.BatchSize{Hosts: 0, Percent: 0},
+		Drain:     drain.step,
+		Deploy:    deploy.step,
+		Check:     nil,
+		Rollback:  nil,
+		Restore:   restore.step,
+	})
+	if !errors.Is(err, rollout.ErrFailed) {
+		t.Fatalf("Run() error = %v, want %v", err, rollout.ErrFailed)
+	}
+
+	// The host that failed to drain is restored, and the host that failed to
+	// deploy is left out of rotation as it is not rolled back.
+	if got, want := restore.sorted(), []string{"host1", "host3"}; !slices.Equal(got, want) {
+		t.Errorf("restored %v, want %v", got, want)
+	}
+
+	for i, want := range []bool{false, true, false} {
+		if results[i].Drained != want {
+			t.Errorf("results[%d].Drained = %v, want %v", i, results[i].Drained, want)
+		}
+	}
+}
+
+func TestRunFailureBeforeDeploy(t *testing.T) {
+	t.Parallel()
+
+	drain := &recorder{mu: sync.Mutex{}, hosts: nil, fail: "host2"}
+	rollback := &recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}
+
+	results, err := rollout.Run(context.Background(), testHosts(2), rollout.Options{
+		Config:    remote.Config{Program: "", IdentityFile: "", KnownHostsFile: "", JumpHosts: nil, Options: nil},
+		BatchSize: rollout.BatchSize{Hosts: 0, Percent: 0},
+		Drain:     drain.step,
+		Deploy:    (&recorder{mu: sync.Mutex{}, hosts: nil, fail: ""}).step,
+		Check:     nil,
+		Rollback:  rollback.step,
+		Restore:   nil,
+	})
+	if !errors.Is(err, rollout.ErrFailed) {
+		t.Fatalf("Run() error = %v, want %v", err, rollout.ErrFailed)
+	}
+
+	// The host that failed to drain was never deployed to.
+	if got, want := rollback.sorted(), []string{"host1"}; !slices.Equal(got, want) {
+		t.Errorf("rolled back %v, want %v", got, want)
+	}
+
+	if results[1].Status != rollout.StatusFailed {
+		t.Errorf("results[1].Status = %s, want %s", results[1].Status, rollout.StatusFailed)
+	}
+}
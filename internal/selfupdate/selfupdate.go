@@ -0,0 +1,492 @@
+// Package selfupdate implements updating the running ager binary to a newer
+// release.
+//
+// The available releases are listed in a release index that is a JSON file
+// either at an HTTP(S) URL or at a local path.
+// The index lists the versions and the binaries for each supported platform
+// together with their SHA-256 checksums and Ed25519 signatures:
+//
+//	{
+//	  "releases": [
+//	    {
+//	      "version": "0.2.0",
+//	      "assets": [
+//	        {
+//	          "os": "linux",
+//	          "arch": "amd64",
+//	          "url": "ager-0.2.0-linux-amd64",
+//	          "sha256": "<hex-encoded SHA-256 checksum of the binary>",
+//	          "signature": "<base64-encoded Ed25519 signature of the release>"
+//	        }
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// Relative asset URLs are resolved against the location of the index.
+//
+// The signature covers the version and the platform of the release together
+// with the checksum of the binary, so that a signed binary cannot be listed
+// as another version or for another platform. The signed message is returned
+// by SignedMessage.
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+// maxIndexSize is the maximum size of the release index in bytes.
+const maxIndexSize = 10 << 20
+
+// maxAssetSize is the maximum size of a release binary in bytes.
+const maxAssetSize = 512 << 20
+
+var (
+	// ErrDowngrade is returned when the selected release is older than the
+	// running version and the update is not forced.
+	ErrDowngrade = errors.New("refusing to downgrade")
+
+	// ErrNoRelease is returned when the index has no suitable release for the
+	// platform.
+	ErrNoRelease = errors.New("no suitable release found")
+
+	// ErrChecksum is returned when the checksum of the downloaded binary does
+	// not match the one in the index.
+	ErrChecksum = errors.New("checksum mismatch")
+
+	// ErrSignature is returned when the signature of the downloaded binary
+	// cannot be verified.
+	ErrSignature = errors.New("invalid signature")
+
+	// errNoPublicKey is returned when no public key is given for verifying the
+	// signatures.
+	errNoPublicKey = errors.New("no public key for verifying the release signatures")
+
+	// errHTTPStatus is returned when a download responds with a status other
+	// than 200 OK.
+	errHTTPStatus = errors.New("unexpected HTTP status")
+)
+
+// An Index is a release index that lists the available releases.
+type Index struct {
+	Releases []Release `json:"releases"`
+
+	// location is the location the index was fetched from.
+	// It is used to resolve relative asset URLs.
+	location string
+}
+
+// A Release is a single release in the index.
+type Release struct {
+	Version semver.Version `json:"version"`
+	Assets  []Asset        `json:"assets"`
+}
+
+// An Asset is a release binary for a single platform.
+type Asset struct {
+	// OS is the operating system of the binary using the values of GOOS.
+	OS string `json:"os"`
+
+	// Arch is the architecture of the binary using the values of GOARCH.
+	Arch string `json:"arch"`
+
+	// URL is the location of the binary.
+	// It may be an HTTP(S) URL or a path, and it may be relative to the
+	// location of the index.
+	URL string `json:"url"`
+
+	// SHA256 is the hex-encoded SHA-256 checksum of the binary.
+	SHA256 string `json:"sha256"`
+
+	// Signature is the base64-encoded Ed25519 signature of the message
+	// returned by SignedMessage for the release and the asset.
+	Signature string `json:"signature"`
+}
+
+// SignedMessage returns the message that is signed for the asset a of the
+// release with the version v. The message is the version in the form of
+// FullString, the platform, and the hex-encoded SHA-256 checksum separated by
+// spaces, for example "0.2.0 linux/amd64 <checksum>".
+func SignedMessage(v semver.Version, a Asset) []byte {
+	return []byte(v.FullString() + " " + a.OS + "/" + a.Arch + " " + strings.ToLower(a.SHA256))
+}
+
+// Options are the options for an update.
+type Options struct {
+	// Client is the HTTP client used for the downloads.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Index is the location of the release index.
+	// It may be an HTTP(S) URL or a path.
+	Index string
+
+	// PublicKey is the public key used to verify the signatures of the
+	// binaries.
+	PublicKey ed25519.PublicKey
+
+	// Current is the version of the running binary.
+	Current semver.Version
+
+	// Version is the version to update to.
+	// If it is nil, the latest release is used.
+	Version *semver.Version
+
+	// Prerelease allows updating to the latest pre-release.
+	Prerelease bool
+
+	// Force allows downgrading and reinstalling the current version.
+	Force bool
+
+	// CheckOnly makes the update only check for the new release without
+	// installing it.
+	CheckOnly bool
+
+	// Executable is the path to the binary that is replaced.
+	// If empty, the running executable is used.
+	Executable string
+
+	// GOOS and GOARCH are the platform for which the binary is selected.
+	// If empty, runtime.GOOS and runtime.GOARCH are used.
+	GOOS   string
+	GOARCH string
+}
+
+// A Result is the outcome of an update.
+type Result struct {
+	// Release is the selected release.
+	Release Release
+
+	// Available reports whether the selected release is different from the
+	// running version.
+	Available bool
+
+	// Updated reports whether the executable was replaced.
+	Updated bool
+
+	// Executable is the path to the replaced binary.
+	Executable string
+}
+
+// FetchIndex reads the release index from location.
+func FetchIndex(ctx context.Context, client *http.Client, location string) (*Index, error) {
+	data, err := fetch(ctx, client, location, maxIndexSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the release index: %w", err)
+	}
+
+	var idx Index
+	if err = json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to parse the release index: %w", err)
+	}
+
+	idx.location = strings.TrimPrefix(location, "file://")
+
+	return &idx, nil
+}
+
+// Select returns the release and its asset for the given platform.
+// If v is nil, the latest release is selected and pre-releases are only
+// considered if prerelease is true.
+func (idx *Index) Select(goos, goarch string, v *semver.Version, prerelease bool) (Release, Asset, error) {
+	var (
+		found   bool
+		release Release
+		asset   Asset
+	)
+
+	for _, r := range idx.Releases {
+		a, ok := r.asset(goos, goarch)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case v != nil:
+			if !r.Version.Equal(*v) {
+				continue
+			}
+		case !r.Version.Prerelease.IsZero() && !prerelease:
+			continue
+		case found && r.Version.Compare(release.Version) <= 0:
+			continue
+		}
+
+		release, asset, found = r, a, true
+	}
+
+	if !found {
+		if v != nil {
+			return Release{}, Asset{}, fmt.Errorf("version %v for %s/%s: %w", v, goos, goarch, ErrNoRelease)
+		}
+
+		return Release{}, Asset{}, fmt.Errorf("%s/%s: %w", goos, goarch, ErrNoRelease)
+	}
+
+	return release, asset, nil
+}
+
+func (r Release) asset(goos, goarch string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.OS == goos && a.Arch == goarch {
+			return a, true
+		}
+	}
+
+	return Asset{}, false
+}
+
+// Update checks the release index for a new release and replaces the
+// executable with it.
+func Update(ctx context.Context, opts Options) (Result, error) { //nolint:cyclop
+	if len(opts.PublicKey) != ed25519.PublicKeySize {
+		return Result{}, errNoPublicKey
+	}
+
+	goos, goarch := opts.GOOS, opts.GOARCH
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+
+	idx, err := FetchIndex(ctx, opts.Client, opts.Index)
+	if err != nil {
+		return Result{}, err
+	}
+
+	release, asset, err := idx.Select(goos, goarch, opts.Version, opts.Prerelease)
+	if err != nil {
+		return Result{}, err
+	}
+
+	cmp := release.Version.Compare(opts.Current)
+	result := Result{Release: release, Available: cmp != 0, Updated: false, Executable: ""}
+
+	alog.Infof("Selected release %+v for %s/%s, running version is %+v", release.Version, goos, goarch, opts.Current)
+
+	if cmp < 0 && !opts.Force {
+		return result, fmt.Errorf("%w from %v to %v", ErrDowngrade, opts.Current, release.Version)
+	}
+
+	if opts.CheckOnly || (cmp == 0 && !opts.Force) {
+		return result, nil
+	}
+
+	assetURL, err := resolve(idx.location, asset.URL)
+	if err != nil {
+		return result, err
+	}
+
+	alog.Infof("Downloading the release binary from %s", assetURL)
+
+	data, err := fetch(ctx, opts.Client, assetURL, maxAssetSize)
+	if err != nil {
+		return result, fmt.Errorf("failed to download the release binary: %w", err)
+	}
+
+	if err = verify(data, release.Version, asset, opts.PublicKey); err != nil {
+		return result, err
+	}
+
+	exe := opts.Executable
+	if exe == "" {
+		if exe, err = executable(); err != nil {
+			return result, err
+		}
+	}
+
+	if err = replace(exe, data); err != nil {
+		return result, err
+	}
+
+	result.Updated = true
+	result.Executable = exe
+
+	return result, nil
+}
+
+// verify verifies the checksum of the downloaded binary and the signature of
+// the release with the version v.
+func verify(data []byte, v semver.Version, asset Asset, key ed25519.PublicKey) error {
+	want, err := hex.DecodeString(asset.SHA256)
+	if err != nil {
+		return fmt.Errorf("failed to decode the checksum: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(sum[:], want) {
+		return fmt.Errorf("%w: got %x, want %s", ErrChecksum, sum, asset.SHA256)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(asset.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode the signature: %w", err)
+	}
+
+	if !ed25519.Verify(key, SignedMessage(v, asset), sig) {
+		return ErrSignature
+	}
+
+	return nil
+}
+
+// replace atomically replaces the file at exe with data.
+// The new file is written next to the old one and renamed over it so the
+// executable is never left partially written.
+func replace(exe string, data []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return fmt.Errorf("failed to stat the executable: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".new-*")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file for the new executable: %w", err)
+	}
+
+	tmpName := tmp.Name()
+
+	defer func() {
+		// The file no longer exists after a successful rename.
+		_ = os.Remove(tmpName)
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write the new executable: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write the new executable: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the new executable: %w", err)
+	}
+
+	if err = os.Chmod(tmpName, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set the permissions of the new executable: %w", err)
+	}
+
+	if err = os.Rename(tmpName, exe); err != nil {
+		return fmt.Errorf("failed to replace the executable: %w", err)
+	}
+
+	return nil
+}
+
+// executable returns the path to the running executable with the symbolic
+// links resolved.
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the executable: %w", err)
+	}
+
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the executable: %w", err)
+	}
+
+	return exe, nil
+}
+
+// resolve resolves the asset location ref relative to the index location base.
+func resolve(base, ref string) (string, error) {
+	if isURL(ref) || filepath.IsAbs(ref) {
+		return ref, nil
+	}
+
+	if isURL(base) {
+		u, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse the index URL: %w", err)
+		}
+
+		r, err := url.Parse(ref)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse the asset URL: %w", err)
+		}
+
+		return u.ResolveReference(r).String(), nil
+	}
+
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(ref)), nil
+}
+
+// fetch reads at most limit bytes from the given HTTP(S) URL or local path.
+func fetch(ctx context.Context, client *http.Client, location string, limit int64) ([]byte, error) {
+	var r io.ReadCloser
+
+	if isURL(location) {
+		if client == nil {
+			client = http.DefaultClient
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the request: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send the request: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+
+			return nil, fmt.Errorf("%w from %s: %s", errHTTPStatus, location, resp.Status)
+		}
+
+		r = resp.Body
+	} else {
+		f, err := os.Open(strings.TrimPrefix(location, "file://"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the file: %w", err)
+		}
+
+		r = f
+	}
+
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", location, err)
+	}
+
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", location, limit) //nolint:err113
+	}
+
+	return data, nil
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
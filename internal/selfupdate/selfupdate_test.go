@@ -0,0 +1,361 @@
+package selfupdate_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/selfupdate"
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+const (
+	testOS   = "linux"
+	testArch = "amd64"
+)
+
+type fixture struct {
+	pub    ed25519.PublicKey
+	server *httptest.Server
+	exe    string
+}
+
+// newFixture starts a release server that serves an index with the given
+// versions and returns the fixture.
+// The binary of each release contains the version string.
+// If tamper is true, the served binaries do not match the index.
+func newFixture(t *testing.T, versions []string, tamper bool) *fixture {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate the key: %v", err)
+	}
+
+	mux := http.NewServeMux()
+
+	var idx selfupdate.Index
+
+	for _, s := range versions {
+		v, err := semver.Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", s, err)
+		}
+
+		data := []byte("binary " + s)
+		sum := sha256.Sum256(data)
+		name := "ager-" + s + "-" + testOS + "-" + testArch
+
+		asset := selfupdate.Asset{
+			OS:        testOS,
+			Arch:      testArch,
+			URL:       "download/" + name,
+			SHA256:    hex.EncodeToString(sum[:]),
+			Signature: "",
+		}
+		asset.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, selfupdate.SignedMessage(v, asset)))
+
+		idx.Releases = append(idx.Releases, selfupdate.Release{Version: v, Assets: []selfupdate.Asset{asset}})
+
+		if tamper {
+			data = append(data, '!')
+		}
+
+		mux.HandleFunc("/download/"+name, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(data)
+		})
+	}
+
+	index, err := json.Marshal(idx)
+	if err != nil {
+		t.Fatalf("failed to marshal the index: %v", err)
+	}
+
+	mux.HandleFunc("/index.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(index)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	exe := filepath.Join(t.TempDir(), "ager")
+	if err := os.WriteFile(exe, []byte("binary current"), 0o755); err != nil { //nolint:gosec
+		t.Fatalf("failed to write the executable: %v", err)
+	}
+
+	return &fixture{pub: pub, server: server, exe: exe}
+}
+
+func (f *fixture) options(t *testing.T, current string) selfupdate.Options {
+	t.Helper()
+
+	v, err := semver.Parse(current)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", current, err)
+	}
+
+	return selfupdate.Options{
+		Client:     f.server.Client(),
+		Index:      f.server.URL + "/index.json",
+		PublicKey:  f.pub,
+		Current:    v,
+		Version:    nil,
+		Prerelease: false,
+		Force:      false,
+		CheckOnly:  false,
+		Executable: f.exe,
+		GOOS:       testOS,
+		GOARCH:     testArch,
+	}
+}
+
+func (f *fixture) assertExecutable(t *testing.T, want string) {
+	t.Helper()
+
+	data, err := os.ReadFile(f.exe)
+	if err != nil {
+		t.Fatalf("failed to read the executable: %v", err)
+	}
+
+	if string(data) != want {
+		t.Errorf("executable = %q, want %q", data, want)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(f.exe))
+	if err != nil {
+		t.Fatalf("failed to read the directory: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("temporary files were left behind: %v", entries)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.1.0", "0.3.0-rc.1", "0.2.0", "0.1.5"}, false)
+
+	result, err := selfupdate.Update(context.Background(), f.options(t, "0.1.0"))
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	if !result.Updated || result.Release.Version.String() != "0.2.0" {
+		t.Errorf("Update() = %+v, want update to 0.2.0", result)
+	}
+
+	f.assertExecutable(t, "binary 0.2.0")
+
+	info, err := os.Stat(f.exe)
+	if err != nil {
+		t.Fatalf("failed to stat the executable: %v", err)
+	}
+
+	if info.Mode().Perm() != 0o755 {
+		t.Errorf("executable permissions = %v, want %v", info.Mode().Perm(), os.FileMode(0o755))
+	}
+}
+
+func TestUpdatePrerelease(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.2.0", "0.3.0-rc.1"}, false)
+
+	opts := f.options(t, "0.2.0")
+	opts.Prerelease = true
+
+	if _, err := selfupdate.Update(context.Background(), opts); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	f.assertExecutable(t, "binary 0.3.0-rc.1")
+}
+
+func TestUpdateUpToDate(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.1.0", "0.2.0"}, false)
+
+	result, err := selfupdate.Update(context.Background(), f.options(t, "0.2.0+sha.19031c2"))
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	if result.Updated || result.Available {
+		t.Errorf("Update() = %+v, want no update", result)
+	}
+
+	f.assertExecutable(t, "binary current")
+}
+
+func TestUpdateCheckOnly(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.2.0"}, false)
+
+	opts := f.options(t, "0.1.0")
+	opts.CheckOnly = true
+
+	result, err := selfupdate.Update(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	if result.Updated || !result.Available {
+		t.Errorf("Update() = %+v, want available update", result)
+	}
+
+	f.assertExecutable(t, "binary current")
+}
+
+func TestUpdateDowngrade(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.1.0", "0.2.0"}, false)
+
+	v, err := semver.Parse("0.1.0")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	opts := f.options(t, "0.2.0")
+	opts.Version = &v
+
+	if _, err = selfupdate.Update(context.Background(), opts); !errors.Is(err, selfupdate.ErrDowngrade) {
+		t.Fatalf("Update() error = %v, want %v", err, selfupdate.ErrDowngrade)
+	}
+
+	f.assertExecutable(t, "binary current")
+
+	opts.Force = true
+
+	if _, err = selfupdate.Update(context.Background(), opts); err != nil {
+		t.Fatalf("forced Update failed: %v", err)
+	}
+
+	f.assertExecutable(t, "binary 0.1.0")
+}
+
+func TestUpdateVerification(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.2.0"}, true)
+
+	if _, err := selfupdate.Update(context.Background(), f.options(t, "0.1.0")); !errors.Is(err, selfupdate.ErrChecksum) {
+		t.Errorf("Update() error = %v, want %v", err, selfupdate.ErrChecksum)
+	}
+
+	f.assertExecutable(t, "binary current")
+
+	g := newFixture(t, []string{"0.2.0"}, false)
+
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate the key: %v", err)
+	}
+
+	opts := g.options(t, "0.1.0")
+	opts.PublicKey = other
+
+	if _, err := selfupdate.Update(context.Background(), opts); !errors.Is(err, selfupdate.ErrSignature) {
+		t.Errorf("Update() error = %v, want %v", err, selfupdate.ErrSignature)
+	}
+
+	g.assertExecutable(t, "binary current")
+}
+
+func TestUpdateRelabeledRelease(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.2.0"}, false)
+	dir := t.TempDir()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate the key: %v", err)
+	}
+
+	data := []byte("binary 0.2.0")
+	sum := sha256.Sum256(data)
+	asset := selfupdate.Asset{OS: testOS, Arch: testArch, URL: "ager", SHA256: hex.EncodeToString(sum[:]), Signature: ""}
+	signed, err := semver.Parse("0.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asset.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, selfupdate.SignedMessage(signed, asset)))
+
+	// The release 0.2.0 is listed as 0.3.0 with its valid signature.
+	index := `{"releases":[{"version":"0.3.0","assets":[` + mustMarshal(t, asset) + `]}]}`
+	if err = os.WriteFile(filepath.Join(dir, "index.json"), []byte(index), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, "ager"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := f.options(t, "0.1.0")
+	opts.Client = nil
+	opts.Index = filepath.Join(dir, "index.json")
+	opts.PublicKey = pub
+
+	if _, err = selfupdate.Update(context.Background(), opts); !errors.Is(err, selfupdate.ErrSignature) {
+		t.Errorf("Update() error = %v, want %v", err, selfupdate.ErrSignature)
+	}
+
+	f.assertExecutable(t, "binary current")
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestUpdateNoRelease(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, []string{"0.2.0"}, false)
+
+	opts := f.options(t, "0.1.0")
+	opts.GOOS = "plan9"
+
+	if _, err := selfupdate.Update(context.Background(), opts); !errors.Is(err, selfupdate.ErrNoRelease) {
+		t.Errorf("Update() error = %v, want %v", err, selfupdate.ErrNoRelease)
+	}
+}
+
+func TestFetchIndexLocal(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := os.WriteFile(path, []byte(`{"releases":[{"version":"1.2.3","assets":[]}]}`), 0o600); err != nil {
+		t.Fatalf("failed to write the index: %v", err)
+	}
+
+	idx, err := selfupdate.FetchIndex(context.Background(), nil, path)
+	if err != nil {
+		t.Fatalf("FetchIndex failed: %v", err)
+	}
+
+	if len(idx.Releases) != 1 || idx.Releases[0].Version.String() != "1.2.3" {
+		t.Errorf("FetchIndex() = %+v", idx)
+	}
+}
@@ -0,0 +1,143 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errNoPrerelease is returned when a pre-release bump is requested for
+// a version that has no pre-release.
+var errNoPrerelease = errors.New("version has no pre-release")
+
+// IncMajor returns the next major version of v.
+// If v is a pre-release of a major version, for example "2.0.0-rc.1", the
+// major version is not incremented and IncMajor returns the release version
+// "2.0.0".
+// The pre-release and build identifiers are not carried over.
+func (v Version) IncMajor() Version {
+	if len(v.Prerelease.identifiers) > 0 && v.Minor == 0 && v.Patch == 0 {
+		return Version{Major: v.Major}
+	}
+
+	return Version{Major: v.Major + 1}
+}
+
+// IncMinor returns the next minor version of v.
+// If v is a pre-release of a minor version, for example "1.3.0-rc.1", the
+// minor version is not incremented and IncMinor returns the release version
+// "1.3.0".
+// The pre-release and build identifiers are not carried over.
+func (v Version) IncMinor() Version {
+	if len(v.Prerelease.identifiers) > 0 && v.Patch == 0 {
+		return Version{Major: v.Major, Minor: v.Minor}
+	}
+
+	return Version{Major: v.Major, Minor: v.Minor + 1}
+}
+
+// IncPatch returns the next patch version of v.
+// If v is a pre-release, the patch version is not incremented and IncPatch
+// returns the release version of v.
+// The pre-release and build identifiers are not carried over.
+func (v Version) IncPatch() Version {
+	if len(v.Prerelease.identifiers) > 0 {
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	}
+
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
+
+// IncPrerelease returns the next pre-release of v.
+// The last numeric pre-release identifier is incremented so that, for example,
+// "1.2.0-rc.1" becomes "1.2.0-rc.2".
+// If the last identifier is alphanumeric, a numeric identifier "1" is appended
+// to it so that "1.2.0-rc" becomes "1.2.0-rc.1".
+// The build identifiers are not carried over.
+// IncPrerelease returns an error if v is not a pre-release.
+func (v Version) IncPrerelease() (Version, error) {
+	n := len(v.Prerelease.identifiers)
+	if n == 0 {
+		return Version{}, fmt.Errorf("cannot bump the pre-release of %v: %w", v, errNoPrerelease)
+	}
+
+	identifiers := make([]prereleaseIdentifier, n, n+1)
+	copy(identifiers, v.Prerelease.identifiers)
+
+	if i, s := identifiers[n-1].Value(); s == "" {
+		identifiers[n-1] = numericIdentifier{i + 1}
+	} else {
+		identifiers = append(identifiers, numericIdentifier{1})
+	}
+
+	return Version{
+		Major:      v.Major,
+		Minor:      v.Minor,
+		Patch:      v.Patch,
+		Prerelease: Prerelease{identifiers: identifiers},
+	}, nil
+}
+
+// Release returns the release version of v, that is v without the pre-release
+// and build identifiers.
+func (v Version) Release() Version {
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+}
+
+// SetPrerelease returns a copy of v with the pre-release identifiers set to
+// the dot-separated identifiers in s.
+// An empty string removes the pre-release.
+// SetPrerelease returns an error if s is not a valid pre-release.
+func (v Version) SetPrerelease(s string) (Version, error) {
+	result := v
+	result.prefix = ""
+	result.rawStr = ""
+
+	if s == "" {
+		result.Prerelease = Prerelease{}
+
+		return result, nil
+	}
+
+	if strings.ContainsRune(s, '+') {
+		return Version{}, newParseError(
+			KindInvalidCharacter,
+			strings.IndexRune(s, '+'),
+			"invalid character '+' in the pre-release",
+		).shift(0, s)
+	}
+
+	identifiers, _, perr := parsePrereleaseIdentifiers(s)
+	if perr != nil {
+		return Version{}, fmt.Errorf("failed to parse the pre-release identifiers: %w", perr.shift(0, s))
+	}
+
+	result.Prerelease = Prerelease{identifiers: identifiers}
+
+	return result, nil
+}
+
+// SetBuild returns a copy of v with the build identifiers set to the
+// dot-separated identifiers in s.
+// An empty string removes the build metadata.
+// SetBuild returns an error if s is not valid build metadata.
+func (v Version) SetBuild(s string) (Version, error) {
+	result := v
+	result.prefix = ""
+	result.rawStr = ""
+
+	if s == "" {
+		result.Build = nil
+
+		return result, nil
+	}
+
+	build, perr := parseBuild(s)
+	if perr != nil {
+		return Version{}, fmt.Errorf("failed to parse the build identifiers: %w", perr.shift(0, s))
+	}
+
+	result.Build = build
+
+	return result, nil
+}
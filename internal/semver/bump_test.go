@@ -0,0 +1,119 @@
+package semver_test
+
+import (
+	"testing"
+)
+
+func TestIncrement(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in    string
+		major string
+		minor string
+		patch string
+	}{
+		{"1.2.3", "2.0.0", "1.3.0", "1.2.4"},
+		{"1.2.3+meta", "2.0.0", "1.3.0", "1.2.4"},
+		{"v0.0.0", "1.0.0", "0.1.0", "0.0.1"},
+		{"1.2.3-rc.1", "2.0.0", "1.3.0", "1.2.3"},
+		{"1.2.0-rc.1", "2.0.0", "1.2.0", "1.2.0"},
+		{"2.0.0-rc.1", "2.0.0", "2.0.0", "2.0.0"},
+	}
+
+	for _, tt := range tests {
+		v := mustParse(t, tt.in)
+
+		if got := v.IncMajor().FullString(); got != tt.major {
+			t.Errorf("Version{%q}.IncMajor() = %v, want %v", tt.in, got, tt.major)
+		}
+
+		if got := v.IncMinor().FullString(); got != tt.minor {
+			t.Errorf("Version{%q}.IncMinor() = %v, want %v", tt.in, got, tt.minor)
+		}
+
+		if got := v.IncPatch().FullString(); got != tt.patch {
+			t.Errorf("Version{%q}.IncPatch() = %v, want %v", tt.in, got, tt.patch)
+		}
+	}
+}
+
+func TestIncPrerelease(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"1.2.0-rc.1", "1.2.0-rc.2"},
+		{"1.2.0-rc.9+meta", "1.2.0-rc.10"},
+		{"1.2.0-rc", "1.2.0-rc.1"},
+		{"1.2.0-0", "1.2.0-1"},
+		{"1.2.0-alpha.1.beta", "1.2.0-alpha.1.beta.1"},
+		{"1.2.0", ""},
+	}
+
+	for _, tt := range tests {
+		v := mustParse(t, tt.in)
+
+		got, err := v.IncPrerelease()
+		if (err != nil) != (tt.out == "") {
+			t.Errorf("Version{%q}.IncPrerelease() error = %v", tt.in, err)
+
+			continue
+		}
+
+		if err == nil && got.FullString() != tt.out {
+			t.Errorf("Version{%q}.IncPrerelease() = %v, want %v", tt.in, got.FullString(), tt.out)
+		}
+
+		if v.FullString() != mustParse(t, tt.in).FullString() {
+			t.Errorf("Version{%q}.IncPrerelease() modified the original version", tt.in)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	t.Parallel()
+
+	if got := mustParse(t, "1.2.0-rc.1+meta").Release(); got.FullString() != "1.2.0" {
+		t.Errorf("Release() = %v, want 1.2.0", got.FullString())
+	}
+}
+
+func TestSetPrereleaseAndBuild(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in    string
+		pre   string
+		build string
+		out   string
+	}{
+		{"1.2.3", "rc.1", "", "1.2.3-rc.1"},
+		{"1.2.3-rc.1+meta", "", "", "1.2.3"},
+		{"1.2.3-rc.1", "beta.2", "sha.19031c2", "1.2.3-beta.2+sha.19031c2"},
+		{"1.2.3", "", "001.x-y", "1.2.3+001.x-y"},
+		{"1.2.3", "01", "", ""},
+		{"1.2.3", "rc+1", "", ""},
+		{"1.2.3", "rc_1", "", ""},
+		{"1.2.3", "", "a_b", ""},
+	}
+
+	for _, tt := range tests {
+		v, err := mustParse(t, tt.in).SetPrerelease(tt.pre)
+		if err == nil {
+			v, err = v.SetBuild(tt.build)
+		}
+
+		if (err != nil) != (tt.out == "") {
+			t.Errorf("setting %q and %q to %q failed: %v", tt.pre, tt.build, tt.in, err)
+
+			continue
+		}
+
+		if err == nil && v.FullString() != tt.out {
+			t.Errorf("setting %q and %q to %q = %v, want %v", tt.pre, tt.build, tt.in, v.FullString(), tt.out)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package semver
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Compare returns an integer comparing two versions according to the
+// precedence rules of the semantic versioning 2.0.0.
+// The result will be 0 if a == b, -1 if a < b, and +1 if a > b.
+// Build metadata is ignored when determining precedence.
+//
+// Compare can be passed to slices.SortFunc and friends.
+func Compare(a, b Version) int {
+	return a.Compare(b)
+}
+
+// Sort sorts the given versions in increasing order of precedence.
+// Versions that have equal precedence, for example because they only differ in
+// their build metadata, retain their original order.
+func Sort(versions []Version) {
+	slices.SortStableFunc(versions, Compare)
+}
+
+// Compare returns an integer comparing v to w according to the precedence
+// rules of the semantic versioning 2.0.0.
+// The result will be 0 if v == w, -1 if v < w, and +1 if v > w.
+// Build metadata is ignored when determining precedence.
+func (v Version) Compare(w Version) int {
+	if c := cmp.Compare(v.Major, w.Major); c != 0 {
+		return c
+	}
+
+	if c := cmp.Compare(v.Minor, w.Minor); c != 0 {
+		return c
+	}
+
+	if c := cmp.Compare(v.Patch, w.Patch); c != 0 {
+		return c
+	}
+
+	return v.Prerelease.Compare(w.Prerelease)
+}
+
+// Equal reports whether v and w have the same precedence.
+// Build metadata is ignored so two versions that only differ in their build
+// metadata are equal.
+func (v Version) Equal(w Version) bool {
+	return v.Compare(w) == 0
+}
+
+// Less reports whether v has lower precedence than w.
+func (v Version) Less(w Version) bool {
+	return v.Compare(w) < 0
+}
+
+// Compare returns an integer comparing the pre-release p to q according to the
+// precedence rules of the semantic versioning 2.0.0.
+// The result will be 0 if p == q, -1 if p < q, and +1 if p > q.
+//
+// An empty pre-release, i.e. a normal version, has higher precedence than any
+// pre-release.
+// Otherwise the identifiers are compared from left to right and a larger set
+// of identifiers has higher precedence if all of the preceding identifiers are
+// equal.
+func (p Prerelease) Compare(q Prerelease) int {
+	switch {
+	case len(p.identifiers) == 0 && len(q.identifiers) == 0:
+		return 0
+	case len(p.identifiers) == 0:
+		return 1
+	case len(q.identifiers) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(p.identifiers) && i < len(q.identifiers); i++ {
+		if c := compareIdentifiers(p.identifiers[i], q.identifiers[i]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(p.identifiers), len(q.identifiers))
+}
+
+// compareIdentifiers compares two pre-release identifiers.
+// Numeric identifiers are compared numerically and alphanumeric identifiers
+// lexically in ASCII sort order.
+// Numeric identifiers always have lower precedence than alphanumeric ones.
+func compareIdentifiers(a, b prereleaseIdentifier) int {
+	an, as := a.Value()
+	bn, bs := b.Value()
+
+	aNumeric := as == ""
+	bNumeric := bs == ""
+
+	switch {
+	case aNumeric && bNumeric:
+		return cmp.Compare(an, bn)
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	default:
+		return cmp.Compare(as, bs)
+	}
+}
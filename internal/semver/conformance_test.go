@@ -0,0 +1,268 @@
+package semver_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+// The test corpus in this file is the list of valid and invalid versions from
+// the official semantic versioning 2.0.0 regular expression tests at
+// https://regex101.com/r/Ly7O1x/3/ that is linked from semver.org.
+
+// validVersions are the versions that are valid according to the
+// specification.
+var validVersions = []string{ //nolint:gochecknoglobals
+	"0.0.4",
+	"1.2.3",
+	"10.20.30",
+	"1.1.2-prerelease+meta",
+	"1.1.2+meta",
+	"1.1.2+meta-valid",
+	"1.0.0-alpha",
+	"1.0.0-beta",
+	"1.0.0-alpha.beta",
+	"1.0.0-alpha.beta.1",
+	"1.0.0-alpha.1",
+	"1.0.0-alpha0.valid",
+	"1.0.0-alpha.0valid",
+	"1.0.0-alpha-a.b-c-somethinglong+build.1-aef.1-its-okay",
+	"1.0.0-rc.1+build.1",
+	"2.0.0-rc.1+build.123",
+	"1.2.3-beta",
+	"10.2.3-DEV-SNAPSHOT",
+	"1.2.3-SNAPSHOT-123",
+	"1.0.0",
+	"2.0.0",
+	"1.1.7",
+	"2.0.0+build.1848",
+	"2.0.1-alpha.1227",
+	"1.0.0-alpha+beta",
+	"1.2.3----RC-SNAPSHOT.12.9.1--.12+788",
+	"1.2.3----R-S.12.9.1--.12+meta",
+	"1.2.3----RC-SNAPSHOT.12.9.1--.12",
+	"1.0.0+0.build.1-rc.10000aaa-kk-0.1",
+	"1.0.0-0A.is.legal",
+}
+
+// overflowingVersions are valid according to the specification but their
+// numeric components do not fit in an int.
+// They must be rejected with an error of the kind KindOverflow.
+var overflowingVersions = []string{ //nolint:gochecknoglobals
+	"99999999999999999999999.999999999999999999.99999999999999999",
+	"1.0.0-99999999999999999999999",
+}
+
+// invalidVersions are the versions that are invalid according to the
+// specification.
+var invalidVersions = []string{ //nolint:gochecknoglobals
+	"1",
+	"1.2",
+	"1.2.3-0123",
+	"1.2.3-0123.0123",
+	"1.1.2+.123",
+	"+invalid",
+	"-invalid",
+	"-invalid+invalid",
+	"-invalid.01",
+	"alpha",
+	"alpha.beta",
+	"alpha.beta.1",
+	"alpha.1",
+	"alpha+beta",
+	"alpha_beta",
+	"alpha.",
+	"alpha..",
+	"beta",
+	"1.0.0-alpha_beta",
+	"-alpha.",
+	"1.0.0-alpha..",
+	"1.0.0-alpha..1",
+	"1.0.0-alpha...1",
+	"1.0.0-alpha....1",
+	"1.0.0-alpha.....1",
+	"1.0.0-alpha......1",
+	"1.0.0-alpha.......1",
+	"01.1.1",
+	"1.01.1",
+	"1.1.01",
+	"1.2",
+	"1.2.3.DEV",
+	"1.2-SNAPSHOT",
+	"1.2.31.2.3----RC-SNAPSHOT.12.09.1--..12+788",
+	"1.2-RC-SNAPSHOT",
+	"-1.0.3-gamma+b7718",
+	"+justmeta",
+	"9.8.7+meta+meta",
+	"9.8.7-whatever+meta+meta",
+	"99999999999999999999999.999999999999999999.99999999999999999----RC-SNAPSHOT.12.09.1--------------------------------..12",
+
+	// Additional cases that are not in the official corpus.
+	"1.2.3-",
+	"1.2.3+",
+	"1.2.3-+meta",
+	"1.2.3-alpha.",
+	"1.2.3+meta.",
+	"1.2.3+a..b",
+	"1.2.3-.alpha",
+	"1.2.3 ",
+	" 1.2.3",
+	"1.2.3abc",
+	"1.2.3-α",
+	"1.2.3+٣",
+	"1.2.٣",
+	"v١.2.3",
+}
+
+func TestConformanceValid(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range validVersions {
+		v, err := semver.Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", s, err)
+
+			continue
+		}
+
+		if got := v.FullString(); got != s {
+			t.Errorf("Parse(%q).FullString() = %q, want %q", s, got, s)
+		}
+	}
+}
+
+func TestConformanceOverflow(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range overflowingVersions {
+		_, err := semver.Parse(s)
+
+		var perr *semver.ParseError
+		if !errors.As(err, &perr) || perr.Kind != semver.KindOverflow {
+			t.Errorf("Parse(%q) error = %v, want an error of kind %v", s, err, semver.KindOverflow)
+		}
+	}
+}
+
+func TestConformanceInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range invalidVersions {
+		if v, err := semver.Parse(s); err == nil {
+			t.Errorf("Parse(%q) = %+v, want error", s, v)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, tt := range tests {
+		f.Add(tt.in)
+	}
+
+	for _, s := range validVersions {
+		f.Add(s)
+	}
+
+	for _, s := range invalidVersions {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		v, err := semver.Parse(s)
+		if err != nil {
+			var perr *semver.ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Parse(%q) error %v is not a *ParseError", s, err)
+			}
+
+			if perr.Pos < 0 || perr.Pos > len(s) {
+				t.Fatalf("Parse(%q) error position %d is out of range", s, perr.Pos)
+			}
+
+			return
+		}
+
+		if v.Raw() != s {
+			t.Fatalf("Parse(%q).Raw() = %q", s, v.Raw())
+		}
+
+		full := v.FullString()
+		if !strings.HasSuffix(s, full) {
+			t.Fatalf("Parse(%q).FullString() = %q is not a suffix of the input", s, full)
+		}
+
+		if strings.Contains(v.String(), "+") {
+			t.Fatalf("Parse(%q).String() = %q contains build metadata", s, v.String())
+		}
+
+		w, err := semver.Parse(full)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed after round trip from %q: %v", full, s, err)
+		}
+
+		if w.FullString() != full || w.Compare(v) != 0 {
+			t.Fatalf("round trip of %q = %q, want %q", s, w.FullString(), full)
+		}
+
+		text, err := v.MarshalText()
+		if err != nil {
+			t.Fatalf("Parse(%q).MarshalText() failed: %v", s, err)
+		}
+
+		var u semver.Version
+		if err := u.UnmarshalText(text); err != nil || u.FullString() != full {
+			t.Fatalf("text round trip of %q = %q, %v, want %q", s, u.FullString(), err, full)
+		}
+	})
+}
+
+func FuzzParseLenient(f *testing.F) {
+	for _, tt := range tests {
+		f.Add(tt.in)
+	}
+
+	for _, s := range []string{"1", "v1.2", "1.2-alpine", "2024.01.05", "3-bookworm+b.1"} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		v, err := semver.ParseLenient(s)
+		if err != nil {
+			return
+		}
+
+		// Every version accepted in the lenient mode must normalize into a strict
+		// version.
+		w, err := semver.Parse(v.FullString())
+		if err != nil {
+			t.Fatalf("ParseLenient(%q) = %q which does not parse strictly: %v", s, v.FullString(), err)
+		}
+
+		if w.FullString() != v.FullString() {
+			t.Fatalf("ParseLenient(%q) = %q, strict round trip = %q", s, v.FullString(), w.FullString())
+		}
+
+		if strict, err := semver.Parse(s); err == nil && strict.FullString() != v.FullString() {
+			t.Fatalf("ParseLenient(%q) = %q, Parse = %q", s, v.FullString(), strict.FullString())
+		}
+	})
+}
+
+func FuzzConstraints(f *testing.F) {
+	for _, s := range []string{">=0.3.0, <0.5.0", "~1.4", "^1.2.3-beta.2 || 2.x", "1.2 - 1.4", "!=1.2.3", "*"} {
+		f.Add(s, "1.4.2")
+	}
+
+	f.Fuzz(func(_ *testing.T, constraint, version string) {
+		c, err := semver.ParseConstraints(constraint)
+		if err != nil {
+			return
+		}
+
+		if v, err := semver.Parse(version); err == nil {
+			c.Check(v)
+		}
+	})
+}
@@ -0,0 +1,411 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errInvalidConstraint is the error returned by the constraint parsing
+// functions when they encounter an invalid constraint string.
+var errInvalidConstraint = errors.New("invalid version constraint")
+
+// wildcards are the accepted placeholders for a version component in a partial
+// version, for example "1.x" or "1.2.*".
+const wildcards = "xX*"
+
+// An operator is a comparison operator of a single comparator.
+type operator int
+
+const (
+	opEqual operator = iota
+	opNotEqual
+	opGreater
+	opGreaterOrEqual
+	opLess
+	opLessOrEqual
+)
+
+// A comparator is a single primitive comparison against a version.
+// The range operators like "^" and "~" are desugared into comparators when the
+// constraint is parsed.
+type comparator struct {
+	op operator
+	v  Version
+}
+
+func (c comparator) check(v Version) bool {
+	cmp := v.Compare(c.v)
+
+	switch c.op {
+	case opEqual:
+		return cmp == 0
+	case opNotEqual:
+		return cmp != 0
+	case opGreater:
+		return cmp > 0
+	case opGreaterOrEqual:
+		return cmp >= 0
+	case opLess:
+		return cmp < 0
+	case opLessOrEqual:
+		return cmp <= 0
+	default:
+		panic(fmt.Sprintf("invalid constraint operator: %d", int(c.op)))
+	}
+}
+
+// Constraints is a parsed set of version constraints, for example
+// ">=0.3.0, <0.5.0" or "^1.4 || ~2.0".
+//
+// The constraints use the syntax familiar from npm and Cargo.
+// Comparators separated by commas or whitespace must all match, and sets of
+// comparators separated by "||" are alternatives of which at least one must
+// match.
+// The supported operators are "=", "!=", ">", ">=", "<", "<=", "~" (patch
+// updates when the minor version is given, minor updates otherwise), and "^"
+// (updates that do not change the left-most non-zero component).
+// A version without an operator means "=".
+// Partial versions like "1.4" and "1.x" match every version with the given
+// components, and hyphen ranges like "1.2 - 1.4" are inclusive on both ends.
+//
+// A version with a pre-release only satisfies the constraints if a comparator
+// in the matching set has a pre-release on the same major, minor, and patch
+// version.
+// For example, "1.3.0-rc.2" satisfies ">=1.3.0-rc.1" but not ">=1.2.0", and
+// "1.4.0-beta" satisfies neither as the pre-releases of a version are
+// considered unstable and only included when opted into explicitly.
+type Constraints struct {
+	sets   [][]comparator
+	rawStr string
+}
+
+// ParseConstraints parses the given string as version constraints.
+func ParseConstraints(s string) (Constraints, error) {
+	if strings.TrimSpace(s) == "" {
+		return Constraints{}, fmt.Errorf("empty string: %w", errInvalidConstraint)
+	}
+
+	rawSets := strings.Split(s, "||")
+	sets := make([][]comparator, 0, len(rawSets))
+
+	for _, rawSet := range rawSets {
+		set, err := parseComparatorSet(rawSet)
+		if err != nil {
+			return Constraints{}, err
+		}
+
+		sets = append(sets, set)
+	}
+
+	return Constraints{sets: sets, rawStr: s}, nil
+}
+
+// Check reports whether the version v satisfies the constraints.
+func (c Constraints) Check(v Version) bool {
+	for _, set := range c.sets {
+		if checkSet(set, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the string the constraints were parsed from.
+func (c Constraints) String() string {
+	return c.rawStr
+}
+
+// MaxSatisfying returns the version with the highest precedence from versions
+// that satisfies the constraints c.
+// The boolean return value reports whether any of the versions satisfied the
+// constraints.
+func MaxSatisfying(versions []Version, c Constraints) (Version, bool) {
+	var (
+		found bool
+		best  Version
+	)
+
+	for _, v := range versions {
+		if c.Check(v) && (!found || v.Compare(best) > 0) {
+			best = v
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+func checkSet(set []comparator, v Version) bool {
+	for _, c := range set {
+		if !c.check(v) {
+			return false
+		}
+	}
+
+	if len(v.Prerelease.identifiers) == 0 {
+		return true
+	}
+
+	// Pre-releases are only included if they are explicitly opted into by
+	// a comparator on the same version.
+	for _, c := range set {
+		if len(c.v.Prerelease.identifiers) > 0 &&
+			c.v.Major == v.Major && c.v.Minor == v.Minor && c.v.Patch == v.Patch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseComparatorSet parses a set of comparators that must all match.
+func parseComparatorSet(s string) ([]comparator, error) {
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty comparator set in %q: %w", s, errInvalidConstraint)
+	}
+
+	// Hyphen ranges must be the only thing in their set.
+	if len(fields) == 3 && fields[1] == "-" { //nolint:mnd
+		return parseHyphenRange(fields[0], fields[2])
+	}
+
+	var result []comparator
+
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if field == "-" {
+			return nil, fmt.Errorf("hyphen range in %q must have exactly one version on each side: %w", s, errInvalidConstraint)
+		}
+
+		// Allow whitespace between the operator and the version.
+		if strings.TrimLeft(field, "=!<>~^") == "" {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("operator %q has no version: %w", field, errInvalidConstraint)
+			}
+
+			i++
+			field += fields[i]
+		}
+
+		comparators, err := parseComparator(field)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, comparators...)
+	}
+
+	return result, nil
+}
+
+// parseComparator parses a single comparator, that is an operator followed by
+// a possibly partial version, and desugars it into primitive comparators.
+func parseComparator(s string) ([]comparator, error) {
+	rawOp := s[:len(s)-len(strings.TrimLeft(s, "=!<>~^"))]
+	rest := s[len(rawOp):]
+
+	p, err := parsePartial(rest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the version in comparator %q: %w", s, err)
+	}
+
+	switch rawOp {
+	case "", "=":
+		if p.n == 3 { //nolint:mnd
+			return []comparator{{opEqual, p.v}}, nil
+		}
+
+		return p.rangeComparators(), nil
+	case "!=":
+		if p.n != 3 { //nolint:mnd
+			return nil, fmt.Errorf("operator %q requires a full version in %q: %w", rawOp, s, errInvalidConstraint)
+		}
+
+		return []comparator{{opNotEqual, p.v}}, nil
+	case ">":
+		switch p.n {
+		case 0:
+			return []comparator{{opLess, Version{}}}, nil
+		case 3: //nolint:mnd
+			return []comparator{{opGreater, p.v}}, nil
+		default:
+			return []comparator{{opGreaterOrEqual, p.upper()}}, nil
+		}
+	case ">=":
+		return []comparator{{opGreaterOrEqual, p.v}}, nil
+	case "<":
+		return []comparator{{opLess, p.v}}, nil
+	case "<=":
+		switch p.n {
+		case 0:
+			return []comparator{{opGreaterOrEqual, Version{}}}, nil
+		case 3: //nolint:mnd
+			return []comparator{{opLessOrEqual, p.v}}, nil
+		default:
+			return []comparator{{opLess, p.upper()}}, nil
+		}
+	case "~", "~>":
+		return p.tildeComparators(), nil
+	case "^":
+		return p.caretComparators(), nil
+	default:
+		return nil, fmt.Errorf("unknown operator %q in %q: %w", rawOp, s, errInvalidConstraint)
+	}
+}
+
+// parseHyphenRange parses an inclusive hyphen range "a - b".
+func parseHyphenRange(from, to string) ([]comparator, error) {
+	lower, err := parsePartial(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the lower bound of the hyphen range: %w", err)
+	}
+
+	upper, err := parsePartial(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the upper bound of the hyphen range: %w", err)
+	}
+
+	result := []comparator{{opGreaterOrEqual, lower.v}}
+
+	switch upper.n {
+	case 0:
+	case 3: //nolint:mnd
+		result = append(result, comparator{opLessOrEqual, upper.v})
+	default:
+		result = append(result, comparator{opLess, upper.upper()})
+	}
+
+	return result, nil
+}
+
+// A partial is a version in a constraint that may lack some of its
+// components.
+type partial struct {
+	// v is the version with the missing components set to zero.
+	v Version
+
+	// n is the number of components that were given.
+	n int
+}
+
+// parsePartial parses a possibly partial version from a constraint.
+// Only full versions may have pre-release or build identifiers.
+func parsePartial(s string) (partial, error) {
+	if s == "" {
+		return partial{}, fmt.Errorf("empty version: %w", errInvalidConstraint)
+	}
+
+	core := s
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		core = s[:i]
+	}
+
+	parts := strings.Split(strings.TrimPrefix(core, "v"), ".")
+	if len(parts) > 3 { //nolint:mnd
+		return partial{}, fmt.Errorf("too many components in version %q: %w", s, errInvalidConstraint)
+	}
+
+	if len(parts) == 3 && !strings.ContainsAny(core, wildcards) { //nolint:mnd
+		v, err := Parse(s)
+		if err != nil {
+			return partial{}, fmt.Errorf("%w: %w", errInvalidConstraint, err)
+		}
+
+		return partial{v: v, n: len(parts)}, nil
+	}
+
+	if core != s {
+		return partial{}, fmt.Errorf(
+			"version %q must be a full version to have pre-release or build identifiers: %w",
+			s,
+			errInvalidConstraint,
+		)
+	}
+
+	var (
+		nums [3]int
+		n    int
+	)
+
+	for i, part := range parts {
+		if len(part) == 1 && strings.Contains(wildcards, part) {
+			continue
+		}
+
+		if n != i {
+			return partial{}, fmt.Errorf("version component %q after a wildcard in %q: %w", part, s, errInvalidConstraint)
+		}
+
+		num, length, perr := parseNextInt(part, false)
+		if perr != nil {
+			return partial{}, fmt.Errorf("invalid component %q in version %q: %w: %w", part, s, errInvalidConstraint, perr)
+		}
+
+		if length != len(part) {
+			return partial{}, fmt.Errorf("invalid component %q in version %q: %w", part, s, errInvalidConstraint)
+		}
+
+		nums[i] = num
+		n++
+	}
+
+	return partial{v: Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, n: n}, nil
+}
+
+// upper returns the lowest version that is greater than every version matching
+// the partial version p.
+// It must not be called for a partial without any components.
+func (p partial) upper() Version {
+	switch p.n {
+	case 1:
+		return Version{Major: p.v.Major + 1}
+	case 2: //nolint:mnd
+		return Version{Major: p.v.Major, Minor: p.v.Minor + 1}
+	default:
+		return Version{Major: p.v.Major, Minor: p.v.Minor, Patch: p.v.Patch + 1}
+	}
+}
+
+// rangeComparators returns the comparators matching every version that has the
+// components given in p.
+func (p partial) rangeComparators() []comparator {
+	if p.n == 0 {
+		return []comparator{{opGreaterOrEqual, Version{}}}
+	}
+
+	return []comparator{{opGreaterOrEqual, p.v}, {opLess, p.upper()}}
+}
+
+// tildeComparators returns the comparators for "~p".
+// It allows patch-level changes if the minor version is given and minor-level
+// changes if not.
+func (p partial) tildeComparators() []comparator {
+	switch p.n {
+	case 0, 1:
+		return p.rangeComparators()
+	default:
+		return []comparator{{opGreaterOrEqual, p.v}, {opLess, Version{Major: p.v.Major, Minor: p.v.Minor + 1}}}
+	}
+}
+
+// caretComparators returns the comparators for "^p".
+// It allows changes that do not modify the left-most non-zero component.
+func (p partial) caretComparators() []comparator {
+	var upper Version
+
+	switch {
+	case p.n == 0:
+		return p.rangeComparators()
+	case p.v.Major > 0 || p.n == 1:
+		upper = Version{Major: p.v.Major + 1}
+	case p.v.Minor > 0 || p.n == 2: //nolint:mnd
+		upper = Version{Minor: p.v.Minor + 1}
+	default:
+		upper = Version{Patch: p.v.Patch + 1}
+	}
+
+	return []comparator{{opGreaterOrEqual, p.v}, {opLess, upper}}
+}
@@ -0,0 +1,186 @@
+package semver_test
+
+import (
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+func TestConstraintsCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"=1.2.3", "1.2.3+meta", true},
+		{"v1.2.3", "1.2.3", true},
+		{"!=1.2.3", "1.2.3", false},
+		{"!=1.2.3", "1.2.4", true},
+
+		{">=0.3.0, <0.5.0", "0.2.9", false},
+		{">=0.3.0, <0.5.0", "0.3.0", true},
+		{">=0.3.0, <0.5.0", "0.4.99", true},
+		{">=0.3.0, <0.5.0", "0.5.0", false},
+		{">= 0.3.0 < 0.5.0", "0.4.0", true},
+
+		{">1.2.3", "1.2.3", false},
+		{">1.2.3", "1.2.4", true},
+		{">1.2", "1.2.9", false},
+		{">1.2", "1.3.0", true},
+		{"<1.2", "1.1.9", true},
+		{"<1.2", "1.2.0", false},
+		{"<=1.2", "1.2.9", true},
+		{"<=1.2", "1.3.0", false},
+		{"<=1.2.3", "1.2.3", true},
+
+		{"*", "0.0.0", true},
+		{"*", "100.1.1", true},
+		{"x", "1.0.0", true},
+		{"1.x", "1.9.9", true},
+		{"1.x", "2.0.0", false},
+		{"1.2.*", "1.2.7", true},
+		{"1.2.*", "1.3.0", false},
+		{"1.2", "1.2.7", true},
+		{"1", "0.9.0", false},
+
+		{"~1.4", "1.4.0", true},
+		{"~1.4", "1.4.12", true},
+		{"~1.4", "1.5.0", false},
+		{"~1.4.2", "1.4.1", false},
+		{"~1.4.2", "1.4.2", true},
+		{"~1.4.2", "1.5.0", false},
+		{"~1", "1.9.0", true},
+		{"~1", "2.0.0", false},
+		{"~>1.4.2", "1.4.9", true},
+
+		{"^1.2.3", "1.2.3", true},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^1.2.3", "1.2.2", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.3", true},
+		{"^0.0.3", "0.0.4", false},
+		{"^0.0", "0.0.9", true},
+		{"^0.0", "0.1.0", false},
+		{"^0.x", "0.9.0", true},
+		{"^0.x", "1.0.0", false},
+		{"^1.x", "1.9.0", true},
+
+		{"1.2 - 1.4", "1.2.0", true},
+		{"1.2 - 1.4", "1.4.9", true},
+		{"1.2 - 1.4", "1.5.0", false},
+		{"1.2.3 - 2.3.4", "2.3.4", true},
+		{"1.2.3 - 2.3.4", "2.3.5", false},
+		{"1.2.3 - 2.3.4", "1.2.2", false},
+
+		{"^1.4 || ~2.0", "1.9.0", true},
+		{"^1.4 || ~2.0", "2.0.5", true},
+		{"^1.4 || ~2.0", "2.1.0", false},
+		{"<1.0.0 || >=2.0.0", "1.5.0", false},
+		{"<1.0.0 || >=2.0.0", "2.5.0", true},
+
+		{">=1.2.0", "1.3.0-rc.1", false},
+		{"^1.2.3", "1.2.4-beta", false},
+		{"*", "1.0.0-alpha", false},
+		{">=1.3.0-rc.1", "1.3.0-rc.2", true},
+		{">=1.3.0-rc.1", "1.3.0-alpha", false},
+		{">=1.3.0-rc.1", "1.3.0", true},
+		{">=1.3.0-rc.1", "1.4.0-beta", false},
+		{"^1.2.3-beta.2", "1.2.3-beta.4", true},
+		{"^1.2.3-beta.2", "1.2.4-beta.4", false},
+		{">=1.2.0 || >=1.3.0-rc.1", "1.3.0-rc.2", true},
+	}
+
+	for _, tt := range tests {
+		c, err := semver.ParseConstraints(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraints(%q) failed: %v", tt.constraint, err)
+
+			continue
+		}
+
+		if got := c.Check(mustParse(t, tt.version)); got != tt.want {
+			t.Errorf("ParseConstraints(%q).Check(%q) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseConstraintsInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		"",
+		"  ",
+		"||",
+		"^1.2.3 ||",
+		">=",
+		">=a",
+		"=>1.2.3",
+		"1.2.3.4",
+		"01.2.3",
+		"1.02",
+		"1.x.3",
+		"1.2-pre",
+		"1.2.3-",
+		"1.2.3+",
+		"!=1.2",
+		"1.2 - ",
+		"- 1.2",
+		"1.2 - 1.3 - 1.4",
+		"1.2.3 abc",
+	}
+
+	for _, s := range tests {
+		if c, err := semver.ParseConstraints(s); err == nil {
+			t.Errorf("ParseConstraints(%q) = %v, want error", s, c)
+		}
+	}
+}
+
+func TestMaxSatisfying(t *testing.T) {
+	t.Parallel()
+
+	versions := []semver.Version{
+		mustParse(t, "1.3.0"),
+		mustParse(t, "1.4.2"),
+		mustParse(t, "1.4.10"),
+		mustParse(t, "1.5.0-rc.1"),
+		mustParse(t, "1.5.0"),
+		mustParse(t, "2.0.0"),
+	}
+
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"~1.4", "1.4.10"},
+		{"^1.3", "1.5.0"},
+		{">=0.3.0, <0.5.0", ""},
+		{"*", "2.0.0"},
+		{"<1.5.0", "1.4.10"},
+		{">=1.5.0-rc.1, <1.5.0", "1.5.0-rc.1"},
+	}
+
+	for _, tt := range tests {
+		c, err := semver.ParseConstraints(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraints(%q) failed: %v", tt.constraint, err)
+		}
+
+		v, ok := semver.MaxSatisfying(versions, c)
+		if ok != (tt.want != "") {
+			t.Errorf("MaxSatisfying(%q) found = %v, want %v", tt.constraint, ok, !ok)
+
+			continue
+		}
+
+		if ok && v.String() != tt.want {
+			t.Errorf("MaxSatisfying(%q) = %v, want %v", tt.constraint, v, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package semver
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// errUnsupportedScanType is returned when a version is scanned from a database
+// value of an unsupported type.
+var errUnsupportedScanType = errors.New("unsupported type for scanning a version")
+
+// MarshalText implements encoding.TextMarshaler.
+//
+// The text, JSON, database, and flag encodings of a version all use the form
+// returned by FullString, for example "1.2.3-rc.1+sha.19031c2". Decoding that
+// form gives back an equal version with the same build metadata. The prefix is
+// not encoded, so Raw and Prefix of a decoded version only return what was
+// encoded and not the string the original version was parsed from.
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.FullString()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// The text is parsed using Parse.
+func (v *Version) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal the version: %w", err)
+	}
+
+	*v = parsed
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+// The version is encoded as a JSON string like FullString.
+func (v Version) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(v.FullString())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the version: %w", err)
+	}
+
+	return b, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// The version must be a JSON string that is parsed using Parse.
+// A JSON null leaves the version unchanged.
+func (v *Version) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to unmarshal the version: %w", err)
+	}
+
+	return v.UnmarshalText([]byte(s))
+}
+
+// Scan implements sql.Scanner.
+// The version can be scanned from a string or a byte slice.
+// A NULL value sets the version to the zero value.
+func (v *Version) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*v = Version{}
+
+		return nil
+	case string:
+		return v.UnmarshalText([]byte(src))
+	case []byte:
+		return v.UnmarshalText(src)
+	default:
+		return fmt.Errorf("cannot scan %T into a version: %w", src, errUnsupportedScanType)
+	}
+}
+
+// Value implements driver.Valuer.
+// The version is stored as a string like FullString.
+func (v Version) Value() (driver.Value, error) {
+	return v.FullString(), nil
+}
+
+// A Flag is a version that can be used as a command-line flag.
+// It implements flag.Value. The version is set using Parse and printed like
+// FullString so that the printed value can be set again.
+type Flag struct {
+	Version
+}
+
+// String returns the version like FullString. It implements flag.Value.
+func (f *Flag) String() string {
+	return f.FullString()
+}
+
+// Format implements fmt.Formatter. It formats the version like Version.Format
+// but the verbs 's', 'v', and 'q' always print the version like FullString so
+// that the formatted flag agrees with String.
+func (f *Flag) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 's', 'v', 'q':
+		if verb == 'v' {
+			verb = 's'
+		}
+
+		fmt.Fprintf(s, fmt.FormatString(s, verb), f.FullString())
+	default:
+		f.Version.Format(s, verb)
+	}
+}
+
+// Set parses s as the version. It implements flag.Value.
+func (f *Flag) Set(s string) error {
+	return f.UnmarshalText([]byte(s))
+}
+
+// ParsePrerelease parses the dot-separated pre-release identifiers in s.
+// The string must not start with the hyphen that separates the pre-release from
+// the version core.
+func ParsePrerelease(s string) (Prerelease, error) {
+	v, err := (Version{}).SetPrerelease(s)
+	if err != nil {
+		return Prerelease{}, err
+	}
+
+	return v.Prerelease, nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Prerelease) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// An empty text is an empty pre-release.
+func (p *Prerelease) UnmarshalText(text []byte) error {
+	parsed, err := ParsePrerelease(string(text))
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal the pre-release: %w", err)
+	}
+
+	*p = parsed
+
+	return nil
+}
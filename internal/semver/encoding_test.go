@@ -0,0 +1,186 @@
+package semver_test
+
+import (
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+var (
+	_ encoding.TextMarshaler   = semver.Version{}
+	_ encoding.TextUnmarshaler = (*semver.Version)(nil)
+	_ json.Marshaler           = semver.Version{}
+	_ json.Unmarshaler         = (*semver.Version)(nil)
+	_ flag.Value               = (*semver.Flag)(nil)
+	_ encoding.TextMarshaler   = semver.Prerelease{}
+	_ encoding.TextUnmarshaler = (*semver.Prerelease)(nil)
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range tests {
+		if tt.out == "" {
+			continue
+		}
+
+		v := mustParse(t, tt.in)
+
+		text, err := v.MarshalText()
+		if err != nil {
+			t.Fatalf("Version{%q}.MarshalText() failed: %v", tt.in, err)
+		}
+
+		var got semver.Version
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q) failed: %v", text, err)
+		}
+
+		if got.FullString() != v.FullString() || !got.Equal(v) || !slices.Equal(got.Build, v.Build) {
+			t.Errorf("text round trip of %q = %+v, want %+v", tt.in, got, v)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	type document struct {
+		Version    semver.Version    `json:"version"`
+		Prerelease semver.Prerelease `json:"prerelease"`
+		Optional   *semver.Version   `json:"optional,omitempty"`
+	}
+
+	in := document{
+		Version:    mustParse(t, "v1.2.3-rc.1+sha.19031c2"),
+		Prerelease: mustParse(t, "1.0.0-alpha.1").Prerelease,
+		Optional:   nil,
+	}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+
+	want := `{"version":"1.2.3-rc.1+sha.19031c2","prerelease":"alpha.1"}`
+	if string(data) != want {
+		t.Errorf("json.Marshal = %s, want %s", data, want)
+	}
+
+	var out document
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	if out.Version.FullString() != in.Version.FullString() || out.Prerelease.Compare(in.Prerelease) != 0 {
+		t.Errorf("JSON round trip = %+v, want %+v", out, in)
+	}
+
+	for _, s := range []string{`"1.2"`, `"bad"`, `123`, `{}`} {
+		var v semver.Version
+		if err := json.Unmarshal([]byte(s), &v); err == nil {
+			t.Errorf("json.Unmarshal(%s) = %v, want error", s, v)
+		}
+	}
+}
+
+func TestScanAndValue(t *testing.T) {
+	t.Parallel()
+
+	v := mustParse(t, "1.2.3-rc.1+meta")
+
+	value, err := v.Value()
+	if err != nil {
+		t.Fatalf("Value() failed: %v", err)
+	}
+
+	if value != "1.2.3-rc.1+meta" {
+		t.Errorf("Value() = %v, want %v", value, "1.2.3-rc.1+meta")
+	}
+
+	for _, src := range []any{value, []byte("1.2.3-rc.1+meta")} {
+		var got semver.Version
+		if err := got.Scan(src); err != nil {
+			t.Fatalf("Scan(%v) failed: %v", src, err)
+		}
+
+		if got.FullString() != v.FullString() {
+			t.Errorf("Scan(%v) = %+v, want %+v", src, got, v)
+		}
+	}
+
+	got := v
+	if err := got.Scan(nil); err != nil || got.FullString() != "0.0.0" {
+		t.Errorf("Scan(nil) = %+v, %v, want zero version", got, err)
+	}
+
+	if err := got.Scan(123); err == nil {
+		t.Error("Scan(123) succeeded, want error")
+	}
+}
+
+func TestFlag(t *testing.T) {
+	t.Parallel()
+
+	var v semver.Flag
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&v, "version", "the version")
+
+	if err := fs.Parse([]string{"-version", "v2.1.0-beta+exp"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if got := v.String(); got != "2.1.0-beta+exp" {
+		t.Errorf("flag value = %q, want 2.1.0-beta+exp", got)
+	}
+
+	for _, format := range []string{"%v", "%s"} {
+		if got := fmt.Sprintf(format, &v); got != "2.1.0-beta+exp" {
+			t.Errorf("Sprintf(%q) = %q, want 2.1.0-beta+exp", format, got)
+		}
+	}
+
+	if got := fmt.Sprintf("%r", &v); got != "v2.1.0-beta+exp" {
+		t.Errorf("Sprintf(%%r) = %q, want v2.1.0-beta+exp", got)
+	}
+
+	// The printed value can be set again.
+	if err := fs.Set("version", v.String()); err != nil || v.FullString() != "2.1.0-beta+exp" {
+		t.Errorf("setting the printed flag value gives %+v, %v", v.Version, err)
+	}
+
+	if err := fs.Parse([]string{"-version", "2.1"}); err == nil {
+		t.Error("parsing an invalid version flag succeeded")
+	}
+}
+
+func TestParsePrerelease(t *testing.T) {
+	t.Parallel()
+
+	p, err := semver.ParsePrerelease("alpha.1.x-y")
+	if err != nil {
+		t.Fatalf("ParsePrerelease failed: %v", err)
+	}
+
+	if got := p.Identifiers(); !slices.Equal(got, []string{"alpha", "1", "x-y"}) {
+		t.Errorf("Identifiers() = %v", got)
+	}
+
+	for _, s := range []string{"01", "a+b", "a_b"} {
+		if _, err := semver.ParsePrerelease(s); err == nil {
+			t.Errorf("ParsePrerelease(%q) succeeded, want error", s)
+		}
+	}
+
+	if p, err := semver.ParsePrerelease(""); err != nil || !p.IsZero() {
+		t.Errorf(`ParsePrerelease("") = %v, %v, want empty pre-release`, p, err)
+	}
+}
@@ -0,0 +1,110 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errInvalidVersion is the error that all of the errors returned by the
+// version parsing functions wrap when they encounter an invalid version
+// string.
+var errInvalidVersion = errors.New("invalid semantic version")
+
+// An ErrorKind identifies the reason why a version string could not be parsed.
+type ErrorKind int
+
+// These constants identify the kinds of parse errors.
+const (
+	// KindEmpty means that the version string is empty.
+	KindEmpty ErrorKind = iota + 1
+
+	// KindInvalidPrefix means that the version string starts with a prefix
+	// that is not allowed.
+	KindInvalidPrefix
+
+	// KindMissingNumber means that a numeric version component was expected
+	// but not found.
+	KindMissingNumber
+
+	// KindMissingDot means that a version component is not followed by a dot.
+	KindMissingDot
+
+	// KindLeadingZero means that a numeric component or identifier has
+	// a leading zero.
+	KindLeadingZero
+
+	// KindOverflow means that a numeric component or identifier is too large.
+	KindOverflow
+
+	// KindEmptyIdentifier means that a pre-release or build identifier is
+	// empty.
+	KindEmptyIdentifier
+
+	// KindInvalidCharacter means that the version string contains
+	// a character that is not allowed in its position.
+	KindInvalidCharacter
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindEmpty:
+		return "empty version"
+	case KindInvalidPrefix:
+		return "invalid prefix"
+	case KindMissingNumber:
+		return "missing number"
+	case KindMissingDot:
+		return "missing dot"
+	case KindLeadingZero:
+		return "leading zero"
+	case KindOverflow:
+		return "number out of range"
+	case KindEmptyIdentifier:
+		return "empty identifier"
+	case KindInvalidCharacter:
+		return "invalid character"
+	default:
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+}
+
+// A ParseError describes why and where parsing a version string failed.
+//
+// ParseError wraps the same error regardless of the kind so every parse error
+// can be checked for with errors.Is against any other parse error.
+type ParseError struct {
+	// Kind is the kind of the error.
+	Kind ErrorKind
+
+	// Input is the version string that was being parsed.
+	Input string
+
+	// Pos is the byte offset in Input where the error was encountered.
+	Pos int
+
+	// Msg is a human-readable description of the error.
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v %q: %s at offset %d: %s", errInvalidVersion, e.Input, e.Kind, e.Pos, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return errInvalidVersion
+}
+
+// newParseError returns a new parse error.
+// The input of the error is filled in by Parse and the position is relative to
+// the string that was being parsed by the caller until Parse moves it.
+func newParseError(kind ErrorKind, pos int, format string, args ...any) *ParseError {
+	return &ParseError{Kind: kind, Input: "", Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// shift moves the position of the error by offset and sets the input.
+func (e *ParseError) shift(offset int, input string) *ParseError {
+	e.Pos += offset
+	e.Input = input
+
+	return e
+}
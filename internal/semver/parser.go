@@ -0,0 +1,77 @@
+package semver
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// A Parser parses version strings with configurable options.
+// The zero value is a parser that parses strict semantic versions without
+// prefixes.
+type Parser struct {
+	// Prefixes are the prefixes that are allowed before the version number,
+	// for example "v" or "release-".
+	// A version without a prefix is always allowed.
+	Prefixes []string
+
+	// CaseInsensitive makes the prefixes match regardless of their case so
+	// that, for example, the prefix "v" also allows "V".
+	CaseInsensitive bool
+
+	// Lenient makes the parser accept version strings that do not strictly
+	// adhere to the semantic versioning as described in ParseLenient.
+	Lenient bool
+}
+
+// Parse parses the given version string using the options of p.
+// The prefix that was found in the string is reported by Version.Prefix.
+//
+// If the string is not a valid version, the returned error is a *ParseError.
+func (p *Parser) Parse(ver string) (Version, error) {
+	v, err := p.parse(ver)
+	if err != nil {
+		return Version{}, err
+	}
+
+	return v, nil
+}
+
+// IsValid reports whether s is a valid version string for p.
+func (p *Parser) IsValid(s string) bool {
+	_, err := p.parse(s)
+
+	return err == nil
+}
+
+// parsePrefix parses the possible prefix of the version string s.
+// The longest allowed prefix that is followed by a digit is chosen.
+func (p *Parser) parsePrefix(s string) (string, *ParseError) {
+	if s == "" {
+		return "", newParseError(KindEmpty, 0, "empty string")
+	}
+
+	if isDigit(s[0]) {
+		return "", nil
+	}
+
+	prefixes := slices.Clone(p.Prefixes)
+	slices.SortFunc(prefixes, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+
+	for _, prefix := range prefixes {
+		if prefix == "" || len(s) <= len(prefix) || !isDigit(s[len(prefix)]) {
+			continue
+		}
+
+		if s[:len(prefix)] == prefix || (p.CaseInsensitive && strings.EqualFold(s[:len(prefix)], prefix)) {
+			return s[:len(prefix)], nil
+		}
+	}
+
+	i := strings.IndexFunc(s, isDigit)
+	if i == -1 {
+		return "", newParseError(KindMissingNumber, len(s), "no digits after the possible prefix")
+	}
+
+	return "", newParseError(KindInvalidPrefix, 0, "invalid prefix %q", s[:i])
+}
@@ -39,11 +39,28 @@ func (p Prerelease) String() string {
 	return s[:len(s)-1]
 }
 
+// Identifiers returns the pre-release identifiers as strings.
+func (p Prerelease) Identifiers() []string {
+	if len(p.identifiers) == 0 {
+		return nil
+	}
+
+	result := make([]string, 0, len(p.identifiers))
+	for _, ident := range p.identifiers {
+		result = append(result, ident.String())
+	}
+
+	return result
+}
+
+// IsZero reports whether p is an empty pre-release, that is the version is not
+// a pre-release.
+func (p Prerelease) IsZero() bool {
+	return len(p.identifiers) == 0
+}
+
 // A prereleaseIdentifier is a single pre-release identifier separated by dots.
 type prereleaseIdentifier interface {
-	// Len returns the length of the pre-release identifier in characters.
-	Len() int
-
 	// String returns the string representation of the identifier.
 	String() string
 
@@ -59,10 +76,6 @@ type numericIdentifier struct {
 	v int
 }
 
-func (i numericIdentifier) Len() int {
-	return countDigits(i.v)
-}
-
 func (i numericIdentifier) String() string {
 	return strconv.Itoa(i.v)
 }
@@ -75,10 +88,6 @@ type alphanumericIdentifier struct {
 	v string
 }
 
-func (i alphanumericIdentifier) Len() int {
-	return len(i.v)
-}
-
 func (i alphanumericIdentifier) String() string {
 	return i.v
 }
@@ -1,19 +1,11 @@
 package semver
 
 import (
-	"errors"
 	"fmt"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
-// errInvalidVersion is the error returned by the version parsing functions when
-// they encounter invalid version string.
-//
-// TODO: Maybe implement different errors for the different cases.
-var errInvalidVersion = errors.New("invalid semantic version")
-
 type buildIdentifiers []string
 
 // A Version is a parsed instance of a version number that adheres to the
@@ -24,9 +16,13 @@ type Version struct {
 	Patch      int
 	Prerelease Prerelease
 	Build      buildIdentifiers
+	prefix     string
 	rawStr     string
 }
 
+// String returns the canonical string representation of the version without
+// the prefix and the build metadata, for example "1.2.3-rc.1".
+// The returned string identifies the precedence of the version.
 func (v Version) String() string {
 	var sb strings.Builder
 
@@ -44,6 +40,73 @@ func (v Version) String() string {
 	return sb.String()
 }
 
+// FullString returns the canonical string representation of the version
+// including the build metadata, for example "1.2.3-rc.1+sha.19031c2".
+func (v Version) FullString() string {
+	if len(v.Build) == 0 {
+		return v.String()
+	}
+
+	return v.String() + "+" + v.Build.String()
+}
+
+// Prefix returns the prefix of the original string the version was parsed
+// from as it was written in the string, for example "v" or "release-".
+// It returns an empty string if the version had no prefix or was not parsed
+// from a string.
+func (v Version) Prefix() string {
+	return v.prefix
+}
+
+// Raw returns the original string the version was parsed from, including the
+// possible prefix.
+// If the version was not parsed from a string, Raw returns the same value as
+// FullString.
+func (v Version) Raw() string {
+	if v.rawStr == "" {
+		return v.FullString()
+	}
+
+	return v.rawStr
+}
+
+// Format implements fmt.Formatter.
+// The verbs 's' and 'v' format the version like String and the verb 'q' like
+// String in double quotes.
+// With the '+' flag, these verbs include the build metadata like FullString.
+// The verb 'r' formats the original string the version was parsed from like
+// Raw.
+func (v Version) Format(f fmt.State, verb rune) {
+	var s string
+
+	switch verb {
+	case 's', 'v', 'q':
+		if f.Flag('+') {
+			s = v.FullString()
+		} else {
+			s = v.String()
+		}
+	case 'r':
+		s = v.Raw()
+		verb = 's'
+	default:
+		fmt.Fprintf(f, "%%!%c(semver.Version=%s)", verb, v.FullString())
+
+		return
+	}
+
+	if verb == 'v' {
+		verb = 's'
+	}
+
+	fmt.Fprintf(f, fmt.FormatString(f, verb), s)
+}
+
+// String returns the build identifiers joined by dots.
+func (b buildIdentifiers) String() string {
+	return strings.Join(b, ".")
+}
+
 // IsValid reports whether s is a valid semantic version string.
 func IsValid(s string) bool {
 	if _, err := Parse(s); err != nil {
@@ -53,83 +116,98 @@ func IsValid(s string) bool {
 	return true
 }
 
-func countDigits(i int) int {
-	if i == 0 {
-		return 1
-	}
+// Parse parses the given version string.
+// The version may be prefixed with "v".
+// To allow other prefixes, use a Parser.
+//
+// If the string is not a valid version, the returned error is a *ParseError.
+func Parse(ver string) (Version, error) {
+	p := Parser{Prefixes: []string{"v"}, CaseInsensitive: false, Lenient: false}
 
-	count := 0
+	return p.Parse(ver)
+}
 
-	for i != 0 {
-		i /= 10
-		count++
-	}
+// ParseLenient parses the given version string like Parse but accepts version
+// strings that are commonly found in the wild but do not strictly adhere to
+// the semantic versioning.
+// The minor and patch versions may be omitted so that, for example, "v1" is
+// parsed as "1.0.0" and the Docker-style image tag "1.2-alpine" as
+// "1.2.0-alpine".
+// The numeric version components may also have leading zeros, for example
+// "2024.01.05" is parsed as "2024.1.5".
+// The pre-release and build identifiers must still be valid.
+//
+// The original string is preserved and returned by Version.Raw.
+func ParseLenient(ver string) (Version, error) {
+	p := Parser{Prefixes: []string{"v"}, CaseInsensitive: false, Lenient: true}
 
-	return count
+	return p.Parse(ver)
 }
 
-func Parse(ver string) (Version, error) {
+// parse parses the version string ver using the options of p.
+// The returned error is either nil or a non-nil *ParseError.
+func (p *Parser) parse(ver string) (Version, *ParseError) { //nolint:cyclop,funlen
 	if ver == "" {
-		return Version{}, fmt.Errorf("empty string: %w", errInvalidVersion)
+		return Version{}, newParseError(KindEmpty, 0, "empty string").shift(0, ver)
 	}
 
 	pos := 0
 
-	prefix, err := parsePrefix(ver)
-	if err != nil {
-		return Version{}, fmt.Errorf("failed to parse the version prefix: %w", err)
+	prefix, perr := p.parsePrefix(ver)
+	if perr != nil {
+		return Version{}, perr.shift(pos, ver)
 	}
 
 	pos += len(prefix)
 
-	major, err := parseNextInt(ver[pos:])
-	if err != nil {
-		return Version{}, fmt.Errorf("failed to parse the major version: %w", err)
-	}
+	var (
+		nums [3]int
+		n    int
+	)
 
-	pos += countDigits(major)
-	if pos >= len(ver) || ver[pos] != '.' {
-		return Version{}, fmt.Errorf("no dot after the major version: %w", errInvalidVersion)
-	}
+	names := [...]string{"major", "minor", "patch"}
 
-	pos++
+	for n < len(nums) {
+		num, length, perr := parseNextInt(ver[pos:], p.Lenient)
+		if perr != nil {
+			perr.Msg = names[n] + " version: " + perr.Msg
 
-	minor, err := parseNextInt(ver[pos:])
-	if err != nil {
-		return Version{}, fmt.Errorf("failed to parse the minor version: %w", err)
-	}
+			return Version{}, perr.shift(pos, ver)
+		}
 
-	pos += countDigits(minor)
-	if pos >= len(ver) || ver[pos] != '.' {
-		return Version{}, fmt.Errorf("no dot after the minor version: %w", errInvalidVersion)
-	}
+		nums[n] = num
+		pos += length
+		n++
 
-	pos++
+		if n == len(nums) {
+			break
+		}
 
-	patch, err := parseNextInt(ver[pos:])
-	if err != nil {
-		return Version{}, fmt.Errorf("failed to parse the patch version: %w", err)
+		if pos >= len(ver) || ver[pos] != '.' {
+			if p.Lenient {
+				break
+			}
+
+			return Version{}, newParseError(KindMissingDot, 0, "no dot after the %s version", names[n-1]).shift(pos, ver)
+		}
+
+		pos++
 	}
 
 	var prereleaseIdentifiers []prereleaseIdentifier
 
-	pos += countDigits(patch)
-
 	if pos < len(ver) && ver[pos] == '-' {
 		// The hyphen is not passed to the parser.
 		pos++
 
-		prereleaseIdentifiers, err = parsePrereleaseIdentifiers(ver[pos:])
-		if err != nil {
-			return Version{}, fmt.Errorf("failed to parse the pre-release identifiers: %w", err)
-		}
-
-		// Move the position by the number of dots in the pre-release.
-		pos += len(prereleaseIdentifiers) - 1
+		var length int
 
-		for _, v := range prereleaseIdentifiers {
-			pos += v.Len()
+		prereleaseIdentifiers, length, perr = parsePrereleaseIdentifiers(ver[pos:])
+		if perr != nil {
+			return Version{}, perr.shift(pos, ver)
 		}
+
+		pos += length
 	}
 
 	var build buildIdentifiers
@@ -138,44 +216,64 @@ func Parse(ver string) (Version, error) {
 		// Move past the '+'.
 		pos++
 
-		build, err = parseBuild(ver[pos:])
-		if err != nil {
-			return Version{}, fmt.Errorf("failed to parse the build identifiers: %w", err)
+		build, perr = parseBuild(ver[pos:])
+		if perr != nil {
+			return Version{}, perr.shift(pos, ver)
 		}
+
+		pos = len(ver)
+	}
+
+	if pos < len(ver) {
+		return Version{}, newParseError(KindInvalidCharacter, 0, "unexpected character %q", ver[pos]).shift(pos, ver)
 	}
 
 	return Version{
-		Major:      major,
-		Minor:      minor,
-		Patch:      patch,
+		Major:      nums[0],
+		Minor:      nums[1],
+		Patch:      nums[2],
 		Prerelease: Prerelease{identifiers: prereleaseIdentifiers},
 		Build:      build,
+		prefix:     prefix,
 		rawStr:     ver,
 	}, nil
 }
 
-func isAlphanumericIdentifier(c rune) bool {
-	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || unicode.IsDigit(c) || c == '-'
+// isDigit reports whether c is an ASCII digit.
+// The semantic versioning only allows ASCII digits so unicode.IsDigit must not
+// be used.
+func isDigit[T byte | rune](c T) bool {
+	return '0' <= c && c <= '9'
 }
 
-func isPrereleaseSeparator(c rune) bool {
-	return c == '.' || c == '+'
+// isIdentifierChar reports whether c is allowed in pre-release and build
+// identifiers.
+func isIdentifierChar[T byte | rune](c T) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || isDigit(c) || c == '-'
 }
 
-func parseBuild(s string) ([]string, error) {
+// parseBuild parses the dot-separated build identifiers in s.
+// The string must not start with the plus sign that separates the build
+// metadata from the rest of the version and all of it is considered to be part
+// of the build metadata.
+func parseBuild(s string) ([]string, *ParseError) {
 	if s == "" {
-		return nil, fmt.Errorf("cannot parse empty string as a build: %w", errInvalidVersion)
+		return nil, newParseError(KindEmptyIdentifier, 0, "empty build metadata")
 	}
 
+	pos := 0
+
 	result := strings.Split(s, ".")
 	for _, v := range result {
-		if s == "" {
-			return nil, fmt.Errorf("empty string as a dot-separated build identifier: %w", errInvalidVersion)
+		if v == "" {
+			return nil, newParseError(KindEmptyIdentifier, pos, "empty build identifier")
 		}
 
-		if strings.ContainsFunc(v, func(r rune) bool { return !isAlphanumericIdentifier(r) }) {
-			return nil, fmt.Errorf("invalid rune in the build identifier %q: %w", v, errInvalidVersion)
+		if i := strings.IndexFunc(v, func(r rune) bool { return !isIdentifierChar(r) }); i != -1 {
+			return nil, newParseError(KindInvalidCharacter, pos+i, "invalid character in the build identifier %q", v)
 		}
+
+		pos += len(v) + 1
 	}
 
 	return result, nil
@@ -184,114 +282,102 @@ func parseBuild(s string) ([]string, error) {
 // parseNextInt parses the next integer from the given string. The string should
 // be a version string or the next part to parse from a version string adhering
 // to the semantic versioning. The first return value is the parsed interger, or
-// -1 if the parsing fails. The second return value is an error or nil.
-func parseNextInt(s string) (int, error) {
+// -1 if the parsing fails. The second return value is the number of bytes the
+// integer occupies in the string. If allowLeadingZero is false, the number may
+// not have leading zeros.
+func parseNextInt(s string, allowLeadingZero bool) (int, int, *ParseError) {
 	if s == "" {
-		return -1, fmt.Errorf("cannot parse empty string as int: %w", errInvalidVersion)
+		return -1, 0, newParseError(KindMissingNumber, 0, "unexpected end of string")
 	}
 
-	if !unicode.IsDigit(rune(s[0])) {
-		return -1, fmt.Errorf("first character is not a digit: %w", errInvalidVersion)
+	if !isDigit(s[0]) {
+		return -1, 0, newParseError(KindMissingNumber, 0, "first character %q is not a digit", s[0])
 	}
 
 	i := 1
-	for i < len(s) && unicode.IsDigit(rune(s[i])) {
+	for i < len(s) && isDigit(s[i]) {
 		i++
 	}
 
 	// Check that the number has no leading zeros.
-	if s[0] == '0' && i != 1 {
-		return -1, fmt.Errorf("the number has a leading zero: %w", errInvalidVersion)
+	if s[0] == '0' && i != 1 && !allowLeadingZero {
+		return -1, 0, newParseError(KindLeadingZero, 0, "the number %s has a leading zero", s[:i])
 	}
 
 	n, err := strconv.Atoi(s[:i])
 	if err != nil {
-		return -1, fmt.Errorf("failed to convert the string %s to integer: %w", s[:i], err)
+		return -1, 0, newParseError(KindOverflow, 0, "failed to convert %s to integer: %v", s[:i], err)
 	}
 
-	return n, nil
+	return n, i, nil
 }
 
-// parsePrefix parses the possible prefixes for the version string. The program
-// allows using 'ager', 'agricola', or 'v' as a prefix in the version string.
-func parsePrefix(s string) (string, error) {
-	if s == "" {
-		return "", fmt.Errorf("empty string: %w", errInvalidVersion)
-	}
-
-	i := strings.IndexFunc(s, unicode.IsDigit)
-	if i == -1 {
-		return "", fmt.Errorf("version string %q has no digits after the possible prefix: %w", s, errInvalidVersion)
+// parsePrereleaseIdentifiers parses the dot-separated pre-release identifiers
+// from the beginning of s.
+// The string must not start with the hyphen that separates the pre-release from
+// the version core, and the pre-release ends at the first plus sign or at the
+// end of the string.
+// The second return value is the number of bytes in s that the pre-release
+// occupies.
+func parsePrereleaseIdentifiers(s string) ([]prereleaseIdentifier, int, *ParseError) {
+	end := strings.IndexByte(s, '+')
+	if end == -1 {
+		end = len(s)
 	}
 
-	if i == 0 {
-		return "", nil
+	if end == 0 {
+		return nil, 0, newParseError(KindEmptyIdentifier, 0, "empty pre-release")
 	}
 
-	prefix := s[:i]
-	if prefix != "ager" && prefix != "agricola" && prefix != "v" {
-		return "", fmt.Errorf("invalid prefix %q: %w", prefix, errInvalidVersion)
-	}
+	var result []prereleaseIdentifier
 
-	return prefix, nil
-}
+	start := 0
 
-func parsePrereleaseIdentifiers(s string) ([]prereleaseIdentifier, error) {
-	if s == "" {
-		return nil, fmt.Errorf("empty string: %w", errInvalidVersion)
-	}
+	for {
+		stop := end
+		if i := strings.IndexByte(s[start:end], '.'); i != -1 {
+			stop = start + i
+		}
 
-	var builder strings.Builder
+		ident, perr := parsePrereleaseIdentifier(s[start:stop])
+		if perr != nil {
+			return nil, 0, perr.shift(start, s)
+		}
 
-	resultLen := strings.Count(s, ".") + 1
-	if i := strings.IndexRune(s, '+'); i != -1 {
-		resultLen -= strings.Count(s[i:], ".")
-	}
+		result = append(result, ident)
 
-	result := make([]prereleaseIdentifier, resultLen)
+		if stop == end {
+			break
+		}
 
-	i := 0
+		start = stop + 1
+	}
 
-	for j := range len(s) {
-		char := s[j]
-		if !isPrereleaseSeparator(rune(char)) {
-			builder.WriteByte(char)
-		}
+	return result, end, nil
+}
 
-		if isPrereleaseSeparator(rune(char)) || j == len(s)-1 {
-			current := builder.String()
-
-			isAlphanum := strings.ContainsFunc(current, func(r rune) bool { return !unicode.IsDigit(r) })
-
-			switch {
-			case isAlphanum:
-				result[i] = alphanumericIdentifier{current}
-			case current == "0":
-				result[i] = numericIdentifier{0}
-			case current[0] != '0':
-				num, err := strconv.Atoi(current)
-				if err != nil {
-					return nil, fmt.Errorf("failed to convert pre-release identifier to integer: %w", err)
-				}
-
-				result[i] = numericIdentifier{num}
-			default:
-				return nil, fmt.Errorf("invalid pre-release identifier %q: %w", current, errInvalidVersion)
-			}
+// parsePrereleaseIdentifier parses a single pre-release identifier.
+func parsePrereleaseIdentifier(s string) (prereleaseIdentifier, *ParseError) {
+	if s == "" {
+		return nil, newParseError(KindEmptyIdentifier, 0, "empty pre-release identifier")
+	}
 
-			i++
+	if i := strings.IndexFunc(s, func(r rune) bool { return !isIdentifierChar(r) }); i != -1 {
+		return nil, newParseError(KindInvalidCharacter, i, "invalid character in the pre-release identifier %q", s)
+	}
 
-			if char == '+' {
-				break
-			}
+	if strings.ContainsFunc(s, func(r rune) bool { return !isDigit(r) }) {
+		return alphanumericIdentifier{s}, nil
+	}
 
-			builder.Reset()
-		}
+	if s[0] == '0' && len(s) > 1 {
+		return nil, newParseError(KindLeadingZero, 0, "pre-release identifier %q has a leading zero", s)
+	}
 
-		if !isAlphanumericIdentifier(rune(char)) && char != '.' {
-			return nil, fmt.Errorf("invalid pre-release identifier %q: %w", char, errInvalidVersion)
-		}
+	num, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, newParseError(KindOverflow, 0, "failed to convert pre-release identifier to integer: %v", err)
 	}
 
-	return result, nil
+	return numericIdentifier{num}, nil
 }
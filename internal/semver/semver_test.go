@@ -1,11 +1,23 @@
 package semver_test
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/anttikivi/agricola/internal/semver"
 )
 
+// agerParser is a parser that allows the prefixes that are used in the version
+// strings of the tests.
+var agerParser = semver.Parser{ //nolint:gochecknoglobals
+	Prefixes:        []string{"ager", "agricola", "v"},
+	CaseInsensitive: false,
+	Lenient:         false,
+}
+
 var tests = []struct { //nolint:gochecknoglobals
 	in  string
 	out string
@@ -152,7 +164,7 @@ func TestIsValid(t *testing.T) {
 	t.Parallel()
 
 	for _, tt := range tests {
-		ok := semver.IsValid(tt.in)
+		ok := agerParser.IsValid(tt.in)
 		if ok != (tt.out != "") {
 			t.Errorf("IsValid(%q) = %v, want %v", tt.in, ok, !ok)
 		}
@@ -165,7 +177,7 @@ func TestVersionString(t *testing.T) {
 	for _, tt := range tests {
 		// Don't test the cases where the versions don't parse.
 		if tt.out != "" {
-			v, _ := semver.Parse(tt.in)
+			v, _ := agerParser.Parse(tt.in)
 
 			ok := v.String() == tt.out
 			if !ok {
@@ -174,3 +186,339 @@ func TestVersionString(t *testing.T) {
 		}
 	}
 }
+
+// precedence lists versions in increasing order of precedence.
+// The list is the example from the semantic versioning 2.0.0 specification with
+// some additional cases.
+var precedence = []string{ //nolint:gochecknoglobals
+	"0.9.9",
+	"1.0.0-0",
+	"1.0.0-2",
+	"1.0.0-11",
+	"1.0.0-alpha",
+	"1.0.0-alpha.1",
+	"1.0.0-alpha.beta",
+	"1.0.0-beta",
+	"1.0.0-beta.2",
+	"1.0.0-beta.11",
+	"1.0.0-rc.1",
+	"1.0.0",
+	"1.0.1",
+	"1.1.0",
+	"1.10.0",
+	"2.0.0-Z",
+	"2.0.0-a",
+	"2.0.0",
+	"10.0.0",
+}
+
+func mustParse(t *testing.T, s string) semver.Version {
+	t.Helper()
+
+	v, err := agerParser.Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", s, err)
+	}
+
+	return v
+}
+
+func TestParsePrefixes(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range tests {
+		if tt.out == "" {
+			continue
+		}
+
+		_, err := semver.Parse(tt.in)
+
+		wantValid := !strings.HasPrefix(tt.in, "ager") && !strings.HasPrefix(tt.in, "agricola")
+		if (err == nil) != wantValid {
+			t.Errorf("Parse(%q) error = %v, want valid = %v", tt.in, err, wantValid)
+		}
+	}
+}
+
+func TestParser(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		parser semver.Parser
+		in     string
+		out    string
+		prefix string
+	}{
+		{semver.Parser{}, "1.2.3", "1.2.3", ""},
+		{semver.Parser{}, "v1.2.3", "", ""},
+		{semver.Parser{Prefixes: []string{"release-"}}, "release-1.4.2", "1.4.2", "release-"},
+		{semver.Parser{Prefixes: []string{"release-"}}, "Release-1.4.2", "", ""},
+		{semver.Parser{Prefixes: []string{"release-"}, CaseInsensitive: true}, "Release-1.4.2", "1.4.2", "Release-"},
+		{semver.Parser{Prefixes: []string{"release-"}}, "1.4.2", "1.4.2", ""},
+		{semver.Parser{Prefixes: []string{"release-"}}, "release1.4.2", "", ""},
+		{semver.Parser{Prefixes: []string{"v"}, CaseInsensitive: true}, "V1.0.0-rc.1", "1.0.0-rc.1", "V"},
+		{semver.Parser{Prefixes: []string{"app2-"}}, "app2-1.0.0", "1.0.0", "app2-"},
+		{semver.Parser{Prefixes: []string{"v", "version-v"}}, "version-v3.1.0", "3.1.0", "version-v"},
+		{semver.Parser{Prefixes: []string{"ager", "agricola"}}, "agricola1.2.3", "1.2.3", "agricola"},
+		{semver.Parser{Prefixes: []string{"ager", "agricola"}}, "agricolax1.2.3", "", ""},
+		{semver.Parser{Prefixes: []string{"release-"}, Lenient: true}, "release-1.4-alpine", "1.4.0-alpine", "release-"},
+	}
+
+	for _, tt := range tests {
+		v, err := tt.parser.Parse(tt.in)
+		if (err != nil) != (tt.out == "") {
+			t.Errorf("%+v.Parse(%q) error = %v", tt.parser, tt.in, err)
+
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if got := v.FullString(); got != tt.out {
+			t.Errorf("%+v.Parse(%q) = %v, want %v", tt.parser, tt.in, got, tt.out)
+		}
+
+		if got := v.Prefix(); got != tt.prefix {
+			t.Errorf("%+v.Parse(%q).Prefix() = %q, want %q", tt.parser, tt.in, got, tt.prefix)
+		}
+
+		if got := v.Raw(); got != tt.in {
+			t.Errorf("%+v.Parse(%q).Raw() = %q, want %q", tt.parser, tt.in, got, tt.in)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	for i, a := range precedence {
+		for j, b := range precedence {
+			want := 0
+
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+
+			if got := semver.Compare(mustParse(t, a), mustParse(t, b)); got != want {
+				t.Errorf("Compare(%q, %q) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestCompareIgnoresBuild(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a string
+		b string
+	}{
+		{"1.2.3", "1.2.3+meta"},
+		{"1.2.3+a", "1.2.3+b"},
+		{"1.2.3-rc.1+sha.19031c2", "1.2.3-rc.1"},
+		{"v1.0.0", "1.0.0"},
+	}
+
+	for _, tt := range tests {
+		a, b := mustParse(t, tt.a), mustParse(t, tt.b)
+		if !a.Equal(b) || a.Less(b) || b.Less(a) {
+			t.Errorf("%q and %q should have equal precedence", tt.a, tt.b)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	t.Parallel()
+
+	versions := make([]semver.Version, 0, len(precedence))
+	for i := len(precedence) - 1; i >= 0; i-- {
+		versions = append(versions, mustParse(t, precedence[i]))
+	}
+
+	semver.Sort(versions)
+
+	got := make([]string, 0, len(versions))
+	for _, v := range versions {
+		got = append(got, v.String())
+	}
+
+	if !slices.Equal(got, precedence) {
+		t.Errorf("Sort() = %v, want %v", got, precedence)
+	}
+}
+
+func TestVersionFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in     string
+		format string
+		out    string
+	}{
+		{"0.1.0-alpha.24+sha.19031c2.darwin.amd64", "%s", "0.1.0-alpha.24"},
+		{"0.1.0-alpha.24+sha.19031c2.darwin.amd64", "%v", "0.1.0-alpha.24"},
+		{"0.1.0-alpha.24+sha.19031c2.darwin.amd64", "%+v", "0.1.0-alpha.24+sha.19031c2.darwin.amd64"},
+		{"0.1.0-alpha.24+sha.19031c2.darwin.amd64", "%+s", "0.1.0-alpha.24+sha.19031c2.darwin.amd64"},
+		{"v1.2.3+meta", "%q", `"1.2.3"`},
+		{"v1.2.3+meta", "%+q", `"1.2.3+meta"`},
+		{"v1.2.3+meta", "%r", "v1.2.3+meta"},
+		{"ager1.2.3", "%r", "ager1.2.3"},
+		{"1.2.3", "%+v", "1.2.3"},
+		{"1.2.3", "%8s|", "   1.2.3|"},
+		{"1.2.3", "%-8s|", "1.2.3   |"},
+		{"1.2.3", "%d", "%!d(semver.Version=1.2.3)"},
+	}
+
+	for _, tt := range tests {
+		v := mustParse(t, tt.in)
+		if got := fmt.Sprintf(tt.format, v); got != tt.out {
+			t.Errorf("Sprintf(%q, %q) = %q, want %q", tt.format, tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestVersionFullString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		full string
+		raw  string
+	}{
+		{"0.1.0-alpha.24+sha.19031c2.darwin.amd64", "0.1.0-alpha.24+sha.19031c2.darwin.amd64", ""},
+		{"0.1.0-alpha.24+sha.19031c2-darwin-amd64", "0.1.0-alpha.24+sha.19031c2-darwin-amd64", ""},
+		{"v1.2.3+meta-pre.sha.256a", "1.2.3+meta-pre.sha.256a", "v1.2.3+meta-pre.sha.256a"},
+		{"agricola1.2.3-pre+meta", "1.2.3-pre+meta", "agricola1.2.3-pre+meta"},
+		{"1.2.3", "1.2.3", ""},
+	}
+
+	for _, tt := range tests {
+		v := mustParse(t, tt.in)
+		if got := v.FullString(); got != tt.full {
+			t.Errorf("Version{%q}.FullString() = %q, want %q", tt.in, got, tt.full)
+		}
+
+		raw := tt.raw
+		if raw == "" {
+			raw = tt.in
+		}
+
+		if got := v.Raw(); got != raw {
+			t.Errorf("Version{%q}.Raw() = %q, want %q", tt.in, got, raw)
+		}
+	}
+
+	if got := (semver.Version{Major: 1, Build: []string{"b"}}).Raw(); got != "1.0.0+b" {
+		t.Errorf("Raw() of an unparsed version = %q, want %q", got, "1.0.0+b")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		kind semver.ErrorKind
+		pos  int
+	}{
+		{"", semver.KindEmpty, 0},
+		{"bad", semver.KindMissingNumber, 3},
+		{"x1.2.3", semver.KindInvalidPrefix, 0},
+		{"release-1.2.3", semver.KindInvalidPrefix, 0},
+		{"1", semver.KindMissingDot, 1},
+		{"v1.2", semver.KindMissingDot, 4},
+		{"1.2-pre", semver.KindMissingDot, 3},
+		{"01.2.3", semver.KindLeadingZero, 0},
+		{"1.02.3", semver.KindLeadingZero, 2},
+		{"v1.2.03", semver.KindLeadingZero, 5},
+		{"1..3", semver.KindMissingNumber, 2},
+		{"1.2.", semver.KindMissingNumber, 4},
+		{"99999999999999999999.0.0", semver.KindOverflow, 0},
+		{"1.2.3-", semver.KindEmptyIdentifier, 6},
+		{"1.2.3+", semver.KindEmptyIdentifier, 6},
+		{"1.2.3-01", semver.KindLeadingZero, 6},
+		{"1.2.3-alpha.01", semver.KindLeadingZero, 12},
+		{"1.2.3-al_pha", semver.KindInvalidCharacter, 8},
+		{"1.2.3+meta.sh_a", semver.KindInvalidCharacter, 13},
+	}
+
+	for _, tt := range tests {
+		_, err := semver.Parse(tt.in)
+
+		var perr *semver.ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse(%q) error = %v, want *ParseError", tt.in, err)
+
+			continue
+		}
+
+		if perr.Kind != tt.kind || perr.Pos != tt.pos || perr.Input != tt.in {
+			t.Errorf(
+				"Parse(%q) error = {%v, %q, %d}, want {%v, %q, %d}",
+				tt.in,
+				perr.Kind,
+				perr.Input,
+				perr.Pos,
+				tt.kind,
+				tt.in,
+				tt.pos,
+			)
+		}
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"1", "1.0.0"},
+		{"v1", "1.0.0"},
+		{"1.2", "1.2.0"},
+		{"v1.2", "1.2.0"},
+		{"1.2.3", "1.2.3"},
+		{"1.2-alpine", "1.2.0-alpine"},
+		{"1.2.3-alpine3.20", "1.2.3-alpine3.20"},
+		{"3-bookworm", "3.0.0-bookworm"},
+		{"1.25-alpine+build.1", "1.25.0-alpine+build.1"},
+		{"2024.01.05", "2024.1.5"},
+		{"1+meta", "1.0.0+meta"},
+
+		{"", ""},
+		{"latest", ""},
+		{"alpine-1.2", ""},
+		{"1.", ""},
+		{"1.2.", ""},
+		{"1.2-", ""},
+		{"1.2-01", ""},
+		{"1.2+", ""},
+	}
+
+	for _, tt := range tests {
+		v, err := semver.ParseLenient(tt.in)
+		if (err != nil) != (tt.out == "") {
+			t.Errorf("ParseLenient(%q) error = %v", tt.in, err)
+
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if got := v.FullString(); got != tt.out {
+			t.Errorf("ParseLenient(%q) = %v, want %v", tt.in, got, tt.out)
+		}
+
+		if got := v.Raw(); got != tt.in {
+			t.Errorf("ParseLenient(%q).Raw() = %v, want %v", tt.in, got, tt.in)
+		}
+	}
+}
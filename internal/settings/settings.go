@@ -0,0 +1,437 @@
+// Package settings implements the layered configuration of the commands.
+//
+// Every flag of a command is a setting that can also be given as an
+// environment variable or in a configuration file. The value of a setting is
+// taken from the first of the following sources that has it:
+//
+//  1. the command-line flag
+//  2. the environment variable
+//  3. the project configuration file
+//  4. the user configuration file
+//  5. the default value of the flag
+//
+// The key of a setting is the name of the command followed by the name of the
+// flag, separated by dots, for example "self-update.index" or
+// "version.bump.file". The flags of the base command have no command prefix.
+// The environment variable of a setting is the key in upper case with the dots
+// and dashes replaced by underscores and prefixed with "AGER_", for example
+// AGER_SELF_UPDATE_INDEX.
+//
+// The configuration files are JSON objects that nest the settings of each
+// command in an object named after the command, for example:
+//
+//	{
+//	  "self-update": {
+//	    "index": "https://example.com/releases.json"
+//	  }
+//	}
+//
+// The user configuration file is "agricola/config.json" in the directory set
+// by XDG_CONFIG_HOME, or in "~/.config" if it is not set. The project
+// configuration file is ".agricola/config.json" in the working directory or
+// in the closest parent directory that has one.
+//
+// The project configuration file comes with the project, so it must not be
+// able to choose the programs ager runs or the keys it trusts. The flags
+// marked with UserOnly can only be set on the command line, with the
+// environment variables, or in the user configuration file.
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// EnvPrefix is the prefix of the environment variables of the settings.
+	EnvPrefix = "AGER_"
+
+	// configDir and configFile are the directory and the file name of the
+	// configuration files.
+	configDir  = "agricola"
+	configFile = "config.json"
+
+	// projectDir is the directory of the project configuration file.
+	projectDir = ".agricola"
+)
+
+// errInvalidConfig is returned when a configuration file has an invalid value.
+var errInvalidConfig = errors.New("invalid configuration")
+
+// ErrUserOnly is returned when the project configuration file sets a setting
+// that can only be set by the user.
+var ErrUserOnly = errors.New("the setting cannot be set in the project configuration")
+
+// A Kind is a kind of source of a setting.
+type Kind int
+
+const (
+	KindDefault Kind = iota
+	KindUser
+	KindProject
+	KindEnv
+	KindFlag
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case KindDefault:
+		return "default"
+	case KindUser:
+		return "user"
+	case KindProject:
+		return "project"
+	case KindEnv:
+		return "env"
+	case KindFlag:
+		return "flag"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// An Origin is the source of the value of a setting.
+type Origin struct {
+	Kind Kind
+
+	// Name is the name of the environment variable or the path of the
+	// configuration file the value was read from.
+	Name string
+}
+
+func (o Origin) String() string {
+	switch o.Kind {
+	case KindDefault:
+		return "default"
+	case KindUser:
+		return "user config " + o.Name
+	case KindProject:
+		return "project config " + o.Name
+	case KindEnv:
+		return "environment variable " + o.Name
+	case KindFlag:
+		return "command line"
+	default:
+		panic(fmt.Sprintf("invalid setting origin kind: %d", int(o.Kind)))
+	}
+}
+
+// A Value is the resolved value of a single setting.
+type Value struct {
+	// Key is the key of the setting, for example "version.bump.file".
+	Key string
+
+	// Value is the string representation of the value.
+	Value string
+
+	// Origin is where the value came from.
+	Origin Origin
+}
+
+// Settings holds the sources of the settings.
+type Settings struct {
+	lookupEnv func(key string) (string, bool)
+
+	// files are the loaded configuration files from the highest precedence
+	// to the lowest.
+	files []*file
+}
+
+// A file is a loaded configuration file.
+type file struct {
+	origin Origin
+
+	// values are the values in the file by their keys.
+	values map[string]string
+}
+
+// userOnlyValue is the value of a flag marked with UserOnly.
+type userOnlyValue struct {
+	flag.Value
+}
+
+// IsBoolFlag reports whether the wrapped value is a boolean flag so that the
+// flag package still accepts the flag without a value.
+func (v userOnlyValue) IsBoolFlag() bool {
+	b, ok := v.Value.(interface{ IsBoolFlag() bool })
+
+	return ok && b.IsBoolFlag()
+}
+
+// UserOnly marks the flags with the given names in fs as settings that cannot
+// be set in the project configuration file, for example the flags that choose
+// a program to run or a key to trust.
+// It panics if fs has no flag with one of the names.
+func UserOnly(fs *flag.FlagSet, names ...string) {
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil {
+			panic("settings: no flag named " + name)
+		}
+
+		if _, ok := f.Value.(userOnlyValue); !ok {
+			f.Value = userOnlyValue{Value: f.Value}
+		}
+	}
+}
+
+// Env returns the settings that are only read from the environment variables.
+// The lookupEnv function retrieves the environment variables like
+// os.LookupEnv. It is used for the commands that must work even if the
+// configuration files are broken.
+func Env(lookupEnv func(key string) (string, bool)) *Settings {
+	return &Settings{lookupEnv: lookupEnv, files: nil}
+}
+
+// Load loads the user configuration file and the project configuration file
+// for the working directory dir.
+// The lookupEnv function retrieves the environment variables like
+// os.LookupEnv.
+// The configuration files that do not exist are skipped.
+func Load(dir string, lookupEnv func(key string) (string, bool)) (*Settings, error) {
+	s := &Settings{lookupEnv: lookupEnv, files: nil}
+
+	if path := findProjectFile(dir); path != "" {
+		f, err := loadFile(path, KindProject)
+		if err != nil {
+			return nil, err
+		}
+
+		if f != nil {
+			s.files = append(s.files, f)
+		}
+	}
+
+	if path := userFile(lookupEnv); path != "" {
+		f, err := loadFile(path, KindUser)
+		if err != nil {
+			return nil, err
+		}
+
+		if f != nil {
+			s.files = append(s.files, f)
+		}
+	}
+
+	return s, nil
+}
+
+// Apply sets the flags in fs that were not given on the command line from the
+// environment variables and the configuration files.
+// The cmdName is the name of the command the flags belong to, for example
+// "version bump", or an empty string for the base command.
+// It must be called after parsing the flags.
+// Apply returns the resolved values of all of the flags in fs.
+func (s *Settings) Apply(cmdName string, fs *flag.FlagSet) ([]Value, error) {
+	set := make(map[string]bool)
+
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var (
+		values []Value
+		errs   []error
+	)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		key := Key(cmdName, f.Name)
+
+		if set[f.Name] {
+			values = append(values, Value{Key: key, Value: f.Value.String(), Origin: Origin{Kind: KindFlag, Name: ""}})
+
+			return
+		}
+
+		_, userOnly := f.Value.(userOnlyValue)
+
+		v, origin, ok := s.lookup(key)
+		if ok && userOnly && origin.Kind == KindProject {
+			errs = append(errs, fmt.Errorf("%w: %s in %s", ErrUserOnly, key, origin.Name))
+
+			return
+		}
+
+		if !ok {
+			values = append(values, Value{Key: key, Value: f.DefValue, Origin: Origin{Kind: KindDefault, Name: ""}})
+
+			return
+		}
+
+		// Setting the value directly does not mark the flag as set so that
+		// applying the settings again gives the same result.
+		if err := f.Value.Set(v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s from %s: %w", v, key, origin, err))
+
+			return
+		}
+
+		values = append(values, Value{Key: key, Value: f.Value.String(), Origin: origin})
+	})
+
+	return values, errors.Join(errs...)
+}
+
+// lookup returns the value of the setting with the given key from the
+// environment variables or the configuration files.
+func (s *Settings) lookup(key string) (string, Origin, bool) {
+	name := EnvName(key)
+	if s.lookupEnv != nil {
+		if v, ok := s.lookupEnv(name); ok {
+			return v, Origin{Kind: KindEnv, Name: name}, true
+		}
+	}
+
+	for _, f := range s.files {
+		if v, ok := f.values[key]; ok {
+			return v, f.origin, true
+		}
+	}
+
+	return "", Origin{Kind: KindDefault, Name: ""}, false
+}
+
+// Key returns the key of the setting for the flag name of the command
+// cmdName.
+func Key(cmdName, name string) string {
+	parts := append(strings.Fields(cmdName), name)
+
+	return strings.Join(parts, ".")
+}
+
+// EnvName returns the name of the environment variable of the setting with
+// the given key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// userFile returns the path of the user configuration file or an empty string
+// if the configuration directory cannot be determined.
+func userFile(lookupEnv func(key string) (string, bool)) string {
+	getenv := func(key string) string {
+		if lookupEnv == nil {
+			return ""
+		}
+
+		v, _ := lookupEnv(key)
+
+		return v
+	}
+
+	dir := getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, configDir, configFile)
+}
+
+// ProjectDir returns the project directory for the working directory dir, that
+// is the closest directory that has the project configuration file. If there is
+// no project configuration file, ProjectDir returns dir.
+func ProjectDir(dir string) string {
+	path := findProjectFile(dir)
+	if path == "" {
+		return dir
+	}
+
+	return filepath.Dir(filepath.Dir(path))
+}
+
+// findProjectFile returns the path of the project configuration file in dir or
+// in its closest parent directory that has one.
+// It returns an empty string if there is no project configuration file.
+func findProjectFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, projectDir, configFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+
+		dir = parent
+	}
+}
+
+// loadFile reads the configuration file at path.
+// It returns nil if the file does not exist.
+func loadFile(path string, kind Kind) (*file, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil //nolint:nilnil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the configuration file: %w", err)
+	}
+
+	var raw map[string]any
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	if err = d.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse the configuration file %s: %w", path, err)
+	}
+
+	f := &file{origin: Origin{Kind: kind, Name: path}, values: make(map[string]string)}
+	if err = flatten(f.values, "", raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return f, nil
+}
+
+// flatten adds the values in the nested object raw to values by their keys.
+func flatten(values map[string]string, prefix string, raw map[string]any) error {
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch v := raw[k].(type) {
+		case map[string]any:
+			if err := flatten(values, key, v); err != nil {
+				return err
+			}
+		case string:
+			values[key] = v
+		case bool:
+			values[key] = fmt.Sprint(v)
+		case json.Number:
+			values[key] = v.String()
+		default:
+			return fmt.Errorf("%w: value of %s must be a string, a boolean, or a number", errInvalidConfig, key)
+		}
+	}
+
+	return nil
+}
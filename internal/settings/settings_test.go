@@ -0,0 +1,183 @@
+package settings_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/settings"
+)
+
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		cmd  string
+		flag string
+		key  string
+		env  string
+	}{
+		{"", "state-dir", "state-dir", "AGER_STATE_DIR"},
+		{"self-update", "index", "self-update.index", "AGER_SELF_UPDATE_INDEX"},
+		{"version bump", "file", "version.bump.file", "AGER_VERSION_BUMP_FILE"},
+	}
+
+	for _, tt := range tests {
+		if got := settings.Key(tt.cmd, tt.flag); got != tt.key {
+			t.Errorf("Key(%q, %q) = %q, want %q", tt.cmd, tt.flag, got, tt.key)
+		}
+
+		if got := settings.EnvName(tt.key); got != tt.env {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.key, got, tt.env)
+		}
+	}
+}
+
+func TestApplyPrecedence(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	project := t.TempDir()
+	dir := filepath.Join(project, "sub", "dir")
+
+	writeConfig(t, filepath.Join(home, ".config", "agricola", "config.json"),
+		`{"deploy": {"a": "user", "b": "user", "c": "user", "d": "user"}}`)
+	writeConfig(t, filepath.Join(project, ".agricola", "config.json"),
+		`{"deploy": {"a": "project", "b": "project", "c": "project"}}`)
+
+	env := map[string]string{
+		"HOME":            home,
+		"AGER_DEPLOY_A":   "env",
+		"AGER_DEPLOY_B":   "env",
+		"AGER_DEPLOY_UNK": "env",
+	}
+
+	s, err := settings.Load(dir, func(key string) (string, bool) {
+		v, ok := env[key]
+
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	a := fs.String("a", "default", "")
+	b := fs.String("b", "default", "")
+	c := fs.String("c", "default", "")
+	d := fs.String("d", "default", "")
+	e := fs.String("e", "default", "")
+
+	if err = fs.Parse([]string{"-a", "flag"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	values, err := s.Apply("deploy", fs)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	want := []struct {
+		got   string
+		value string
+		kind  settings.Kind
+	}{
+		{*a, "flag", settings.KindFlag},
+		{*b, "env", settings.KindEnv},
+		{*c, "project", settings.KindProject},
+		{*d, "user", settings.KindUser},
+		{*e, "default", settings.KindDefault},
+	}
+
+	for i, w := range want {
+		if w.got != w.value || values[i].Value != w.value || values[i].Origin.Kind != w.kind {
+			t.Errorf("%s = %q from %v, want %q from kind %d", values[i].Key, w.got, values[i].Origin, w.value, w.kind)
+		}
+	}
+}
+
+func TestApplyInvalidValue(t *testing.T) {
+	t.Parallel()
+
+	s, err := settings.Load("", func(key string) (string, bool) {
+		return "nope", key == "AGER_N"
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	fs := flag.NewFlagSet("ager", flag.ContinueOnError)
+	fs.Int("n", 0, "")
+
+	if _, err = s.Apply("", fs); err == nil {
+		t.Error("Apply with an invalid value succeeded")
+	}
+}
+
+func TestApplyUserOnly(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	project := t.TempDir()
+
+	writeConfig(t, filepath.Join(home, ".config", "agricola", "config.json"), `{"deploy": {"key": "user"}}`)
+
+	lookupEnv := func(key string) (string, bool) {
+		if key == "HOME" {
+			return home, true
+		}
+
+		return "", false
+	}
+
+	newFlags := func() (*flag.FlagSet, *string, *bool) {
+		fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+		key := fs.String("key", "default", "")
+		force := fs.Bool("force", false, "")
+		settings.UserOnly(fs, "key", "force")
+
+		return fs, key, force
+	}
+
+	s, err := settings.Load(project, lookupEnv)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	fs, key, force := newFlags()
+
+	// A boolean flag stays a boolean flag when it is marked.
+	if err = fs.Parse([]string{"-force"}); err != nil || !*force {
+		t.Fatalf("Parse() = %v, force = %v", err, *force)
+	}
+
+	if _, err = s.Apply("deploy", fs); err != nil || *key != "user" {
+		t.Errorf("Apply() = %v, key = %q, want the value from the user configuration", err, *key)
+	}
+
+	writeConfig(t, filepath.Join(project, ".agricola", "config.json"), `{"deploy": {"key": "project"}}`)
+
+	if s, err = settings.Load(project, lookupEnv); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	fs, key, _ = newFlags()
+
+	if _, err = s.Apply("deploy", fs); !errors.Is(err, settings.ErrUserOnly) || *key != "default" {
+		t.Errorf("Apply() = %v, key = %q, want %v", err, *key, settings.ErrUserOnly)
+	}
+}
@@ -0,0 +1,322 @@
+// Package state implements the state file that records what Agricola has
+// deployed.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/compat"
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+// filePerm is the permission for the state file.
+const filePerm = 0o600
+
+// dirPerm is the permission for the directories of the state file that are
+// created.
+const dirPerm = 0o755
+
+// lockTimeout is the time Save waits for the lock of the state file and
+// lockInterval the time between the attempts to take it.
+const (
+	lockTimeout  = 10 * time.Second
+	lockInterval = 50 * time.Millisecond
+)
+
+// ErrLocked is returned when the lock of the state file cannot be taken
+// because another process is writing the state.
+var ErrLocked = errors.New("the state is locked")
+
+// defaultFile is the path of the state file relative to the project
+// directory.
+const defaultFile = ".agricola/state.json"
+
+// DefaultPath returns the default path of the state file for the project in
+// projectDir.
+func DefaultPath(projectDir string) string {
+	return filepath.Join(projectDir, filepath.FromSlash(defaultFile))
+}
+
+// State is the deployment state.
+type State struct {
+	// Version is the version of ager that last wrote the state.
+	Version semver.Version `json:"ager_version"`
+
+	// RequiresAger is the version requirement for the versions of ager that
+	// may use the state, for example ">=0.3.0, <0.5.0".
+	// An empty requirement allows every version.
+	RequiresAger string `json:"requires_ager,omitempty"`
+
+	// Sites are the deployed static sites and Docker apps by their names.
+	Sites map[string]*Site `json:"sites,omitempty"`
+}
+
+// A SiteKind is the kind of a deployed site.
+type SiteKind string
+
+const (
+	// KindStatic is the kind of a static site whose releases are directories
+	// and whose active release is selected with a symbolic link.
+	KindStatic SiteKind = "static"
+
+	// KindDocker is the kind of a Docker app whose releases are container
+	// images.
+	KindDocker SiteKind = "docker"
+)
+
+// DefaultKeep is the default number of the releases that are kept for a site.
+const DefaultKeep = 5
+
+// A Site is a deployed static site or Docker app.
+type Site struct {
+	Kind SiteKind `json:"kind"`
+
+	// Link is the path of the symbolic link that points to the directory of
+	// the active release of a static site. A relative path is relative to the
+	// project directory.
+	Link string `json:"link,omitempty"`
+
+	// Current is the ID of the active release.
+	Current string `json:"current,omitempty"`
+
+	// Releases are the kept releases of the site from the oldest to the
+	// newest.
+	Releases []Release `json:"releases"`
+}
+
+// A Release is a deployed release of a site.
+type Release struct {
+	// ID is the identifier of the release that is unique within the site.
+	ID string `json:"id"`
+
+	// CreatedAt is the time the release was deployed.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Path is the directory of a release of a static site. A relative path is
+	// relative to the project directory.
+	Path string `json:"path,omitempty"`
+
+	// Image is the container image of a release of a Docker app.
+	Image string `json:"image,omitempty"`
+
+	// Digest is the digest of the container image that pins the exact image
+	// of the release.
+	Digest string `json:"digest,omitempty"`
+
+	// Config is the container configuration of a release of a Docker app.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// Release returns the release of the site with the given ID.
+// The boolean return value reports whether the release was found.
+func (s *Site) Release(id string) (Release, bool) {
+	for _, r := range s.Releases {
+		if r.ID == id {
+			return r, true
+		}
+	}
+
+	return Release{}, false
+}
+
+// AddRelease adds r as the newest release of the site with the given name and
+// kind, creating the site if it does not exist, and makes it the current
+// release.
+// Only the keep newest releases are kept, and the removed releases are
+// returned so that their files can be cleaned up.
+// If keep is less than one, DefaultKeep is used.
+func (s *State) AddRelease(name string, kind SiteKind, r Release, keep int) []Release {
+	if keep < 1 {
+		keep = DefaultKeep
+	}
+
+	if s.Sites == nil {
+		s.Sites = make(map[string]*Site)
+	}
+
+	site, ok := s.Sites[name]
+	if !ok {
+		site = &Site{Kind: kind, Link: "", Current: "", Releases: nil}
+		s.Sites[name] = site
+	}
+
+	site.Releases = append(site.Releases, r)
+	site.Current = r.ID
+
+	if len(site.Releases) <= keep {
+		return nil
+	}
+
+	removed := slices.Clone(site.Releases[:len(site.Releases)-keep])
+	site.Releases = slices.Clone(site.Releases[len(site.Releases)-keep:])
+
+	return removed
+}
+
+// Load reads the state from the file at path and checks that the running
+// version is compatible with it.
+// If the file does not exist, Load returns an empty state.
+// The errors for incompatible versions wrap compat.ErrIncompatible.
+func Load(path string, running semver.Version) (*State, error) {
+	s, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil {
+		return &State{}, nil
+	}
+
+	if err = compat.CheckRequirement(path, running, s.RequiresAger); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return s, nil
+}
+
+// Save writes the state to the file at path as the running version.
+// It refuses to write the state if the file was last written by a newer version
+// than the running one or if the running version does not satisfy the version
+// requirement of the state.
+// The errors for incompatible versions wrap compat.ErrIncompatible.
+//
+// The file is replaced atomically so that a failed write does not leave
+// a partially written state behind. The missing parent directories of the
+// file are created.
+//
+// The state is checked and written while holding a lock file next to the state
+// file so that concurrent writers cannot both pass the checks. If another
+// process holds the lock, Save waits for it for a while and then returns an
+// error that wraps ErrLocked.
+func Save(path string, s *State, running semver.Version) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return fmt.Errorf("failed to create the state directory: %w", err)
+	}
+
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	current, err := read(path)
+	if err != nil {
+		return err
+	}
+
+	if current != nil {
+		if err = compat.CheckWriter(path, running, current.Version); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	if err = compat.CheckRequirement(path, running, s.RequiresAger); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	s.Version = running
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the state: %w", err)
+	}
+
+	return writeFile(path, append(data, '\n'))
+}
+
+// lock takes the lock of the state file at path by creating the lock file next
+// to it and returns the function that releases the lock.
+func lock(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, filePerm)
+		if err == nil {
+			f.Close()
+
+			return func() {
+				_ = os.Remove(lockPath)
+			}, nil
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to lock the state: %w", err)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: remove %s if no other process is writing the state", ErrLocked, lockPath)
+		}
+
+		time.Sleep(lockInterval)
+	}
+}
+
+// read reads the state from the file at path.
+// It returns nil if the file does not exist.
+func read(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil //nolint:nilnil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the state: %w", err)
+	}
+
+	var s State
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse the state in %s: %w", path, err)
+	}
+
+	return &s, nil
+}
+
+// writeFile atomically replaces the file at path with data.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary state file: %w", err)
+	}
+
+	tmpName := tmp.Name()
+
+	defer func() {
+		// The file no longer exists after a successful rename.
+		_ = os.Remove(tmpName)
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write the state: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write the state: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the state: %w", err)
+	}
+
+	if err = os.Chmod(tmpName, filePerm); err != nil {
+		return fmt.Errorf("failed to set the permissions of the state: %w", err)
+	}
+
+	if err = os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to replace the state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package state_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/compat"
+	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/state"
+)
+
+func mustParse(t *testing.T, s string) semver.Version {
+	t.Helper()
+
+	v, err := semver.Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", s, err)
+	}
+
+	return v
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	t.Parallel()
+
+	// The directory of the state is created when the state is saved.
+	path := filepath.Join(t.TempDir(), ".agricola", "state.json")
+	running := mustParse(t, "0.3.0")
+
+	s, err := state.Load(path, running)
+	if err != nil {
+		t.Fatalf("Load of a missing state failed: %v", err)
+	}
+
+	s.RequiresAger = ">=0.3.0"
+
+	if err = state.Save(path, s, running); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	s, err = state.Load(path, mustParse(t, "0.4.0"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if s.Version.FullString() != "0.3.0" || s.RequiresAger != ">=0.3.0" {
+		t.Errorf("Load() = %+v", s)
+	}
+
+	if _, err = state.Load(path, mustParse(t, "0.2.0")); !errors.Is(err, compat.ErrIncompatible) {
+		t.Errorf("Load by an incompatible version = %v, want %v", err, compat.ErrIncompatible)
+	}
+}
+
+func TestSaveRefusesOlderWriter(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	if err := state.Save(path, &state.State{}, mustParse(t, "0.4.0")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	err := state.Save(path, &state.State{}, mustParse(t, "0.3.9"))
+
+	var werr *compat.WriterError
+	if !errors.As(err, &werr) {
+		t.Fatalf("Save by an older version = %v, want *compat.WriterError", err)
+	}
+
+	if werr.Writer.String() != "0.4.0" || werr.Running.String() != "0.3.9" {
+		t.Errorf("Save by an older version = %+v", werr)
+	}
+
+	if err = state.Save(path, &state.State{}, mustParse(t, "0.4.1")); err != nil {
+		t.Errorf("Save by a newer version failed: %v", err)
+	}
+}
+
+func TestSaveWaitsForLock(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	lockPath := path + ".lock"
+
+	if err := os.WriteFile(lockPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another writer releases the lock after a while.
+	released := make(chan struct{})
+
+	go func() {
+		defer close(released)
+
+		time.Sleep(200 * time.Millisecond) //nolint:mnd
+		os.Remove(lockPath)
+	}()
+
+	if err := state.Save(path, &state.State{}, mustParse(t, "0.4.0")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	<-released
+
+	if _, err := os.Stat(lockPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the lock file was not removed: %v", err)
+	}
+}
+
+func TestAddRelease(t *testing.T) {
+	t.Parallel()
+
+	s := &state.State{}
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		removed := s.AddRelease("blog", state.KindStatic, state.Release{ID: id, Path: "releases/" + id}, 3) //nolint:exhaustruct
+
+		if id == "4" {
+			if len(removed) != 1 || removed[0].ID != "1" {
+				t.Errorf("AddRelease(%q) removed %+v, want the release 1", id, removed)
+			}
+		} else if len(removed) != 0 {
+			t.Errorf("AddRelease(%q) removed %+v, want none", id, removed)
+		}
+	}
+
+	site := s.Sites["blog"]
+	if site.Kind != state.KindStatic || site.Current != "4" || len(site.Releases) != 3 || site.Releases[0].ID != "2" {
+		t.Errorf("site = %+v, want the releases 2 to 4 with 4 as the current one", site)
+	}
+
+	if _, ok := site.Release("1"); ok {
+		t.Error("Release(\"1\") found a removed release")
+	}
+
+	if r, ok := site.Release("3"); !ok || r.Path != "releases/3" {
+		t.Errorf("Release(\"3\") = %+v, %v", r, ok)
+	}
+}
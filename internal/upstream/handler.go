@@ -0,0 +1,96 @@
+package upstream
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// errNotHijacker is returned when the response writer cannot be hijacked.
+var errNotHijacker = errors.New("the response writer does not support hijacking")
+
+// Handler returns a handler that routes every request to an upstream picked
+// from the pool and serves it with the handler returned by serve, for example
+// a reverse proxy to the address of the upstream.
+// The connection to the upstream is counted as active until the request is
+// served, or until the connection is closed if it is hijacked, for example
+// for a WebSocket. If no upstream is available, the handler responds with
+// "503 Service Unavailable".
+func (p *Pool) Handler(serve func(u *Upstream) http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, release, err := p.Pick()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		tw := &trackingWriter{ResponseWriter: w, release: release, hijacked: false}
+
+		defer func() {
+			if !tw.hijacked {
+				release()
+			}
+		}()
+
+		serve(u).ServeHTTP(tw, r)
+	})
+}
+
+// trackingWriter is a response writer that hands the counting of the
+// connection over to the hijacked connection.
+type trackingWriter struct {
+	http.ResponseWriter
+
+	release  func()
+	hijacked bool
+}
+
+// Hijack implements http.Hijacker.
+func (w *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errNotHijacker
+	}
+
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to hijack the connection: %w", err)
+	}
+
+	w.hijacked = true
+
+	return &trackedConn{Conn: conn, release: w.release, once: sync.Once{}}, rw, nil
+}
+
+// Flush implements http.Flusher.
+func (w *trackingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController.
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// trackedConn is a hijacked connection that is counted as active until it is
+// closed.
+type trackedConn struct {
+	net.Conn
+
+	release func()
+	once    sync.Once
+}
+
+// Close closes the connection and records that it was finished.
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+
+	return err //nolint:wrapcheck
+}
@@ -0,0 +1,182 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Pool is the set of the upstreams of an app that the requests are balanced
+// between.
+type Pool struct {
+	mu        sync.Mutex
+	upstreams []*Upstream
+	next      int
+
+	// Metrics are the metrics of the drains of the upstreams in the pool.
+	Metrics *DrainMetrics
+}
+
+// NewPool returns an empty pool.
+func NewPool() *Pool {
+	return &Pool{
+		mu:        sync.Mutex{},
+		upstreams: nil,
+		next:      0,
+		Metrics:   NewDrainMetrics(),
+	}
+}
+
+// Add adds the upstream u to the pool.
+func (p *Pool) Add(u *Upstream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.upstreams = append(p.upstreams, u)
+}
+
+// Get returns the upstream with the given name, or nil if there is none.
+func (p *Pool) Get(name string) *Upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, u := range p.upstreams {
+		if u.Name == name {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// Upstreams returns the upstreams in the pool.
+func (p *Pool) Upstreams() []*Upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Upstream(nil), p.upstreams...)
+}
+
+// Pick chooses the next upstream in rotation in a round-robin order and
+// acquires a connection to it.
+// It returns ErrNoUpstream if every upstream is draining or unhealthy.
+func (p *Pool) Pick() (*Upstream, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for range p.upstreams {
+		u := p.upstreams[p.next%len(p.upstreams)]
+		p.next++
+
+		if !u.available() {
+			continue
+		}
+
+		// The upstream may start draining after the availability check.
+		release, err := u.Acquire()
+		if err != nil {
+			continue
+		}
+
+		return u, release, nil
+	}
+
+	return nil, nil, ErrNoUpstream
+}
+
+// Drain drains the upstream with the given name and records the duration of
+// the drain in the metrics of the pool.
+func (p *Pool) Drain(ctx context.Context, name string) (DrainResult, error) {
+	u := p.Get(name)
+	if u == nil {
+		return DrainResult{}, fmt.Errorf("%w: %q", ErrNoUpstream, name)
+	}
+
+	res, err := u.Drain(ctx)
+	p.Metrics.Observe(res, err != nil)
+
+	return res, err
+}
+
+// Remove drains the upstream with the given name and removes it from the pool.
+// The upstream is removed even if the drain does not finish before ctx is
+// done, and the error of the drain is then returned.
+func (p *Pool) Remove(ctx context.Context, name string) (DrainResult, error) {
+	res, err := p.Drain(ctx, name)
+	if u := p.Get(name); u != nil {
+		p.mu.Lock()
+
+		for i, v := range p.upstreams {
+			if v == u {
+				p.upstreams = append(p.upstreams[:i], p.upstreams[i+1:]...)
+
+				break
+			}
+		}
+
+		p.mu.Unlock()
+	}
+
+	return res, err
+}
+
+// DrainStats are the statistics of how long the drains take.
+type DrainStats struct {
+	// Count is the number of the finished drains.
+	Count int
+
+	// TimedOut is the number of the drains that ended before the connections
+	// had finished.
+	TimedOut int
+
+	// Total is the total duration of the drains.
+	Total time.Duration
+
+	// Max is the duration of the longest drain.
+	Max time.Duration
+}
+
+// Mean returns the mean duration of the drains.
+func (s DrainStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	return s.Total / time.Duration(s.Count)
+}
+
+// DrainMetrics collect the DrainStats of a pool or of the drains of the remote
+// hosts.
+type DrainMetrics struct {
+	mu    sync.Mutex
+	stats DrainStats
+}
+
+// NewDrainMetrics returns empty metrics.
+func NewDrainMetrics() *DrainMetrics {
+	return &DrainMetrics{mu: sync.Mutex{}, stats: DrainStats{Count: 0, TimedOut: 0, Total: 0, Max: 0}}
+}
+
+// Observe records the result of a drain. The timedOut argument reports whether
+// the drain ended before the connections had finished.
+func (m *DrainMetrics) Observe(res DrainResult, timedOut bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats.Count++
+	m.stats.Total += res.Duration
+	m.stats.Max = max(m.stats.Max, res.Duration)
+
+	if timedOut {
+		m.stats.TimedOut++
+	}
+}
+
+// Stats returns the current statistics.
+func (m *DrainMetrics) Stats() DrainStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stats
+}
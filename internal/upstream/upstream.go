@@ -0,0 +1,254 @@
+// Package upstream implements the upstreams of the proxy and the draining of
+// their connections.
+//
+// An Upstream counts its active connections, including the hijacked
+// connections such as WebSockets that outlive their requests. Draining an
+// upstream takes it out of rotation so that it receives no new connections and
+// waits for the active connections to finish up to a deadline, so that an old
+// container can be removed without dropping requests.
+//
+// The Upstream, Pool, and Handler types track the connections inside the
+// proxy that routes to the upstreams. Agricola does not run the proxy itself
+// yet, so they are a library for the proxy. The rollouts and the drain
+// command drain the remote hosts with WaitIdle by counting the connections on
+// the hosts, and they record the drains in DrainMetrics.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/alog"
+	"github.com/anttikivi/agricola/internal/health"
+)
+
+// ErrDraining is returned when a connection is requested from an upstream
+// that is draining.
+var ErrDraining = errors.New("the upstream is draining")
+
+// ErrNoUpstream is returned when a pool has no upstream in rotation.
+var ErrNoUpstream = errors.New("no upstream available")
+
+// An Upstream is a single instance of an app that the proxy routes to.
+type Upstream struct {
+	// Name is the name of the upstream, for example the container name.
+	Name string
+
+	// Address is the address of the upstream in the form "host:port".
+	Address string
+
+	mu        sync.Mutex
+	active    int
+	draining  bool
+	unhealthy bool
+	idle      chan struct{}
+}
+
+// New returns an upstream in rotation.
+func New(name, address string) *Upstream {
+	return &Upstream{
+		Name:      name,
+		Address:   address,
+		mu:        sync.Mutex{},
+		active:    0,
+		draining:  false,
+		unhealthy: false,
+		idle:      nil,
+	}
+}
+
+// Acquire records a new connection to the upstream and returns the function
+// that must be called when the connection is finished.
+// It returns ErrDraining if the upstream is draining.
+func (u *Upstream) Acquire() (func(), error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.draining {
+		return nil, fmt.Errorf("%s: %w", u.Name, ErrDraining)
+	}
+
+	u.active++
+
+	var once sync.Once
+
+	return func() { once.Do(u.release) }, nil
+}
+
+// release records that a connection was finished.
+func (u *Upstream) release() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.active--
+
+	if u.active == 0 && u.idle != nil {
+		close(u.idle)
+		u.idle = nil
+	}
+}
+
+// Active returns the number of the active connections.
+func (u *Upstream) Active() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.active
+}
+
+// Draining reports whether the upstream is out of rotation.
+func (u *Upstream) Draining() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.draining
+}
+
+// SetHealthy sets whether the upstream is healthy. The unhealthy upstreams are
+// not routed to, but unlike the draining ones they return to the rotation
+// when they become healthy again.
+func (u *Upstream) SetHealthy(healthy bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.unhealthy = !healthy
+}
+
+// Follow makes the upstream follow the status of the health checker c so that
+// it is only routed to while c reports it as healthy. A starting upstream is
+// not routed to before it has passed the health checks.
+func (u *Upstream) Follow(c *health.Checker) {
+	c.OnChange(func(s health.Status) {
+		u.SetHealthy(s == health.StatusHealthy)
+	})
+
+	status, _ := c.Status()
+	u.SetHealthy(status == health.StatusHealthy)
+}
+
+// available reports whether new connections can be routed to the upstream.
+func (u *Upstream) available() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return !u.draining && !u.unhealthy
+}
+
+// A DrainResult is the result of draining an upstream.
+type DrainResult struct {
+	// Duration is how long the drain took.
+	Duration time.Duration
+
+	// Remaining is the number of the connections that were still active when
+	// the drain ended. It is zero unless the drain timed out.
+	Remaining int
+}
+
+// Drain takes the upstream out of rotation and waits until its active
+// connections have finished or ctx is done.
+// If ctx is done first, Drain returns the cause of ctx along with the result.
+// The upstream stays out of rotation until Restore is called.
+func (u *Upstream) Drain(ctx context.Context) (DrainResult, error) {
+	start := time.Now()
+
+	u.mu.Lock()
+	u.draining = true
+
+	var idle chan struct{}
+
+	if u.active > 0 {
+		if u.idle == nil {
+			u.idle = make(chan struct{})
+		}
+
+		idle = u.idle
+	}
+
+	active := u.active
+	u.mu.Unlock()
+
+	alog.Infof("Draining %s with %d active connections", u.Name, active)
+
+	if idle != nil {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			res := DrainResult{Duration: time.Since(start), Remaining: u.Active()}
+			alog.Warningf("Draining %s stopped with %d active connections after %v", u.Name, res.Remaining, res.Duration)
+
+			return res, context.Cause(ctx) //nolint:wrapcheck
+		}
+	}
+
+	res := DrainResult{Duration: time.Since(start), Remaining: 0}
+	alog.Infof("Drained %s in %v", u.Name, res.Duration)
+
+	return res, nil
+}
+
+// WaitIdle waits until the number of the active connections of the upstream
+// with the given name is zero or ctx is done. It is the drain of an upstream
+// whose connections are counted outside of this process, for example by the
+// proxy on a remote host that has already taken the upstream out of rotation.
+// The active function returns the current number of the connections, and it
+// is called after every interval until the connections have finished.
+// If ctx is done first, WaitIdle returns the cause of ctx along with the
+// result, and an error of active is returned as is.
+func WaitIdle(ctx context.Context, name string, active func(ctx context.Context) (int, error), interval time.Duration) (DrainResult, error) { //nolint:lll
+	start := time.Now()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// last is the latest number of the active connections, or -1 before the
+	// first count.
+	last := -1
+
+	for {
+		n, err := active(ctx)
+
+		switch {
+		case err != nil && ctx.Err() != nil && last >= 0:
+			// The count was interrupted by ctx, so the previous count is the
+			// best known number of the remaining connections.
+			return timedOut(ctx, name, start, last)
+		case err != nil:
+			return DrainResult{Duration: time.Since(start), Remaining: 0}, err
+		case n == 0:
+			res := DrainResult{Duration: time.Since(start), Remaining: 0}
+			alog.Infof("Drained %s in %v", name, res.Duration)
+
+			return res, nil
+		}
+
+		last = n
+
+		alog.Infof("Waiting for %d active connections of %s", n, name)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return timedOut(ctx, name, start, n)
+		}
+	}
+}
+
+// timedOut returns the result of a drain of the upstream with the given name
+// that was started at start and stopped by ctx with n active connections.
+func timedOut(ctx context.Context, name string, start time.Time, n int) (DrainResult, error) {
+	res := DrainResult{Duration: time.Since(start), Remaining: n}
+	alog.Warningf("Draining %s stopped with %d active connections after %v", name, res.Remaining, res.Duration)
+
+	return res, context.Cause(ctx) //nolint:wrapcheck
+}
+
+// Restore puts the upstream back into rotation after a drain.
+func (u *Upstream) Restore() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.draining = false
+}
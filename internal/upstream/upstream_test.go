@@ -0,0 +1,277 @@
+package upstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anttikivi/agricola/internal/health"
+	"github.com/anttikivi/agricola/internal/upstream"
+)
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	u := upstream.New("app-1", "127.0.0.1:8080")
+
+	release, err := u.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := u.Drain(context.Background())
+		done <- err
+	}()
+
+	// Wait for the drain to take the upstream out of rotation.
+	for !u.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err = u.Acquire(); !errors.Is(err, upstream.ErrDraining) {
+		t.Errorf("Acquire() while draining = %v, want %v", err, upstream.ErrDraining)
+	}
+
+	select {
+	case err = <-done:
+		t.Fatalf("Drain() returned %v with an active connection", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	release()
+	release() // Releasing twice has no effect.
+
+	if err = <-done; err != nil {
+		t.Errorf("Drain() = %v", err)
+	}
+
+	if n := u.Active(); n != 0 {
+		t.Errorf("Active() = %d, want 0", n)
+	}
+
+	u.Restore()
+
+	if _, err = u.Acquire(); err != nil {
+		t.Errorf("Acquire() after Restore() = %v", err)
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	t.Parallel()
+
+	pool := upstream.NewPool()
+	pool.Add(upstream.New("app-1", "127.0.0.1:8080"))
+
+	if _, _, err := pool.Pick(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	res, err := pool.Drain(ctx, "app-1")
+	if !errors.Is(err, context.DeadlineExceeded) || res.Remaining != 1 {
+		t.Errorf("Drain() = %+v, %v, want one remaining connection and %v", res, err, context.DeadlineExceeded)
+	}
+
+	m := pool.Metrics.Stats()
+	if m.Count != 1 || m.TimedOut != 1 || m.Max < 10*time.Millisecond || m.Mean() != m.Total {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestWaitIdle(t *testing.T) {
+	t.Parallel()
+
+	counts := []int{2, 1, 0}
+	active := func(context.Context) (int, error) {
+		n := counts[0]
+		counts = counts[1:]
+
+		return n, nil
+	}
+
+	res, err := upstream.WaitIdle(context.Background(), "app-1", active, time.Millisecond)
+	if err != nil || res.Remaining != 0 || len(counts) != 0 {
+		t.Errorf("WaitIdle() = %+v, %v with %d counts left, want a finished drain", res, err, len(counts))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	res, err = upstream.WaitIdle(ctx, "app-1", func(context.Context) (int, error) { return 3, nil }, time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || res.Remaining != 3 {
+		t.Errorf("WaitIdle() = %+v, %v, want three remaining connections and %v", res, err, context.DeadlineExceeded)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	t.Parallel()
+
+	pool := upstream.NewPool()
+	u := upstream.New("app-1", "")
+	pool.Add(u)
+
+	c := health.NewChecker("app-1", health.ProbeFunc(func(context.Context) error { return nil }), health.Config{
+		Interval:           0,
+		Timeout:            0,
+		StartPeriod:        0,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+	u.Follow(c)
+
+	if _, _, err := pool.Pick(); !errors.Is(err, upstream.ErrNoUpstream) {
+		t.Errorf("Pick() of a starting upstream = %v, want %v", err, upstream.ErrNoUpstream)
+	}
+
+	c.Observe(nil, time.Now())
+
+	if _, release, err := pool.Pick(); err != nil {
+		t.Errorf("Pick() of a healthy upstream = %v", err)
+	} else {
+		release()
+	}
+
+	c.Observe(errors.New("down"), time.Now()) //nolint:err113
+
+	if _, _, err := pool.Pick(); !errors.Is(err, upstream.ErrNoUpstream) {
+		t.Errorf("Pick() of an unhealthy upstream = %v, want %v", err, upstream.ErrNoUpstream)
+	}
+}
+
+func TestPick(t *testing.T) {
+	t.Parallel()
+
+	pool := upstream.NewPool()
+	for i := 1; i <= 3; i++ {
+		pool.Add(upstream.New(fmt.Sprintf("app-%d", i), ""))
+	}
+
+	pool.Get("app-3").SetHealthy(false)
+
+	var names []string
+
+	for range 4 {
+		u, release, err := pool.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		release()
+
+		names = append(names, u.Name)
+	}
+
+	if got, want := fmt.Sprint(names), "[app-1 app-2 app-1 app-2]"; got != want {
+		t.Errorf("picked %s, want %s", got, want)
+	}
+
+	if _, err := pool.Remove(context.Background(), "app-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pool.Drain(context.Background(), "app-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pool.Pick(); !errors.Is(err, upstream.ErrNoUpstream) {
+		t.Errorf("Pick() = %v, want %v", err, upstream.ErrNoUpstream)
+	}
+
+	if n := len(pool.Upstreams()); n != 2 {
+		t.Errorf("the pool has %d upstreams after Remove(), want 2", n)
+	}
+}
+
+func TestHandlerTracksHijackedConnections(t *testing.T) {
+	t.Parallel()
+
+	pool := upstream.NewPool()
+	u := upstream.New("app-1", "")
+	pool.Add(u)
+
+	closeConn := make(chan struct{})
+
+	srv := httptest.NewServer(pool.Handler(func(*upstream.Upstream) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/ws" {
+				fmt.Fprint(w, "ok")
+
+				return
+			}
+
+			conn, rw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			rw.Flush()
+
+			go func() {
+				<-closeConn
+				conn.Close()
+			}()
+		})
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if n := u.Active(); n != 0 {
+		t.Errorf("Active() after a request = %d, want 0", n)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	if n := u.Active(); n != 1 {
+		t.Errorf("Active() with an open WebSocket = %d, want 1", n)
+	}
+
+	close(closeConn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err = pool.Drain(ctx, "app-1"); err != nil {
+		t.Errorf("Drain() after the WebSocket was closed = %v", err)
+	}
+
+	resp2 := httptest.NewRecorder()
+	pool.Handler(nil).ServeHTTP(resp2, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if resp2.Code != http.StatusServiceUnavailable {
+		t.Errorf("status while drained = %d, want %d", resp2.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	_ "embed"
-	"flag"
 	"fmt"
 	"os"
 	"runtime"
@@ -11,14 +11,34 @@ import (
 
 	"github.com/anttikivi/agricola/internal/alog"
 	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/command/completion"
+	"github.com/anttikivi/agricola/internal/command/config"
+	"github.com/anttikivi/agricola/internal/command/gendocs"
 	"github.com/anttikivi/agricola/internal/command/help"
+	"github.com/anttikivi/agricola/internal/command/releases"
+	"github.com/anttikivi/agricola/internal/command/remote"
+	"github.com/anttikivi/agricola/internal/command/selfupdate"
 	"github.com/anttikivi/agricola/internal/command/version"
 	"github.com/anttikivi/agricola/internal/crash"
+	"github.com/anttikivi/agricola/internal/lifecycle"
+	"github.com/anttikivi/agricola/internal/plugin"
 	"github.com/anttikivi/agricola/internal/semver"
+	"github.com/anttikivi/agricola/internal/settings"
+	"github.com/anttikivi/agricola/internal/state"
 )
 
 const helpCmdName = "help"
 
+// versionCmdName is the name of the command that prints the version.
+const versionCmdName = "version"
+
+// outputFlagName is the name of the global flag that sets the output format.
+const outputFlagName = "output"
+
+// statePathFlagName is the name of the global flag that sets the path of the
+// state file.
+const statePathFlagName = "state-path"
+
 // rawVersion is the raw version value read from the VERSION file. It is used
 // if buildVersion is not set.
 //
@@ -29,6 +49,15 @@ var rawVersion string
 // over the value embedded from the VERSION file if set.
 var buildVersion string //nolint:gochecknoglobals
 
+// releaseIndex is the default location of the release index used by the
+// self-update command. It is set using linker flags at build time.
+var releaseIndex string //nolint:gochecknoglobals
+
+// releasePublicKey is the base64-encoded Ed25519 public key that is used to
+// verify the releases in the self-update command. It is set using linker flags
+// at build time.
+var releasePublicKey string //nolint:gochecknoglobals
+
 func main() {
 	os.Exit(run())
 }
@@ -47,45 +76,116 @@ func run() int {
 
 	ver := parseVersion()
 
+	crash.SetVersion(ver.FullString())
+
 	alog.V(1).Infof("Raw version information: %s", rawVersionString())
 	alog.Infof("%s version: %v", command.Name, ver)
 	alog.Infof("Go runtime version: %s", runtime.Version())
-	alog.Infof("CLI args: %#v", os.Args)
+	alog.Infof("CLI args: %#v", crash.SanitizeArgs(os.Args))
 
-	ager := command.BaseCommand()
-	ager.Commands = []*command.Command{
-		version.Command(ver),
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting the working directory: %v\n", err)
+
+		return command.ExitFailure
+	}
+
+	lc := lifecycle.New()
+	ctx := lc.Start(context.Background())
+
+	defer lc.Shutdown()
+
+	env := &command.Env{
+		Context:   ctx,
+		Stdin:     os.Stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Dir:       wd,
+		LookupEnv: os.LookupEnv,
+		Environ:   os.Environ,
 	}
 
-	flag.Usage = func() { help.PrintUsage(ager) }
-	flag.Parse()
+	return execute(env, ver, os.Args[1:])
+}
 
-	args := flag.Args()
+// execute parses the global flags from args and runs the specified command in
+// the given environment.
+// The return value is the exit code of the program.
+func execute(env *command.Env, ver semver.Version, args []string) int {
+	ager := commandTree(ver)
+	crash.SetBoolFlags(func(name string) bool {
+		return isBoolFlag(ager, name)
+	})
 
-	alog.Infof("Arguments after parsing the global flags: %#v", args)
+	if err := ager.Flag.Parse(args); err != nil {
+		fmt.Fprintf(env.Stderr, "Error parsing command-line flags: %v\n", err)
+		help.PrintUsage(env.Stderr, ager)
 
-	if len(args) < 1 {
-		help.PrintUsage(ager)
+		return command.ExitInvalidArgs
+	}
+
+	args = ager.Flag.Args()
+
+	alog.Infof("Arguments after parsing the global flags: %#v", crash.SanitizeArgs(args))
+
+	// The help and the version must work even if the configuration files are
+	// broken, so they only read the settings from the environment.
+	conf := settings.Env(env.LookupEnv)
+
+	if needsConfig(ager, args) {
+		var err error
+
+		conf, err = settings.Load(env.Dir, env.LookupEnv)
+		if err != nil {
+			fmt.Fprintf(env.Stderr, "Error loading the configuration: %v\n", err)
+
+			return command.ExitFailure
+		}
+	}
+
+	if _, err := conf.Apply("", ager.Flag); err != nil {
+		fmt.Fprintf(env.Stderr, "Error applying the configuration: %v\n", err)
 
 		return command.ExitInvalidArgs
 	}
 
+	if f, ok := ager.Flag.Lookup(outputFlagName).Value.(*command.Format); ok {
+		env.Output = *f
+	}
+
+	if len(args) < 1 {
+		return usageError(env, ager)
+	}
+
 	// TODO: Should I also allow using "-h", "-help", and "--help" flags?
 	if args[0] == helpCmdName {
-		return help.Help(args[1:])
+		var plugins []plugin.Plugin
+		if len(args) == 1 {
+			plugins = plugin.List(env.Getenv("PATH"))
+		}
+
+		return help.Help(env.Stdout, ager, plugins, args[1:])
+	}
+
+	// The plugins are only run if there is no built-in command with the exact
+	// name so that a plugin is not shadowed by a prefix of a command name.
+	if !isCommandName(ager, args[0]) {
+		if p, ok := plugin.Lookup(args[0], env.Getenv("PATH")); ok {
+			alog.Infof("Running the plugin %s at %s", p.Name, p.Path)
+
+			return plugin.Run(env, p, args[1:], pluginVars(env, ager, ver))
+		}
 	}
 
 	cmd, used := lookupCmd(ager, args)
-	if len(cmd.Commands) > 0 {
+	if len(cmd.Commands) > 0 && !cmd.Runnable() {
 		if used >= len(args) {
-			help.PrintUsage(cmd)
-
-			return command.ExitInvalidArgs
+			return usageError(env, cmd)
 		}
 
 		if args[used] == helpCmdName {
 			// Accept "ager plow help" and "ager plow help foo" for "ager help plow" and "ager help plow foo".
-			help.Help(append(slices.Clip(args[:used]), args[used+1:]...))
+			help.Help(env.Stdout, ager, nil, append(slices.Clip(args[:used]), args[used+1:]...))
 
 			return command.ExitSuccess
 		}
@@ -95,44 +195,166 @@ func run() int {
 			helpArg = " " + strings.Join(args[:used], " ")
 		}
 
-		cmdName := strings.Join(args[:used], " ")
-		if cmdName == "" {
-			cmdName = args[0]
-		}
+		var msg strings.Builder
 
-		fmt.Fprintf(
-			os.Stderr,
-			"%s %s: unknown command\nRun '%s help%s' for usage\n",
-			command.CommandName,
-			cmdName,
-			command.CommandName,
-			helpArg,
-		)
+		fmt.Fprintf(&msg, "%s %s: unknown command\n", command.CommandName, strings.Join(args[:used+1], " "))
+		command.PrintSuggestions(&msg, command.CommandName+helpArg+" ", cmd.SuggestCommands(args[used]))
+		fmt.Fprintf(&msg, "Run '%s help%s' for usage", command.CommandName, helpArg)
 
-		return command.ExitInvalidArgs
+		return env.Errorf(command.ExitCommandNotFound, "%s", msg.String())
 	}
 
-	exitCode := invoke(cmd, args[used-1:])
+	exitCode := invoke(env, conf, cmd, args[used-1:])
 
 	return exitCode
 }
 
-func invoke(cmd *command.Command, args []string) int {
+// commandTree returns the base command with all of the commands registered.
+func commandTree(ver semver.Version) *command.Command {
+	ager := command.BaseCommand()
+	ager.Flag = command.DefaultFlagSet(command.CommandName)
+	ager.Flag.Var(new(command.Format), outputFlagName, "the output `format`, \"text\" or \"json\"")
+	ager.Flag.String(statePathFlagName, "", "the `path` of the state file, \".agricola/state.json\" in the project directory by default") //nolint:lll
+	statePath := func(env *command.Env) string {
+		return statePathOf(env, ager)
+	}
+
+	ager.Commands = []*command.Command{
+		version.Command(ver),
+		selfupdate.Command(ver, releaseIndex, releasePublicKey),
+		completion.Command(ager),
+		completion.CompleteCommand(ager),
+		config.Command(ager),
+		remote.Command(ver),
+		remote.DrainCommand(ver),
+		releases.Command(ver, statePath),
+		releases.RollbackCommand(ver, statePath),
+		gendocs.Command(ager),
+	}
+
+	return ager
+}
+
+func invoke(env *command.Env, conf *settings.Settings, cmd *command.Command, args []string) int {
+	cmd.Flag.Usage = func() {
+		if env.Output != command.FormatJSON {
+			cmd.Usage(env.Stderr)
+		}
+	}
+
 	if err := cmd.Flag.Parse(args[1:]); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing command-line flags: %v\n", err)
+		var msg strings.Builder
 
-		return command.ExitInvalidArgs
+		fmt.Fprintf(&msg, "Error parsing command-line flags: %v", err)
+
+		// The flag package does not export an error for the undefined flags.
+		if name, ok := strings.CutPrefix(err.Error(), "flag provided but not defined: "); ok {
+			msg.WriteString("\n")
+			command.PrintSuggestions(&msg, "-", command.SuggestFlags(cmd.Flag, strings.TrimLeft(name, "-")))
+		}
+
+		return env.Errorf(command.ExitInvalidArgs, "%s", strings.TrimSuffix(msg.String(), "\n"))
+	}
+
+	if _, err := conf.Apply(cmd.LongName(), cmd.Flag); err != nil {
+		return env.Errorf(command.ExitInvalidArgs, "Error applying the configuration: %v", err)
 	}
 
 	args = cmd.Flag.Args()
-	alog.Infof("Running %s command with arguments: %#v", cmd.Name(), args)
+	alog.Infof("Running %s command with arguments: %#v", cmd.Name(), crash.SanitizeArgs(args))
+
+	return cmd.Run(env, cmd, args)
+}
+
+// needsConfig reports whether the command run with args loads the
+// configuration files. The help and the version commands do not.
+func needsConfig(ager *command.Command, args []string) bool {
+	if len(args) == 0 || args[0] == helpCmdName {
+		return false
+	}
+
+	cmd, _ := lookupCmd(ager, args)
+
+	return cmd.LongName() != versionCmdName
+}
+
+// isBoolFlag reports whether every flag with the given name in the command
+// tree of cmd is a boolean flag. It reports false if there is no such flag.
+func isBoolFlag(cmd *command.Command, name string) bool {
+	found, isBool := false, true
+
+	var visit func(c *command.Command)
+
+	visit = func(c *command.Command) {
+		if c.Flag != nil {
+			if f := c.Flag.Lookup(name); f != nil {
+				b, ok := f.Value.(interface{ IsBoolFlag() bool })
+				found = true
+				isBool = isBool && ok && b.IsBoolFlag()
+			}
+		}
+
+		for _, sub := range c.Commands {
+			visit(sub)
+		}
+	}
+
+	visit(cmd)
+
+	return found && isBool
+}
+
+// isCommandName reports whether name is the name or an alias of a subcommand
+// of cmd.
+func isCommandName(cmd *command.Command, name string) bool {
+	sub := cmd.Lookup(name)
+
+	return sub != nil && (sub.Name() == name || slices.Contains(sub.Aliases, name))
+}
+
+// pluginVars returns the context of the run for the plugins.
+func pluginVars(env *command.Env, ager *command.Command, ver semver.Version) plugin.Vars {
+	return plugin.Vars{
+		Version:    ver.FullString(),
+		ProjectDir: settings.ProjectDir(env.Dir),
+		StatePath:  statePathOf(env, ager),
+		Verbosity:  int(alog.Verbosity()),
+		Output:     env.Output,
+	}
+}
+
+// statePathOf returns the path of the state file set with the global flag of
+// ager, or the default path in the project directory.
+func statePathOf(env *command.Env, ager *command.Command) string {
+	path := ager.Flag.Lookup(statePathFlagName).Value.String()
+	if path == "" {
+		return state.DefaultPath(settings.ProjectDir(env.Dir))
+	}
+
+	return env.Path(path)
+}
+
+// usageError reports that the command group cmd was run without a command and
+// returns the exit code for it.
+func usageError(env *command.Env, cmd *command.Command) int {
+	if env.Output == command.FormatJSON {
+		return env.Errorf(command.ExitInvalidArgs, "no command given, run '%s help' for usage", fullName(cmd))
+	}
+
+	help.PrintUsage(env.Stderr, cmd)
+
+	return command.ExitInvalidArgs
+}
 
-	return cmd.Run(cmd, args)
+// fullName returns the full name of cmd including the program name.
+func fullName(cmd *command.Command) string {
+	return strings.TrimSpace(command.CommandName + " " + cmd.LongName())
 }
 
 // lookupCmd finds the initial command to run from the base command and the
 // given args.
-// It tries to find the first runnable command or a subcommand group.
+// It tries to find the first runnable command that is not followed by the name
+// of its subcommand, or a subcommand group.
 // It returns the found command and the number of arguments used in the lookup.
 func lookupCmd(baseCmd *command.Command, args []string) (*command.Command, int) {
 	cmd, used := baseCmd, 0
@@ -146,6 +368,12 @@ func lookupCmd(baseCmd *command.Command, args []string) (*command.Command, int)
 			cmd = c
 			used++
 
+			// A runnable command may also have subcommands, for example
+			// "ager version bump".
+			if used < len(args) && len(c.Commands) > 0 && c.Lookup(args[used]) != nil {
+				continue
+			}
+
 			break
 		}
 
@@ -167,13 +395,13 @@ func lookupCmd(baseCmd *command.Command, args []string) (*command.Command, int)
 }
 
 // parseVersion parses the program version from the version data set during
-// build.
+// build with version.Parse.
 // It panics if the version cannot be parsed as the version string set during
 // builds must not be an invalid version.
 func parseVersion() semver.Version {
-	v, err := semver.Parse(rawVersionString())
+	v, err := version.Parse(rawVersionString())
 	if err != nil {
-		panic(fmt.Sprintf("failed to parse the version: %v", err))
+		panic(err.Error())
 	}
 
 	return v
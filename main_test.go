@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anttikivi/agricola/internal/command"
+	"github.com/anttikivi/agricola/internal/command/gendocs"
+	"github.com/anttikivi/agricola/internal/semver"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the CLI tests") //nolint:gochecknoglobals
+
+// TestCLI runs the command-line cases in testdata/cli.
+//
+// Each case is a directory that contains the following files:
+//
+//   - args: the command-line arguments, one per line
+//   - stdout: the expected standard output
+//   - stderr: the expected standard error
+//   - exitcode: the expected exit code
+//
+// If the case has an "env" file, the environment variables in it are given to
+// the command, one KEY=VALUE pair per line. Otherwise the command runs without
+// any environment variables.
+//
+// If the case has a "files" directory, its contents are copied to the working
+// directory of the command before running it. If the case has a "want"
+// directory, the working directory must contain the files in it with the same
+// contents after running the command.
+//
+// The strings $WORK, $VERSION, $GOOS, and $GOARCH in the expected output are
+// replaced with the working directory and the values of the test run, and
+// $DURATION matches any duration. Run the tests with the -update flag to
+// rewrite the expected output. The durations are only replaced with $DURATION
+// in the files that already have it. The updated output must be checked for
+// values that need to be replaced with the placeholders.
+func TestCLI(t *testing.T) {
+	t.Parallel()
+
+	ver, err := semver.Parse("0.3.0-rc.1+abc")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	cases, err := os.ReadDir(filepath.Join("testdata", "cli"))
+	if err != nil {
+		t.Fatalf("failed to read the test cases: %v", err)
+	}
+
+	for _, c := range cases {
+		if !c.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join("testdata", "cli", c.Name())
+
+		t.Run(c.Name(), func(t *testing.T) {
+			t.Parallel()
+			runCLICase(t, dir, ver)
+		})
+	}
+}
+
+func runCLICase(t *testing.T, dir string, ver semver.Version) {
+	t.Helper()
+
+	var args []string
+
+	for _, line := range strings.Split(readFile(t, filepath.Join(dir, "args")), "\n") {
+		if line != "" {
+			args = append(args, line)
+		}
+	}
+
+	workDir := t.TempDir()
+	if _, err := os.Stat(filepath.Join(dir, "files")); err == nil {
+		copyDir(t, filepath.Join(dir, "files"), workDir)
+	}
+
+	replacer := strings.NewReplacer(
+		"$WORK", workDir,
+		"$VERSION", ver.FullString(),
+		"$GOOS", runtime.GOOS,
+		"$GOARCH", runtime.GOARCH,
+	)
+
+	vars := make(map[string]string)
+
+	if data, err := os.ReadFile(filepath.Join(dir, "env")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if k, v, ok := strings.Cut(line, "="); ok {
+				vars[k] = replacer.Replace(v)
+			}
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	env := &command.Env{
+		Context: context.Background(),
+		Stdin:   strings.NewReader(""),
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		Dir:     workDir,
+		LookupEnv: func(key string) (string, bool) {
+			v, ok := vars[key]
+
+			return v, ok
+		},
+		Environ: func() []string {
+			environ := make([]string, 0, len(vars))
+			for k, v := range vars {
+				environ = append(environ, k+"="+v)
+			}
+
+			return environ
+		},
+	}
+
+	code := execute(env, ver, args)
+
+	if *update {
+		unreplacer := strings.NewReplacer(
+			workDir, "$WORK",
+			ver.FullString(), "$VERSION",
+			runtime.GOOS+"/"+runtime.GOARCH, "$GOOS/$GOARCH",
+			runtime.GOOS, "$GOOS",
+			runtime.GOARCH, "$GOARCH",
+		)
+		writeGolden(t, filepath.Join(dir, "stdout"), unreplacer.Replace(stdout.String()))
+		writeGolden(t, filepath.Join(dir, "stderr"), unreplacer.Replace(stderr.String()))
+		writeFile(t, filepath.Join(dir, "exitcode"), strconv.Itoa(code)+"\n")
+
+		return
+	}
+
+	if want := replacer.Replace(readFile(t, filepath.Join(dir, "stdout"))); !matchOutput(want, stdout.String()) {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+
+	if want := replacer.Replace(readFile(t, filepath.Join(dir, "stderr"))); !matchOutput(want, stderr.String()) {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+
+	want, err := strconv.Atoi(strings.TrimSpace(readFile(t, filepath.Join(dir, "exitcode"))))
+	if err != nil {
+		t.Fatalf("invalid exit code file: %v", err)
+	}
+
+	if code != want {
+		t.Errorf("exit code = %d, want %d", code, want)
+	}
+
+	wantDir := filepath.Join(dir, "want")
+	if _, err = os.Stat(wantDir); err != nil {
+		return
+	}
+
+	err = filepath.WalkDir(wantDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(wantDir, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if got, want := readFile(t, filepath.Join(workDir, rel)), readFile(t, path); got != want {
+			t.Errorf("file %s = %q, want %q", rel, got, want)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to compare the files: %v", err)
+	}
+}
+
+// durationPlaceholder is the placeholder for a duration in the expected
+// output.
+const durationPlaceholder = "$DURATION"
+
+// durationPattern matches the durations formatted by time.Duration.
+const durationPattern = `[0-9]+(?:\.[0-9]+)?(?:ms|µs|ns|h|m|s)(?:[0-9]+(?:\.[0-9]+)?(?:ms|µs|ns|h|m|s))*`
+
+// matchOutput reports whether got matches the expected output want in which
+// every $DURATION matches a duration.
+func matchOutput(want, got string) bool {
+	if !strings.Contains(want, durationPlaceholder) {
+		return got == want
+	}
+
+	parts := strings.Split(want, durationPlaceholder)
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, durationPattern) + "$").MatchString(got)
+}
+
+// writeGolden writes the expected output s to the file at path. If the old
+// file has durations replaced with $DURATION, the durations in s are replaced
+// too.
+func writeGolden(t *testing.T, path, s string) {
+	t.Helper()
+
+	if old, err := os.ReadFile(path); err == nil && strings.Contains(string(old), durationPlaceholder) {
+		s = regexp.MustCompile(`\b`+durationPattern).ReplaceAllLiteralString(s, durationPlaceholder)
+	}
+
+	writeFile(t, path, s)
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+
+	return string(data)
+}
+
+func writeFile(t *testing.T, path, s string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(s), 0o644); err != nil { //nolint:gosec,mnd
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func copyDir(t *testing.T, src, dst string) {
+	t.Helper()
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0o755) //nolint:mnd,wrapcheck
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		// Keep the mode so that the cases can have executables.
+		return os.WriteFile(filepath.Join(dst, rel), []byte(readFile(t, path)), info.Mode().Perm()) //nolint:wrapcheck
+	})
+	if err != nil {
+		t.Fatalf("failed to copy %s: %v", src, err)
+	}
+}
+
+// TestDocs checks that the generated documentation in the docs directory is up
+// to date with the command definitions. Run the tests with the -update flag to
+// regenerate the documentation.
+func TestDocs(t *testing.T) {
+	t.Parallel()
+
+	ver, err := semver.Parse("0.3.0")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if *update {
+		if err = gendocs.Generate(commandTree(ver), "docs"); err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+
+		return
+	}
+
+	dir := t.TempDir()
+	if err = gendocs.Generate(commandTree(ver), dir); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	want := readTree(t, "docs")
+	got := readTree(t, dir)
+
+	for path, data := range got {
+		if w, ok := want[path]; !ok {
+			t.Errorf("docs/%s is missing", path)
+		} else if w != data {
+			t.Errorf("docs/%s is out of date", path)
+		}
+	}
+
+	for path := range want {
+		if _, ok := got[path]; !ok {
+			t.Errorf("docs/%s is not generated from any command", path)
+		}
+	}
+
+	if t.Failed() {
+		t.Log("run 'go test -run TestDocs -update .' to regenerate the documentation")
+	}
+}
+
+// readTree reads the files in dir to a map from the paths relative to dir to
+// the contents of the files.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		files[filepath.ToSlash(rel)] = readFile(t, path)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+
+	return files
+}
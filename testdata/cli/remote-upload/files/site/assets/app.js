@@ -0,0 +1 @@
+run()